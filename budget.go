@@ -0,0 +1,70 @@
+package zkcache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 进程级内存预算, 由所有Controller共享
+type memoryBudget struct {
+	// 0表示不限制  单位字节
+	limit int64
+	used  int64
+	// 串行化淘汰
+	mu sync.Mutex
+}
+
+var budget = &memoryBudget{}
+
+// 设置进程级内存预算, 所有Controller占用之和超出时从占用最多的Controller开始淘汰
+// 0表示不限制; 各Controller自身的maxSize仍然生效
+func SetMemoryBudget(limit int64) {
+	atomic.StoreInt64(&budget.limit, limit)
+	budget.enforce()
+}
+
+// 进程级内存占用及预算 单位字节
+func MemoryUsage() (used int64, limit int64) {
+	return atomic.LoadInt64(&budget.used), atomic.LoadInt64(&budget.limit)
+}
+
+// 本Controller的内存占用 单位字节
+func (c *Controller) MemoryUsage() int64 {
+	return atomic.LoadInt64(&c.cache.used)
+}
+
+func (b *memoryBudget) add(delta int64) bool {
+	used := atomic.AddInt64(&b.used, delta)
+	return b.exceeded(used)
+}
+
+func (b *memoryBudget) exceeded(used int64) bool {
+	limit := atomic.LoadInt64(&b.limit)
+	return limit > 0 && used > limit
+}
+
+// 每次从占用最多的Controller淘汰一条, 使各Controller的占用趋于均等, 直到回到预算之内
+// 调用时不能持有任何缓存锁
+func (b *memoryBudget) enforce() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.exceeded(atomic.LoadInt64(&b.used)) {
+		victim := largestCache()
+		if victim == nil || !victim.evictOldest() {
+			return
+		}
+	}
+}
+
+func largestCache() *synCache {
+	mu.Lock()
+	defer mu.Unlock()
+	var victim *synCache
+	var max int64
+	for _, c := range controller {
+		if used := atomic.LoadInt64(&c.cache.used); used > max {
+			victim, max = c.cache, used
+		}
+	}
+	return victim
+}
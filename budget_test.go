@@ -0,0 +1,42 @@
+package zkcache
+
+import (
+	"fmt"
+	"testing"
+	"zkCache/lru"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	a := NewController("budget-a", 0, nil, nil)
+	b := NewController("budget-b", 0, nil, nil)
+	base, _ := MemoryUsage()
+	defer SetMemoryBudget(0)
+
+	// 每条 len("key000")+len("value000")+EntryOverhead
+	size := int64(len("key000") + len("value000") + lru.EntryOverhead)
+	SetMemoryBudget(base + 200*size)
+	for i := 0; i < 200; i++ {
+		a.Set(fmt.Sprintf("key%03d", i), fmt.Sprintf("value%03d", i))
+	}
+	if a.MemoryUsage() != 200*size {
+		t.Fatal("check usage", a.MemoryUsage())
+	}
+	for i := 0; i < 200; i++ {
+		b.Set(fmt.Sprintf("key%03d", i), fmt.Sprintf("value%03d", i))
+	}
+	used, limit := MemoryUsage()
+	if used > limit {
+		t.Fatal("usage should be within budget", used, limit)
+	}
+	// 占用多的一方先被淘汰, 最终两者接近
+	if diff := a.MemoryUsage() - b.MemoryUsage(); diff > size || diff < -size {
+		t.Fatal("eviction should be fair", a.MemoryUsage(), b.MemoryUsage())
+	}
+	// 淘汰的是最久未访问的数据
+	if _, ok := a.GetLocal("key000"); ok {
+		t.Fatal("oldest key should be evicted")
+	}
+	if _, ok := b.GetLocal("key199"); !ok {
+		t.Fatal("newest key should be kept")
+	}
+}
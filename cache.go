@@ -1,13 +1,40 @@
 package zkcache
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/spill"
+	"zkCache/zklog"
 )
 
+// 删除记录保留的时间及最大条数, 期间到达的旧版本数据(读修复、副本同步)会被拒绝
+const (
+	tombstoneTTL  = time.Minute
+	maxTombstones = 100000
+)
+
+type tombstone struct {
+	key     string
+	version uint64
+	at      time.Time
+}
+
 type synCache struct {
 	mu  sync.Mutex
 	lru *lru.Cache
+	// 删除记录, 按删除时间排列
+	tombs     map[string]*tombstone
+	tombQueue []*tombstone
+	// 磁盘层, 保存从内存中淘汰的数据; 为nil表示未开启
+	disk *spill.Store
+	// 已计入进程级内存预算的大小, 原子访问
+	used int64
 }
 
 func NewCache(maxSize int, onEvicted lru.OnEvictedFunc) *synCache {
@@ -16,25 +43,358 @@ func NewCache(maxSize int, onEvicted lru.OnEvictedFunc) *synCache {
 	}
 }
 
-func (c *synCache) get(key string) (string, bool) {
+// 释放锁并将内存变化计入进程级预算, 超出预算时触发淘汰
+func (c *synCache) unlock() {
+	over := c.account()
+	c.mu.Unlock()
+	if over {
+		budget.enforce()
+	}
+}
+
+// 需持有锁, 返回是否超出预算
+func (c *synCache) account() bool {
+	size := int64(c.lru.Size())
+	delta := size - atomic.SwapInt64(&c.used, size)
+	return budget.add(delta)
+}
+
+// 淘汰最久未访问的缓存项, 缓存为空时返回false
+func (c *synCache) evictOldest() bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer func() {
+		c.account()
+		c.mu.Unlock()
+	}()
+	return c.lru.RemoveOldest()
+}
+
+func (c *synCache) get(key string) (string, bool) {
+	c.lockPromote(key)
+	defer c.unlock()
 	return c.lru.Get(key)
 }
-func (c *synCache) getAll() map[string]string {
+
+// 加锁, key只在磁盘层时读回内存; 读磁盘时不持有锁, 期间磁盘层有变化时重试, 多次冲突后在锁内读取
+func (c *synCache) lockPromote(key string) {
+	for i := 0; ; i++ {
+		c.mu.Lock()
+		disk := c.disk
+		if disk == nil {
+			return
+		}
+		if _, ok := c.lru.GetEntry(key); ok || !disk.Contains(key) {
+			return
+		}
+		if i >= 3 {
+			if e, ok := disk.Get(key); ok {
+				c.promote(disk, e)
+			}
+			return
+		}
+		gen := disk.Gen()
+		c.mu.Unlock()
+		e, ok := disk.Get(key)
+		c.mu.Lock()
+		if c.disk == disk && disk.Gen() == gen {
+			if ok {
+				zklog.Logger.WithField("key", key).Debug("hit disk")
+				c.promote(disk, e)
+			}
+			return
+		}
+		c.mu.Unlock()
+	}
+}
+
+// 磁盘层的数据读回内存后从磁盘层删除; 只是换层, 不产生变更事件, 需持有锁
+func (c *synCache) promote(disk *spill.Store, e lru.Entry) {
+	if c.lru.Promote(e) != "" {
+		return
+	}
+	if _, ok := c.lru.Peek(e.Key); ok {
+		disk.Remove(e.Key)
+	}
+}
+
+func (c *synCache) getWithVersion(key string) (lru.Entry, bool) {
+	c.lockPromote(key)
+	defer c.unlock()
+	return c.lru.GetEntry(key)
+}
+
+// 写入并返回完整的缓存项, tags非空时替换原有标签
+func (c *synCache) set(key string, value string, tags ...string) (lru.Entry, error) {
+	return c.setWithTTL(key, value, 0, tags...)
+}
+
+// 同set, ttl>0 时设置过期时间, 小于0时取消过期时间, 否则保留原有的过期时间
+func (c *synCache) setWithTTL(key string, value string, ttl time.Duration, tags ...string) (lru.Entry, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.lru.GetAll()
+	defer c.unlock()
+	return c.write(key, value, ttl, tags)
+}
+
+// 以新的版本号写入, 过期时间和标签与值一起写入, 只产生一次变更; ttl和tags含义同setWithTTL, 需持有锁
+func (c *synCache) write(key string, value string, ttl time.Duration, tags []string) (lru.Entry, error) {
+	e := lru.Entry{Key: key, Value: value}
+	if old, ok := c.lru.GetEntry(key); ok {
+		e.Expire, e.Tags = old.Expire, old.Tags
+	}
+	switch {
+	case ttl > 0:
+		e.Expire = time.Now().Add(ttl).UnixNano()
+	case ttl < 0:
+		e.Expire = 0
+	}
+	if len(tags) > 0 {
+		e.Tags = tags
+	}
+	e.Version = c.lru.NextVersion()
+	c.lru.SetEntry(e)
+	return c.written(key)
 }
 
-func (c *synCache) set(key string, value string) {
+// 按准入策略写入新加载的数据, 被拒绝时返回false; ttl大于0时设置过期时间
+func (c *synCache) add(key string, value string, ttl time.Duration, tags ...string) (lru.Entry, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.lru.Set(key, value)
+	defer c.unlock()
+	if !c.lru.Admit(key, value) {
+		return lru.Entry{}, false
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	e, err := c.write(key, value, ttl, tags)
+	return e, err == nil
+}
+
+// 写入之后读取缓存项; 不存在说明超过了单条大小上限被拒绝, 需持有锁
+func (c *synCache) written(key string) (lru.Entry, error) {
+	e, ok := c.lru.GetEntry(key)
+	if !ok {
+		return lru.Entry{}, response.NewErrWithMsg(response.ENTRY_TOO_LARGE,
+			fmt.Sprintf("value of key: %s is too large", key))
+	}
+	return e, nil
+}
+
+// 版本不一致时返回的缓存项中只有当前版本号; ttl含义同setWithTTL
+func (c *synCache) compareAndSet(key string, expected uint64, value string, ttl time.Duration) (lru.Entry, bool, error) {
+	c.lockPromote(key)
+	defer c.unlock()
+	if _, version, _ := c.lru.GetWithVersion(key); version != expected {
+		return lru.Entry{Key: key, Version: version}, false, nil
+	}
+	e, err := c.write(key, value, ttl, nil)
+	return e, true, err
+}
+
+func (c *synCache) removeTag(tag string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	n := c.lru.RemoveTag(tag)
+	if c.disk != nil {
+		n += c.disk.RemoveTag(tag)
+	}
+	return n
+}
+
+// 仅当key不存在或本地版本更旧时写入,返回是否写入; 版本不大于删除记录的数据不写入
+func (c *synCache) merge(e lru.Entry) bool {
+	c.lockPromote(e.Key)
+	defer c.unlock()
+	if e.Version <= c.tombVersion(e.Key) {
+		return false
+	}
+	if _, version, ok := c.lru.GetWithVersion(e.Key); ok && version >= e.Version {
+		return false
+	}
+	c.lru.SetEntry(e)
+	return true
+}
+
+// 将key的值作为整数加上delta, key不存在时从0开始并设置过期时间(ttl>0)
+func (c *synCache) incr(key string, delta int64, ttl time.Duration) (lru.Entry, error) {
+	c.lockPromote(key)
+	defer c.unlock()
+	var n int64
+	value, ok := c.lru.Get(key)
+	if ok {
+		var err error
+		if n, err = parseCounter(key, value); err != nil {
+			return lru.Entry{}, err
+		}
+	}
+	n, err := addCounter(key, n, delta)
+	if err != nil {
+		return lru.Entry{}, err
+	}
+	if ok || ttl < 0 {
+		ttl = 0
+	}
+	return c.write(key, strconv.FormatInt(n, 10), ttl, nil)
+}
+
+// 设置过期时间 UnixNano并生成新的版本号, 0表示永不过期; key不存在时返回false
+func (c *synCache) setExpire(key string, expire int64) (lru.Entry, bool) {
+	c.lockPromote(key)
+	defer c.unlock()
+	if _, ok := c.lru.Touch(key, expire); !ok {
+		return lru.Entry{}, false
+	}
+	return c.lru.GetEntry(key)
+}
+
+func (c *synCache) hottest(n int) []lru.Entry {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.lru.Hottest(n)
+}
+
+// 内存和磁盘层中的全部key, 无序
+func (c *synCache) keys() []string {
+	c.mu.Lock()
+	defer c.unlock()
+	keys := c.lru.Keys()
+	if c.disk != nil {
+		keys = append(keys, c.disk.Keys("", "")...)
+	}
+	return keys
+}
+
+// 读取缓存项, 不影响访问顺序, 磁盘层的数据不读回内存; 已不存在的key被跳过
+func (c *synCache) entries(keys []string) []lru.Entry {
+	c.mu.Lock()
+	entries := make([]lru.Entry, 0, len(keys))
+	onDisk := make([]string, 0)
+	for _, key := range keys {
+		if e, ok := c.lru.Peek(key); ok {
+			entries = append(entries, e)
+		} else {
+			onDisk = append(onDisk, key)
+		}
+	}
+	disk := c.disk
+	c.unlock()
+	// 读磁盘时不持有缓存锁
+	for _, key := range onDisk {
+		if disk == nil {
+			break
+		}
+		if e, ok := disk.Get(key); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
 }
 
-func (c *synCache) remove(key string) {
+// 同lru.Scan, 包含只在磁盘层的key
+func (c *synCache) scan(prefix string, cursor string, limit int) ([]string, string) {
+	c.mu.Lock()
+	defer c.unlock()
+	keys, next := c.lru.Scan(prefix, cursor, limit)
+	if c.disk == nil {
+		return keys, next
+	}
+	// 内存中未返回的key都大于next, 与磁盘层合并后取最小的limit个
+	onDisk := c.disk.Keys(prefix, cursor)
+	if len(onDisk) == 0 {
+		return keys, next
+	}
+	more := next != ""
+	if more {
+		n := 0
+		for _, key := range onDisk {
+			if key < next {
+				onDisk[n] = key
+				n++
+			}
+		}
+		onDisk = onDisk[:n]
+	}
+	keys = append(keys, onDisk...)
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys, more = keys[:limit], true
+	}
+	next = ""
+	if more {
+		next = keys[len(keys)-1]
+	}
+	return keys, next
+}
+
+// 删除内存和磁盘层中的key, 返回删除前是否存在
+func (c *synCache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.removeLocked(key)
+}
+
+// 删除key并记录删除版本, 返回删除前是否存在及删除版本
+// version为0时(归属节点)生成新的删除版本; 否则(副本)使用该版本, 本地数据更新时保留本地数据
+func (c *synCache) delete(key string, version uint64) (bool, uint64) {
+	c.lockPromote(key)
+	defer c.unlock()
+	if version == 0 {
+		version = c.lru.NextVersion()
+	} else {
+		c.lru.Observe(version)
+		if e, ok := c.lru.GetEntry(key); ok && e.Version > version {
+			return true, version
+		}
+	}
+	c.addTomb(key, version)
+	return c.removeLocked(key), version
+}
+
+// key未过期的删除版本, 没有时返回0
+func (c *synCache) deleted(key string) uint64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.tombVersion(key)
+}
+
+// 需持有锁
+func (c *synCache) tombVersion(key string) uint64 {
+	if t, ok := c.tombs[key]; ok && time.Since(t.at) < tombstoneTTL {
+		return t.version
+	}
+	return 0
+}
+
+// 需持有锁; 同时清理过期或超出条数的删除记录
+func (c *synCache) addTomb(key string, version uint64) {
+	if c.tombs == nil {
+		c.tombs = make(map[string]*tombstone)
+	}
+	if t, ok := c.tombs[key]; ok && t.version >= version && time.Since(t.at) < tombstoneTTL {
+		return
+	}
+	t := &tombstone{key: key, version: version, at: time.Now()}
+	c.tombs[key] = t
+	c.tombQueue = append(c.tombQueue, t)
+	n := 0
+	for _, t := range c.tombQueue {
+		if len(c.tombQueue)-n <= maxTombstones && time.Since(t.at) < tombstoneTTL {
+			break
+		}
+		if c.tombs[t.key] == t {
+			delete(c.tombs, t.key)
+		}
+		n++
+	}
+	c.tombQueue = c.tombQueue[n:]
+}
+
+// 需持有锁
+func (c *synCache) removeLocked(key string) bool {
+	_, exist := c.lru.GetEntry(key)
 	c.lru.Remove(key)
+	if c.disk != nil {
+		exist = exist || c.disk.Contains(key)
+		c.disk.Remove(key)
+	}
+	return exist
 }
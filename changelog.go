@@ -0,0 +1,89 @@
+package zkcache
+
+import (
+	"sync"
+	"time"
+	"zkCache/lru"
+)
+
+// 变更流保留的最近事件数
+var ChangeLogSize = 10000
+
+// 缓存变更事件; 过期是惰性的, expire事件在读写到已过期的key时才产生
+type ChangeEvent struct {
+	// 变更流的纪元, 进程重启后改变, 序号只在同一纪元内连续
+	Epoch uint64 `json:"epoch"`
+	// 本节点上该Controller的事件序号, 从1开始递增
+	Seq     uint64 `json:"seq"`
+	Op      lru.Op `json:"op"`
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+// 定长环形缓冲区, 写满后覆盖最旧的事件
+type changeLog struct {
+	mu     sync.Mutex
+	epoch  uint64
+	seq    uint64
+	events []ChangeEvent
+	// 有新事件时关闭并替换, 用于唤醒等待者
+	notify chan struct{}
+}
+
+func newChangeLog(size int) *changeLog {
+	if size <= 0 {
+		size = 1
+	}
+	return &changeLog{
+		epoch:  uint64(time.Now().UnixMicro()),
+		events: make([]ChangeEvent, size),
+		notify: make(chan struct{}),
+	}
+}
+
+func (l *changeLog) append(op lru.Op, e lru.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	event := ChangeEvent{Epoch: l.epoch, Seq: l.seq, Op: op, Key: e.Key, Version: e.Version, Time: time.Now().UnixNano()}
+	if op == lru.OpSet {
+		event.Value = e.Value
+	}
+	l.events[(l.seq-1)%uint64(len(l.events))] = event
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// 返回纪元epoch中序号大于since的至多max个事件, since为0时从头读取, 不需要纪元
+// lost为true表示since之后有事件已被覆盖, 或者纪元不一致(节点已重启), 此时从保留的最旧事件开始返回
+// 没有新事件时可等待返回的通道关闭
+func (l *changeLog) since(epoch uint64, since uint64, max int) (events []ChangeEvent, lost bool, wait <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if since > 0 && epoch != l.epoch {
+		since, lost = 0, true
+	}
+	oldest := uint64(1)
+	if l.seq > uint64(len(l.events)) {
+		oldest = l.seq - uint64(len(l.events)) + 1
+	}
+	if since+1 < oldest {
+		since, lost = oldest-1, true
+	}
+	for seq := since + 1; seq <= l.seq && (max <= 0 || len(events) < max); seq++ {
+		events = append(events, l.events[(seq-1)%uint64(len(l.events))])
+	}
+	return events, lost, l.notify
+}
+
+// 读取本节点的变更事件, 参数与返回值含义同changeLog.since
+func (c *Controller) Changes(epoch uint64, since uint64, max int) ([]ChangeEvent, bool, <-chan struct{}) {
+	return c.changes.since(epoch, since, max)
+}
+
+// 当前变更流的纪元
+func (c *Controller) ChangeEpoch() uint64 {
+	return c.changes.epoch
+}
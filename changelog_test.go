@@ -0,0 +1,60 @@
+package zkcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"zkCache/lru"
+)
+
+func TestChangeLog(t *testing.T) {
+	l := newChangeLog(3)
+	_, _, wait := l.since(0, 0, 0)
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		l.append(lru.OpSet, lru.Entry{Key: key, Value: "v"})
+	}
+	select {
+	case <-wait:
+	default:
+		t.Fatal("waiter should be notified")
+	}
+
+	events, lost, _ := l.since(0, 0, 0)
+	if !lost || len(events) != 3 || events[0].Key != "k2" || events[0].Seq != 2 {
+		t.Fatal("oldest event should be overwritten", events, lost)
+	}
+	events, lost, _ = l.since(l.epoch, 2, 1)
+	if lost || len(events) != 1 || events[0].Key != "k3" {
+		t.Fatal("resume from seq", events, lost)
+	}
+	if events, _, _ := l.since(l.epoch, 4, 0); len(events) != 0 {
+		t.Fatal("no new events", events)
+	}
+	// 重启后纪元改变, 续传时报告丢失并从头开始
+	events, lost, _ = newChangeLog(3).since(l.epoch-1, 4, 0)
+	if !lost || len(events) != 0 {
+		t.Fatal("resume from another epoch should be lost", events, lost)
+	}
+}
+
+func TestControllerChanges(t *testing.T) {
+	c := NewController("changes", 0, nil, nil)
+	c.Set("k", "v")
+	c.SetWithTTL("t", "v", time.Hour)
+	c.Incr("n", 1, time.Millisecond)
+	c.InvalidateTag("none")
+	c.cache.remove("k")
+	time.Sleep(2 * time.Millisecond)
+	c.cache.get("n")
+
+	events, _, _ := c.Changes(0, 0, 0)
+	ops := make([]lru.Op, 0)
+	for _, e := range events {
+		ops = append(ops, e.Op)
+	}
+	// 带过期时间的写入只产生一个set事件
+	want := []lru.Op{lru.OpSet, lru.OpSet, lru.OpSet, lru.OpDelete, lru.OpExpire}
+	if !reflect.DeepEqual(want, ops) {
+		t.Fatal("check ops", ops)
+	}
+}
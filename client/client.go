@@ -0,0 +1,346 @@
+// 官方Go客户端: 从注册中心发现节点, 按与服务端相同的一致性hash直接请求归属节点,
+// 归属节点不可用时依次重试hash环上的后继节点(即副本)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"zkCache/consistenthash"
+	"zkCache/pkg/response"
+	"zkCache/registry"
+	"zkCache/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 与服务端NodePool的虚拟节点数一致, 保证路由结果相同
+const virtualNodeCount = 100
+
+type Config struct {
+	// 注册中心地址, 默认 registry.ServiceURL
+	Registry    string
+	ServiceName registry.ServiceName
+	// 非空时使用固定的节点列表, 不访问注册中心
+	Nodes []string
+	// 为空时使用节点的默认Controller
+	Group string
+	// 单次请求的超时时间, 默认2s
+	Timeout time.Duration
+	// 传输错误时换节点重试的次数, 默认2, 小于0表示不重试
+	Retries int
+	// 从注册中心刷新节点列表的间隔, 默认10s
+	RefreshInterval time.Duration
+}
+
+type Client struct {
+	cfg Config
+
+	mu    sync.Mutex
+	ring  *consistenthash.Map
+	nodes []string
+	// 按节点复用的连接
+	conns map[string]*grpc.ClientConn
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func New(cfg Config) (*Client, error) {
+	if cfg.Registry == "" {
+		cfg.Registry = registry.ServiceURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	} else if cfg.Retries == 0 {
+		cfg.Retries = 2
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 10 * time.Second
+	}
+	if len(cfg.Nodes) == 0 && cfg.ServiceName == "" {
+		return nil, fmt.Errorf("zkcache: either Nodes or ServiceName is required")
+	}
+	c := &Client{
+		cfg:   cfg,
+		conns: make(map[string]*grpc.ClientConn),
+		stop:  make(chan struct{}),
+	}
+	if len(cfg.Nodes) > 0 {
+		c.setNodes(cfg.Nodes)
+		return c, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	go c.refreshLoop()
+	return c, nil
+}
+
+// 当前参与路由的节点
+func (c *Client) Nodes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.nodes...)
+}
+
+// key的归属节点及其后继节点, 即请求的尝试顺序
+func (c *Client) Locate(key string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ring == nil {
+		return nil
+	}
+	return c.ring.GetN(key, c.cfg.Retries+1)
+}
+
+// 从注册中心拉取节点列表
+func (c *Client) Refresh(ctx context.Context) error {
+	u := fmt.Sprintf("%s/nodes?serviceName=%s", strings.TrimSuffix(c.cfg.Registry, "/"),
+		url.QueryEscape(string(c.cfg.ServiceName)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg := struct {
+		Code int                  `json:"code"`
+		Msg  string               `json:"msg"`
+		Data registry.GetNodesDTO `json:"data"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("registry returned: %v", res.Status)
+	}
+	if msg.Code != response.SUCCESS {
+		return &Error{Code: msg.Code, Msg: msg.Msg}
+	}
+	c.setNodes(msg.Data.Urls)
+	return nil
+}
+
+func (c *Client) refreshLoop() {
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+			// 刷新失败时继续使用旧的节点列表
+			c.Refresh(ctx)
+			cancel()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Client) setNodes(nodes []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ring := consistenthash.New(virtualNodeCount, nil)
+	ring.Set(nodes...)
+	c.ring = ring
+	c.nodes = append([]string(nil), nodes...)
+	for node, conn := range c.conns {
+		if !contains(nodes, node) {
+			conn.Close()
+			delete(c.conns, node)
+		}
+	}
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) conn(node string) (rpc.CacheClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[node]; ok {
+		return rpc.NewCacheClient(conn), nil
+	}
+	target := strings.TrimPrefix(strings.TrimPrefix(node, "http://"), "https://")
+	conn, err := grpc.Dial(target, append(rpc.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[node] = conn
+	return rpc.NewCacheClient(conn), nil
+}
+
+// 依次在key的候选节点上执行fn, 仅在传输错误时换下一个节点
+func (c *Client) do(ctx context.Context, key string, fn func(ctx context.Context, cc rpc.CacheClient) error) error {
+	nodes := c.Locate(key)
+	if len(nodes) == 0 {
+		return ErrNoNodes
+	}
+	var last error
+	for _, node := range nodes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cc, err := c.conn(node)
+		if err != nil {
+			last = err
+			continue
+		}
+		callCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		err = fn(callCtx, cc)
+		cancel()
+		err, business := convert(err)
+		if business {
+			return err
+		}
+		last = fmt.Errorf("%s: %v", node, err)
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, last)
+}
+
+// 读取key, 不存在时返回 ErrNotFound
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.do(ctx, key, func(ctx context.Context, cc rpc.CacheClient) error {
+		resp, err := cc.Get(ctx, &rpc.GetRequest{Group: c.cfg.Group, Key: key})
+		if err != nil {
+			return err
+		}
+		value = resp.Value
+		return nil
+	})
+	return value, err
+}
+
+// 写入key, ttl大于0时设置过期时间
+func (c *Client) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return c.do(ctx, key, func(ctx context.Context, cc rpc.CacheClient) error {
+		_, err := cc.Set(ctx, &rpc.SetRequest{
+			Group: c.cfg.Group,
+			Key:   key,
+			Value: value,
+			Ttl:   ttl.Milliseconds(),
+		})
+		return err
+	})
+}
+
+// 删除key, 返回删除前是否存在
+func (c *Client) Delete(ctx context.Context, key string) (bool, error) {
+	var existed bool
+	err := c.do(ctx, key, func(ctx context.Context, cc rpc.CacheClient) error {
+		resp, err := cc.Delete(ctx, &rpc.DeleteRequest{Group: c.cfg.Group, Key: key})
+		if err != nil {
+			return err
+		}
+		existed = resp.Existed
+		return nil
+	})
+	return existed, err
+}
+
+// 批量读取, 按归属节点分组并发请求; 返回值只包含存在的key
+func (c *Client) GetMany(ctx context.Context, keys []string) (map[string]string, error) {
+	groups := make(map[string][]string)
+	for _, key := range keys {
+		nodes := c.Locate(key)
+		if len(nodes) == 0 {
+			return nil, ErrNoNodes
+		}
+		groups[nodes[0]] = append(groups[nodes[0]], key)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	values := make(map[string]string, len(keys))
+	errs := make([]error, 0)
+	for node, group := range groups {
+		wg.Add(1)
+		go func(node string, group []string) {
+			defer wg.Done()
+			items, err := c.getMany(ctx, node, group)
+			if err != nil {
+				// 归属节点不可用时逐个key换节点重试
+				items, err = c.getEach(ctx, group)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for _, item := range items {
+				if item.Found {
+					values[item.Key] = item.Value
+				}
+			}
+		}(node, group)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return values, errs[0]
+	}
+	return values, nil
+}
+
+func (c *Client) getMany(ctx context.Context, node string, keys []string) ([]*rpc.Item, error) {
+	cc, err := c.conn(node)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	resp, err := cc.GetMany(ctx, &rpc.GetManyRequest{Group: c.cfg.Group, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+func (c *Client) getEach(ctx context.Context, keys []string) ([]*rpc.Item, error) {
+	items := make([]*rpc.Item, 0, len(keys))
+	for _, key := range keys {
+		value, err := c.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &rpc.Item{Key: key, Value: value, Found: true})
+	}
+	return items, nil
+}
+
+// 停止刷新并关闭所有连接
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for node, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, node)
+	}
+	return nil
+}
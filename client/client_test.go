@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	zkcache "zkCache"
+	"zkCache/registry"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+)
+
+type node struct {
+	controller *zkcache.Controller
+	grpc       *grpc.Server
+	srv        *httptest.Server
+}
+
+func (n *node) close() {
+	n.grpc.Stop()
+	n.srv.Close()
+}
+
+// 启动count个单机节点, 数据源返回 "db:"+key, 以 "missing" 开头的key不存在
+func newNodes(t *testing.T, name string, count int) map[string]*node {
+	nodes := make(map[string]*node)
+	for i := 0; i < count; i++ {
+		c := zkcache.NewController(fmt.Sprintf("%s%d", name, i), 0, func(key string) (string, error) {
+			if len(key) >= 7 && key[:7] == "missing" {
+				return "", errors.New("not found")
+			}
+			return "db:" + key, nil
+		}, nil)
+		s := zkcache.NewGRPCServer(c)
+		srv := httptest.NewServer(zkcache.GRPCHandler(s, http.NotFoundHandler()))
+		n := &node{controller: c, grpc: s, srv: srv}
+		nodes[srv.URL] = n
+		t.Cleanup(n.close)
+	}
+	return nodes
+}
+
+func urls(nodes map[string]*node) []string {
+	res := make([]string, 0, len(nodes))
+	for u := range nodes {
+		res = append(res, u)
+	}
+	return res
+}
+
+func TestClient(t *testing.T) {
+	nodes := newNodes(t, "clientRoute", 3)
+	c, err := New(Config{Nodes: urls(nodes)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if err := c.Set(ctx, key, "value", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		// 直接写入归属节点
+		owner := nodes[c.Locate(key)[0]]
+		if e, ok := owner.controller.GetLocal(key); !ok || e.Value != "value" || e.Expire == 0 {
+			t.Fatal("key should be stored on its owner", key, e)
+		}
+	}
+	if value, err := c.Get(ctx, "key1"); err != nil || value != "value" {
+		t.Fatal("check get", value, err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("check not found", err)
+	}
+	if err := c.Set(ctx, "", "value", 0); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatal("check invalid argument", err)
+	}
+	if existed, err := c.Delete(ctx, "key1"); err != nil || !existed {
+		t.Fatal("check delete", existed, err)
+	}
+
+	values, err := c.GetMany(ctx, []string{"key2", "key3", "missing1", "other"})
+	if err != nil || len(values) != 3 || values["key2"] != "value" || values["other"] != "db:other" {
+		t.Fatal("check get many", values, err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	nodes := newNodes(t, "clientRetry", 3)
+	c, err := New(Config{Nodes: urls(nodes), Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	candidates := c.Locate("key")
+	nodes[candidates[0]].close()
+	if value, err := c.Get(ctx, "key"); err != nil || value != "db:key" {
+		t.Fatal("should retry on the next node", value, err)
+	}
+	if values, err := c.GetMany(ctx, []string{"key"}); err != nil || values["key"] != "db:key" {
+		t.Fatal("get many should retry on the next node", values, err)
+	}
+	if _, ok := nodes[candidates[1]].controller.GetLocal("key"); !ok {
+		t.Fatal("next node should serve the key")
+	}
+
+	for _, n := range nodes {
+		n.close()
+	}
+	if _, err := c.Get(ctx, "key"); !errors.Is(err, ErrUnavailable) {
+		t.Fatal("check unavailable", err)
+	}
+}
+
+func TestClientDiscovery(t *testing.T) {
+	nodes := newNodes(t, "clientDiscovery", 2)
+	router := gin.New()
+	registry.RegisterHandlers(router)
+	reg := httptest.NewServer(router)
+	defer reg.Close()
+
+	empty, err := New(Config{Registry: reg.URL + "/services", ServiceName: "clientDiscovery"})
+	if err != nil {
+		t.Fatal("empty service should not fail", err)
+	}
+	if _, err := empty.Get(context.Background(), "key"); !errors.Is(err, ErrNoNodes) {
+		t.Fatal("check no nodes", err)
+	}
+	empty.Close()
+	for u := range nodes {
+		res, err := http.Post(reg.URL+"/services", "application/json",
+			jsonBody(registry.RegistrationVO{ServiceName: "clientDiscovery", ServiceURL: u}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	c, err := New(Config{Registry: reg.URL + "/services", ServiceName: "clientDiscovery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if len(c.Nodes()) != 2 {
+		t.Fatal("check nodes", c.Nodes())
+	}
+	if err := c.Set(context.Background(), "key", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("check not found", err)
+	}
+}
+
+func jsonBody(v interface{}) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	json.NewEncoder(buf).Encode(v)
+	return buf
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"errors"
+	"zkCache/pkg/response"
+)
+
+// 服务端返回的业务错误, 可用 errors.Is 与下方的预定义错误比较
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// 按错误码比较, 不比较Msg
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrNotFound        = &Error{Code: response.NOT_FOUND, Msg: "zkcache: key not found"}
+	ErrInvalidArgument = &Error{Code: response.PARAMETER_ERROR, Msg: "zkcache: invalid argument"}
+	ErrVersionMismatch = &Error{Code: response.VERSION_MISMATCH, Msg: "zkcache: version mismatch"}
+	ErrEntryTooLarge   = &Error{Code: response.ENTRY_TOO_LARGE, Msg: "zkcache: entry too large"}
+
+	// 注册中心没有可用节点
+	ErrNoNodes = errors.New("zkcache: no available nodes")
+	// 所有候选节点都无法连接或超时, 会包装最后一次的错误
+	ErrUnavailable = errors.New("zkcache: all nodes unavailable")
+)
+
+// 转换为业务错误, 第二个返回值为false表示传输错误, 可以换节点重试
+func convert(err error) (error, bool) {
+	if err == nil {
+		return nil, true
+	}
+	if code, ok := response.ErrCode(err); ok {
+		return &Error{Code: code, Msg: err.Error()}, true
+	}
+	return err, false
+}
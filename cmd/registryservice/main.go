@@ -52,7 +52,7 @@ func main() {
 	}()
 	go func() {
 		zklog.Logger.WithField("msg", "注册中心 started. Press use 'Ctrl + c' to stop.").Info()
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
 		<-c
 		srv.Shutdown(ctx)
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	zkcache "zkCache"
+	"zkCache/registry"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件中的时长, 格式同 time.ParseDuration, 如 "10s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+type Config struct {
+	// host:port, 同时作为注册到注册中心的地址 http://host:port
+	Listen   string `yaml:"listen" toml:"listen"`
+	Registry string `yaml:"registry" toml:"registry"`
+	Service  string `yaml:"service" toml:"service"`
+	// trace/debug/info/warn/error
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// 节点间通信方式 http 或 grpc
+	PeerTransport string `yaml:"peer_transport" toml:"peer_transport"`
+	// 为空表示不开启
+	RespAddr     string `yaml:"resp_addr" toml:"resp_addr"`
+	MemcacheAddr string `yaml:"memcache_addr" toml:"memcache_addr"`
+	// 进程内所有分组的内存上限, 0表示不限制  单位字节
+	MemoryBudget int64         `yaml:"memory_budget" toml:"memory_budget"`
+	Drain        DrainConfig   `yaml:"drain" toml:"drain"`
+	Groups       []GroupConfig `yaml:"groups" toml:"groups"`
+}
+
+type DrainConfig struct {
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// 迁移的热点数据条数, 0表示全部
+	HotKeys int `yaml:"hot_keys" toml:"hot_keys"`
+}
+
+type GroupConfig struct {
+	Name string `yaml:"name" toml:"name"`
+	// 缓存容量, 0表示不限制  单位字节
+	Size int `yaml:"size" toml:"size"`
+	// 默认过期时间, 0表示不过期
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+	// 准入策略 lru(全部接受) 或 tinylfu
+	Policy       string       `yaml:"policy" toml:"policy"`
+	MaxEntrySize int          `yaml:"max_entry_size" toml:"max_entry_size"`
+	Replicas     int          `yaml:"replicas" toml:"replicas"`
+	Loader       LoaderConfig `yaml:"loader" toml:"loader"`
+}
+
+type LoaderConfig struct {
+	// none(不访问数据源), static(使用data中的数据), http, sql 或 file
+	Type string            `yaml:"type" toml:"type"`
+	Data map[string]string `yaml:"data" toml:"data"`
+	// http: 源站地址模板, {key} 会被替换为转义后的key
+	URL     string            `yaml:"url" toml:"url"`
+	Headers map[string]string `yaml:"headers" toml:"headers"`
+	// http与sql的单次请求超时, 0表示不限制
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// sql: 驱动名(目前内置mysql)、连接串以及带一个参数的查询
+	Driver string `yaml:"driver" toml:"driver"`
+	DSN    string `yaml:"dsn" toml:"dsn"`
+	Query  string `yaml:"query" toml:"query"`
+	// file: 目录(每个key一个文件) 或 key=value/JSON文件
+	Path string `yaml:"path" toml:"path"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Listen:        "localhost:8881",
+		Registry:      registry.ServiceURL,
+		Service:       "cache",
+		LogLevel:      "info",
+		PeerTransport: string(zkcache.TransportHTTP),
+		Drain: DrainConfig{
+			Timeout: Duration(10 * time.Second),
+			HotKeys: 1000,
+		},
+	}
+}
+
+// 读取配置文件, 按扩展名选择YAML或TOML; path为空时只使用默认值
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		cfg.fillGroups()
+		return cfg, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	case ".toml":
+		dec := toml.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	cfg.fillGroups()
+	return cfg, nil
+}
+
+// 没有配置分组时使用一个默认分组, 分组中未填写的项使用默认值
+func (cfg *Config) fillGroups() {
+	if len(cfg.Groups) == 0 {
+		cfg.Groups = []GroupConfig{{Name: "default"}}
+	}
+	for i := range cfg.Groups {
+		g := &cfg.Groups[i]
+		if g.Policy == "" {
+			g.Policy = "lru"
+		}
+		if g.Replicas == 0 {
+			g.Replicas = 1
+		}
+		if g.Loader.Type == "" {
+			g.Loader.Type = "none"
+		}
+	}
+}
+
+// 环境变量覆盖配置文件
+var envKeys = map[string]func(cfg *Config, v string){
+	"ZKCACHE_LISTEN":         func(cfg *Config, v string) { cfg.Listen = v },
+	"ZKCACHE_REGISTRY":       func(cfg *Config, v string) { cfg.Registry = v },
+	"ZKCACHE_SERVICE":        func(cfg *Config, v string) { cfg.Service = v },
+	"ZKCACHE_LOG_LEVEL":      func(cfg *Config, v string) { cfg.LogLevel = v },
+	"ZKCACHE_PEER_TRANSPORT": func(cfg *Config, v string) { cfg.PeerTransport = v },
+	"ZKCACHE_RESP_ADDR":      func(cfg *Config, v string) { cfg.RespAddr = v },
+	"ZKCACHE_MEMCACHE_ADDR":  func(cfg *Config, v string) { cfg.MemcacheAddr = v },
+}
+
+func (cfg *Config) applyEnv(getenv func(string) string) {
+	for key, set := range envKeys {
+		if v := getenv(key); v != "" {
+			set(cfg, v)
+		}
+	}
+}
+
+// 检查配置, 返回所有问题
+func (cfg *Config) validate() error {
+	errs := make([]string, 0)
+	if _, _, err := splitListen(cfg.Listen); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if u, err := url.Parse(cfg.Registry); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("registry: invalid url %q", cfg.Registry))
+	}
+	if cfg.Service == "" {
+		errs = append(errs, "service: required")
+	}
+	if _, err := logrus.ParseLevel(cfg.LogLevel); err != nil {
+		errs = append(errs, fmt.Sprintf("log_level: %v", err))
+	}
+	switch zkcache.Transport(cfg.PeerTransport) {
+	case zkcache.TransportHTTP, zkcache.TransportGRPC:
+	default:
+		errs = append(errs, fmt.Sprintf("peer_transport: must be http or grpc, got %q", cfg.PeerTransport))
+	}
+	if cfg.MemoryBudget < 0 {
+		errs = append(errs, "memory_budget: must not be negative")
+	}
+	if cfg.Drain.Timeout < 0 || cfg.Drain.HotKeys < 0 {
+		errs = append(errs, "drain: timeout and hot_keys must not be negative")
+	}
+	names := make(map[string]struct{}, len(cfg.Groups))
+	for i, g := range cfg.Groups {
+		prefix := fmt.Sprintf("groups[%d]", i)
+		if g.Name == "" {
+			errs = append(errs, prefix+".name: required")
+		} else if _, ok := names[g.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s.name: duplicate group %q", prefix, g.Name))
+		}
+		names[g.Name] = struct{}{}
+		if g.Size < 0 || g.MaxEntrySize < 0 || g.TTL < 0 {
+			errs = append(errs, prefix+": size, max_entry_size and ttl must not be negative")
+		}
+		if g.Replicas < 1 {
+			errs = append(errs, prefix+".replicas: must be at least 1")
+		}
+		if g.Policy != "lru" && g.Policy != "tinylfu" {
+			errs = append(errs, fmt.Sprintf("%s.policy: must be lru or tinylfu, got %q", prefix, g.Policy))
+		}
+		errs = append(errs, g.Loader.validate(prefix+".loader")...)
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func (l LoaderConfig) validate(prefix string) []string {
+	errs := make([]string, 0)
+	if l.Timeout < 0 {
+		errs = append(errs, prefix+".timeout: must not be negative")
+	}
+	switch l.Type {
+	case "none", "static":
+	case "http":
+		if !strings.Contains(l.URL, "{key}") {
+			errs = append(errs, prefix+".url: must contain {key}")
+		}
+	case "sql":
+		if l.Driver == "" || l.DSN == "" || l.Query == "" {
+			errs = append(errs, prefix+": driver, dsn and query are required")
+		}
+	case "file":
+		if l.Path == "" {
+			errs = append(errs, prefix+".path: is required")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s.type: unknown loader %q", prefix, l.Type))
+	}
+	return errs
+}
+
+func splitListen(listen string) (string, int, error) {
+	host, p, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", 0, fmt.Errorf("listen: %v", err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("listen: invalid port %q", p)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("listen: host is required, it is also the address registered to the registry")
+	}
+	return host, port, nil
+}
+
+// 与old相比需要重启才能生效的改动, 重新加载时只记录不应用
+func (cfg *Config) restartRequired(old *Config) []string {
+	changed := make([]string, 0)
+	check := func(name string, a, b interface{}) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			changed = append(changed, name)
+		}
+	}
+	check("listen", cfg.Listen, old.Listen)
+	check("registry", cfg.Registry, old.Registry)
+	check("service", cfg.Service, old.Service)
+	check("peer_transport", cfg.PeerTransport, old.PeerTransport)
+	check("resp_addr", cfg.RespAddr, old.RespAddr)
+	check("memcache_addr", cfg.MemcacheAddr, old.MemcacheAddr)
+	// 第一个分组为节点的默认分组
+	check("groups[0].name", cfg.Groups[0].Name, old.Groups[0].Name)
+	groups := make(map[string]GroupConfig, len(old.Groups))
+	for _, g := range old.Groups {
+		groups[g.Name] = g
+	}
+	for _, g := range cfg.Groups {
+		o, ok := groups[g.Name]
+		if !ok {
+			changed = append(changed, "groups."+g.Name)
+			continue
+		}
+		delete(groups, g.Name)
+		check("groups."+g.Name+".replicas", g.Replicas, o.Replicas)
+		check("groups."+g.Name+".loader", g.Loader, o.Loader)
+	}
+	for name := range groups {
+		changed = append(changed, "groups."+name)
+	}
+	return changed
+}
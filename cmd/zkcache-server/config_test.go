@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig("zkcache.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	g := cfg.Groups[0]
+	if cfg.Listen != "localhost:8881" || g.Name != "scores" || time.Duration(g.TTL) != 10*time.Minute ||
+		g.Policy != "tinylfu" || g.Loader.Data["demo"] != "demoValue" || time.Duration(cfg.Drain.Timeout) != 10*time.Second {
+		t.Fatal("check yaml", cfg)
+	}
+	if l := cfg.Groups[1].Loader; l.Type != "http" || time.Duration(l.Timeout) != 2*time.Second || l.Headers["Authorization"] == "" {
+		t.Fatal("check http loader", l)
+	}
+
+	path := writeConfig(t, "zkcache.toml", `
+listen = "0.0.0.0:8882"
+log_level = "debug"
+
+[[groups]]
+name = "users"
+ttl = "30s"
+
+[[groups]]
+name = "orders"
+replicas = 3
+`)
+	cfg, err = loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != "0.0.0.0:8882" || cfg.Service != "cache" || len(cfg.Groups) != 2 ||
+		time.Duration(cfg.Groups[0].TTL) != 30*time.Second || cfg.Groups[0].Policy != "lru" ||
+		cfg.Groups[0].Replicas != 1 || cfg.Groups[1].Replicas != 3 || cfg.Groups[1].Loader.Type != "none" {
+		t.Fatal("check toml and defaults", cfg)
+	}
+
+	if _, err := loadConfig(writeConfig(t, "bad.yaml", "listen: a:1\nunknown: 1\n")); err == nil {
+		t.Fatal("unknown field should be rejected")
+	}
+	if _, err := loadConfig(writeConfig(t, "bad.json", "{}")); err == nil {
+		t.Fatal("unsupported format should be rejected")
+	}
+	if cfg, err := loadConfig(""); err != nil || len(cfg.Groups) != 1 || cfg.Groups[0].Name != "default" {
+		t.Fatal("check default config", cfg, err)
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.applyEnv(func(key string) string {
+		return map[string]string{"ZKCACHE_LISTEN": "127.0.0.1:9000", "ZKCACHE_LOG_LEVEL": "warn"}[key]
+	})
+	if cfg.Listen != "127.0.0.1:9000" || cfg.LogLevel != "warn" || cfg.Service != "cache" {
+		t.Fatal("check env override", cfg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Listen = ":8881"
+	cfg.Registry = "localhost:9999"
+	cfg.LogLevel = "loud"
+	cfg.Groups = []GroupConfig{
+		{Name: "a", Policy: "lru", Replicas: 1, Loader: LoaderConfig{Type: "none"}},
+		{Name: "a", Policy: "lfu", Replicas: 0, Size: -1, Loader: LoaderConfig{Type: "redis"}},
+		{Name: "b", Policy: "lru", Replicas: 1, Loader: LoaderConfig{Type: "http", URL: "http://origin/items"}},
+		{Name: "c", Policy: "lru", Replicas: 1, Loader: LoaderConfig{Type: "sql", Driver: "mysql", Timeout: -1}},
+	}
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("config should be invalid")
+	}
+	for _, want := range []string{"listen", "registry", "log_level", "duplicate group", "groups[1].policy",
+		"groups[1].replicas", "groups[1]: size", "groups[1].loader.type", "groups[2].loader.url",
+		"groups[3].loader.timeout", "groups[3].loader: driver"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatal("missing error", want, err)
+		}
+	}
+}
+
+func TestNewLoaders(t *testing.T) {
+	path := writeConfig(t, "data.txt", "key=value\n")
+	loaders, err := newLoaders([]GroupConfig{
+		{Name: "loader-file", Loader: LoaderConfig{Type: "file", Path: path}},
+		{Name: "loader-none", Loader: LoaderConfig{Type: "none"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaders["loader-none"]; ok {
+		t.Fatal("none should not create a loader")
+	}
+	if v, err := loaders["loader-file"]("key"); err != nil || v != "value" {
+		t.Fatal("check file loader", v, err)
+	}
+	_, err = newLoaders([]GroupConfig{{Name: "broken", Loader: LoaderConfig{Type: "file", Path: path + ".missing"}}})
+	if err == nil || !strings.Contains(err.Error(), "groups.broken.loader") {
+		t.Fatal("missing file should fail", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	old := defaultConfig()
+	old.Groups = []GroupConfig{{Name: "a", Replicas: 1, Size: 100}, {Name: "b", Replicas: 1}}
+	next := defaultConfig()
+	next.Listen = "localhost:9000"
+	next.LogLevel = "debug"
+	next.Groups = []GroupConfig{{Name: "a", Replicas: 2, Size: 200}, {Name: "c", Replicas: 1}}
+
+	changed := strings.Join(next.restartRequired(old), ",")
+	for _, want := range []string{"listen", "groups.a.replicas", "groups.c", "groups.b"} {
+		if !strings.Contains(changed, want) {
+			t.Fatal("check restart required", want, changed)
+		}
+	}
+	if strings.Contains(changed, "log_level") {
+		t.Fatal("log_level can be reloaded", changed)
+	}
+
+	groups := mergeGroups(old.Groups, next.Groups)
+	if len(groups) != 2 || groups[0].Size != 200 || groups[0].Replicas != 1 || groups[1].Name != "b" {
+		t.Fatal("check merge groups", groups)
+	}
+}
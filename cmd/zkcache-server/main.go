@@ -0,0 +1,234 @@
+// zkcache-server: 缓存节点, 配置来自YAML/TOML文件, 可被环境变量和命令行参数覆盖
+// 收到SIGHUP时重新读取配置文件, 只应用可以在运行中修改的配置
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	zkcache "zkCache"
+	"zkCache/loader"
+	"zkCache/lru"
+	"zkCache/registry"
+	"zkCache/service"
+	"zkCache/zklog"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	var path string
+	flag.StringVar(&path, "config", "", "config file (.yaml, .yml or .toml)")
+	flag.String("listen", "", "listen address host:port, overrides config")
+	flag.String("registry", "", "registry url, overrides config")
+	flag.String("service", "", "service name in registry, overrides config")
+	flag.String("log-level", "", "log level, overrides config")
+	flag.Parse()
+
+	cfg, err := load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	host, port, _ := splitListen(cfg.Listen)
+
+	registry.ServiceURL = cfg.Registry
+	service.RespAddr = cfg.RespAddr
+	service.MemcacheAddr = cfg.MemcacheAddr
+	service.PeerTransport = zkcache.Transport(cfg.PeerTransport)
+	applyGlobal(cfg)
+	// 数据源在启动服务前创建, 连接失败时直接退出
+	loaders, err := newLoaders(cfg.Groups)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	reg := registry.RegistrationVO{
+		ServiceName: registry.ServiceName(cfg.Service),
+		ServiceURL:  fmt.Sprintf("http://%s:%d", host, port),
+	}
+	ctx, err := service.Start(context.Background(), host, port, reg,
+		func(router *gin.Engine, controller *zkcache.Controller) {},
+		func() *zkcache.Controller { return createGroups(cfg, loaders) })
+	if err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		panic(err)
+	}
+
+	go reloadOnSighup(path, cfg)
+	<-ctx.Done()
+	zklog.Logger.WithField("msg", "shutdown ....").Warn()
+}
+
+// 配置文件 < 环境变量 < 命令行参数
+func load(path string) (*Config, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.applyEnv(os.Getenv)
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Listen = f.Value.String()
+		case "registry":
+			cfg.Registry = f.Value.String()
+		case "service":
+			cfg.Service = f.Value.String()
+		case "log-level":
+			cfg.LogLevel = f.Value.String()
+		}
+	})
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 创建所有分组, 返回第一个分组作为节点的默认分组
+func createGroups(cfg *Config, loaders map[string]zkcache.Get) *zkcache.Controller {
+	var first *zkcache.Controller
+	for _, g := range cfg.Groups {
+		c := zkcache.NewController(g.Name, g.Size, loaders[g.Name], nil)
+		c.SetReplicas(g.Replicas)
+		applyGroup(c, g, nil)
+		if first == nil {
+			first = c
+		}
+	}
+	return first
+}
+
+// 按分组创建数据源, 并统计各数据源的加载情况
+func newLoaders(groups []GroupConfig) (map[string]zkcache.Get, error) {
+	loaders := make(map[string]zkcache.Get, len(groups))
+	for _, g := range groups {
+		fn, err := newLoader(g.Loader)
+		if err != nil {
+			return nil, fmt.Errorf("groups.%s.loader: %v", g.Name, err)
+		}
+		if fn != nil {
+			loaders[g.Name] = zkcache.Get(loader.Instrument(g.Name, g.Loader.Type, fn))
+		}
+	}
+	return loaders, nil
+}
+
+func newLoader(cfg LoaderConfig) (loader.Func, error) {
+	timeout := time.Duration(cfg.Timeout)
+	switch cfg.Type {
+	case "static":
+		return loader.Static(cfg.Data), nil
+	case "http":
+		return loader.HTTP(cfg.URL, timeout, cfg.Headers)
+	case "sql":
+		// 连接在进程退出前一直保持
+		fn, _, err := loader.OpenSQL(cfg.Driver, cfg.DSN, cfg.Query, timeout)
+		return fn, err
+	case "file":
+		return loader.File(cfg.Path)
+	}
+	return nil, nil
+}
+
+// 可以在运行中修改的全局配置
+func applyGlobal(cfg *Config) {
+	level, _ := logrus.ParseLevel(cfg.LogLevel)
+	zklog.Logger.SetLevel(level)
+	zkcache.SetMemoryBudget(cfg.MemoryBudget)
+	service.DrainTimeout = time.Duration(cfg.Drain.Timeout)
+	service.DrainHotKeys = cfg.Drain.HotKeys
+}
+
+// 可以在运行中修改的分组配置, old为nil表示首次应用
+func applyGroup(c *zkcache.Controller, g GroupConfig, old *GroupConfig) {
+	if old != nil && old.Size != g.Size {
+		c.SetMaxSize(g.Size)
+	}
+	c.SetDefaultTTL(time.Duration(g.TTL))
+	c.SetMaxEntrySize(g.MaxEntrySize)
+	// 准入策略变化时才重建, 避免丢失已有的访问频率
+	if old == nil || old.Policy != g.Policy {
+		var admission lru.Admission
+		if g.Policy == "tinylfu" {
+			admission = lru.NewTinyLFU(expectedEntries(g.Size))
+		}
+		c.SetAdmission(admission)
+	}
+}
+
+// 按平均每条256字节估算缓存条数
+func expectedEntries(size int) int {
+	if n := size / 256; n > 1024 {
+		return n
+	}
+	return 1024
+}
+
+func reloadOnSighup(path string, cfg *Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := load(path)
+		if err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"msg": "重新加载配置失败, 继续使用当前配置",
+				"err": err.Error(),
+			}).Error()
+			continue
+		}
+		if changed := next.restartRequired(cfg); len(changed) > 0 {
+			zklog.Logger.WithFields(logrus.Fields{
+				"msg":    "以下配置需要重启才能生效, 已忽略",
+				"fields": strings.Join(changed, ","),
+			}).Warn()
+		}
+		applyGlobal(next)
+		old := make(map[string]GroupConfig, len(cfg.Groups))
+		for _, g := range cfg.Groups {
+			old[g.Name] = g
+		}
+		for _, g := range next.Groups {
+			o, ok := old[g.Name]
+			c, exist := zkcache.GetController(g.Name)
+			if !ok || !exist {
+				continue
+			}
+			applyGroup(c, g, &o)
+		}
+		// 需要重启的配置保持不变, 下次比较仍以启动时的为准
+		next.Listen, next.Registry, next.Service = cfg.Listen, cfg.Registry, cfg.Service
+		next.PeerTransport, next.RespAddr, next.MemcacheAddr = cfg.PeerTransport, cfg.RespAddr, cfg.MemcacheAddr
+		next.Groups = mergeGroups(cfg.Groups, next.Groups)
+		cfg = next
+		zklog.Logger.WithFields(logrus.Fields{
+			"msg":    "配置已重新加载",
+			"config": path,
+		}).Info()
+	}
+}
+
+// 保留启动时的分组及其不可修改的配置, 其余使用新配置
+func mergeGroups(current []GroupConfig, next []GroupConfig) []GroupConfig {
+	updated := make(map[string]GroupConfig, len(next))
+	for _, g := range next {
+		updated[g.Name] = g
+	}
+	groups := make([]GroupConfig, len(current))
+	for i, g := range current {
+		if n, ok := updated[g.Name]; ok {
+			n.Replicas, n.Loader = g.Replicas, g.Loader
+			g = n
+		}
+		groups[i] = g
+	}
+	return groups
+}
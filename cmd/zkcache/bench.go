@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zkCache/client"
+)
+
+type benchReport struct {
+	Ops       int64         `json:"ops"`
+	Reads     int64         `json:"reads"`
+	Writes    int64         `json:"writes"`
+	Misses    int64         `json:"misses"`
+	Errors    int64         `json:"errors"`
+	Elapsed   time.Duration `json:"elapsed"`
+	OpsPerSec float64       `json:"opsPerSec"`
+	P50       time.Duration `json:"p50"`
+	P99       time.Duration `json:"p99"`
+	Max       time.Duration `json:"max"`
+}
+
+// 压测: c个并发共执行n次操作, 按reads的比例随机读写keys个key
+func runBench(a *app, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int64("n", 10000, "total operations")
+	c := fs.Int("c", 16, "concurrency")
+	keys := fs.Int("keys", 1000, "key space size")
+	size := fs.Int("size", 64, "value size in bytes")
+	reads := fs.Float64("reads", 0.8, "ratio of reads")
+	prefix := fs.String("prefix", "bench:", "key prefix")
+	if _, err := parseArgs(fs, args, 0, commands["bench"].usage); err != nil {
+		return err
+	}
+	if *n <= 0 || *c <= 0 || *keys <= 0 {
+		return fmt.Errorf("n, c and keys must be positive")
+	}
+	cc, err := a.cacheClient()
+	if err != nil {
+		return err
+	}
+	value := strings.Repeat("x", *size)
+
+	var next, readOps, writeOps, misses, errs int64
+	latencies := make([][]time.Duration, *c)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *c; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+			for atomic.AddInt64(&next, 1) <= *n {
+				key := *prefix + strconv.Itoa(r.Intn(*keys))
+				ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+				begin := time.Now()
+				var err error
+				if r.Float64() < *reads {
+					atomic.AddInt64(&readOps, 1)
+					_, err = cc.Get(ctx, key)
+					if errors.Is(err, client.ErrNotFound) {
+						atomic.AddInt64(&misses, 1)
+						err = nil
+					}
+				} else {
+					atomic.AddInt64(&writeOps, 1)
+					err = cc.Set(ctx, key, value, 0)
+				}
+				latencies[w] = append(latencies[w], time.Since(begin))
+				cancel()
+				if err != nil {
+					atomic.AddInt64(&errs, 1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	all := make([]time.Duration, 0, *n)
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	report := benchReport{
+		Ops:       int64(len(all)),
+		Reads:     readOps,
+		Writes:    writeOps,
+		Misses:    misses,
+		Errors:    errs,
+		Elapsed:   elapsed,
+		OpsPerSec: float64(len(all)) / elapsed.Seconds(),
+		P50:       percentile(all, 0.50),
+		P99:       percentile(all, 0.99),
+		Max:       percentile(all, 1),
+	}
+	return a.print(report, []string{"OPS", "READS", "WRITES", "MISSES", "ERRORS", "ELAPSED", "OPS/S", "P50", "P99", "MAX"},
+		[][]string{{
+			strconv.FormatInt(report.Ops, 10), strconv.FormatInt(report.Reads, 10), strconv.FormatInt(report.Writes, 10),
+			strconv.FormatInt(report.Misses, 10), strconv.FormatInt(report.Errors, 10),
+			report.Elapsed.Round(time.Millisecond).String(), fmt.Sprintf("%.0f", report.OpsPerSec),
+			report.P50.String(), report.P99.String(), report.Max.String(),
+		}})
+}
+
+// 已排序的延迟中第p分位的值
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	zkcache "zkCache"
+	"zkCache/client"
+	"zkCache/consistenthash"
+)
+
+func runGet(a *app, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("get", flag.ExitOnError), args, 1, commands["get"].usage)
+	if err != nil {
+		return err
+	}
+	c, err := a.cacheClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	value, err := c.Get(ctx, args[0])
+	found := err == nil
+	if errors.Is(err, client.ErrNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]interface{}{"key": args[0], "value": value, "found": found},
+		[]string{"KEY", "VALUE", "FOUND"}, [][]string{{args[0], value, strconv.FormatBool(found)}})
+}
+
+func runSet(a *app, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 0, "expire after ttl, 0 means never")
+	args, err := parseArgs(fs, args, 2, commands["set"].usage)
+	if err != nil {
+		return err
+	}
+	c, err := a.cacheClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	if err := c.Set(ctx, args[0], args[1], *ttl); err != nil {
+		return err
+	}
+	return a.print(map[string]interface{}{"key": args[0], "ttl": ttl.String()},
+		[]string{"KEY", "TTL"}, [][]string{{args[0], ttl.String()}})
+}
+
+func runDel(a *app, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("del", flag.ExitOnError), args, 1, commands["del"].usage)
+	if err != nil {
+		return err
+	}
+	c, err := a.cacheClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	existed, err := c.Delete(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]interface{}{"key": args[0], "existed": existed},
+		[]string{"KEY", "EXISTED"}, [][]string{{args[0], strconv.FormatBool(existed)}})
+}
+
+// 任意节点的 /scan 都会扫描整个集群
+func runScan(a *app, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "key prefix")
+	limit := fs.Int("limit", 100, "keys per page")
+	cursor := fs.String("cursor", "", "cursor returned by the previous page")
+	all := fs.Bool("all", false, "follow cursor until the end")
+	if _, err := parseArgs(fs, args, 0, commands["scan"].usage); err != nil {
+		return err
+	}
+	nodes, err := a.nodes()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0)
+	next := *cursor
+	for {
+		page := zkcache.ScanResp{}
+		u := fmt.Sprintf("%s/scan?prefix=%s&cursor=%s&limit=%d", nodes[0],
+			url.QueryEscape(*prefix), url.QueryEscape(next), *limit)
+		if err := a.request(http.MethodGet, u, &page); err != nil {
+			return err
+		}
+		keys = append(keys, page.Keys...)
+		next = page.Cursor
+		if !*all || next == "" {
+			break
+		}
+	}
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []string{key})
+	}
+	if next != "" && a.output == "table" {
+		rows = append(rows, []string{"(cursor: " + next + ")"})
+	}
+	return a.print(zkcache.ScanResp{Keys: keys, Cursor: next}, []string{"KEY"}, rows)
+}
+
+type member struct {
+	Node string `json:"node"`
+	// 在hash环上的顺序
+	Position int     `json:"position"`
+	Share    float64 `json:"share"`
+	Healthy  bool    `json:"healthy"`
+}
+
+func runMembers(a *app, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("members", flag.ExitOnError), args, 0, commands["members"].usage); err != nil {
+		return err
+	}
+	nodes, err := a.nodes()
+	if err != nil {
+		return err
+	}
+	// 与服务端NodePool使用相同的虚拟节点数
+	ring := consistenthash.New(100, nil)
+	ring.Set(nodes...)
+	shares := ring.Shares()
+	members := make([]member, 0, len(nodes))
+	rows := make([][]string, 0, len(nodes))
+	for i, node := range ring.GetUrlsSortByKey() {
+		m := member{Node: node, Position: i, Share: shares[node], Healthy: a.request(http.MethodGet, node+"/healthy", nil) == nil}
+		members = append(members, m)
+		rows = append(rows, []string{strconv.Itoa(m.Position), m.Node, fmt.Sprintf("%.1f%%", m.Share*100), strconv.FormatBool(m.Healthy)})
+	}
+	return a.print(members, []string{"POSITION", "NODE", "SHARE", "HEALTHY"}, rows)
+}
+
+func runLocate(a *app, args []string) error {
+	fs := flag.NewFlagSet("locate", flag.ExitOnError)
+	replicas := fs.Int("replicas", 2, "replica count including owner")
+	args, err := parseArgs(fs, args, 1, commands["locate"].usage)
+	if err != nil {
+		return err
+	}
+	a.cfg.Retries = *replicas - 1
+	if a.cfg.Retries == 0 {
+		a.cfg.Retries = -1
+	}
+	c, err := a.cacheClient()
+	if err != nil {
+		return err
+	}
+	nodes := c.Locate(args[0])
+	rows := make([][]string, 0, len(nodes))
+	for i, node := range nodes {
+		role := "replica"
+		if i == 0 {
+			role = "owner"
+		}
+		rows = append(rows, []string{args[0], role, node})
+	}
+	return a.print(map[string]interface{}{"key": args[0], "nodes": nodes}, []string{"KEY", "ROLE", "NODE"}, rows)
+}
+
+type nodeStats struct {
+	Node  string         `json:"node"`
+	Stats *zkcache.Stats `json:"stats,omitempty"`
+	Err   string         `json:"error,omitempty"`
+}
+
+func runStats(a *app, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("stats", flag.ExitOnError), args, 0, commands["stats"].usage); err != nil {
+		return err
+	}
+	nodes, err := a.nodes()
+	if err != nil {
+		return err
+	}
+	sort.Strings(nodes)
+	res := make([]nodeStats, 0, len(nodes))
+	rows := make([][]string, 0, len(nodes))
+	for _, node := range nodes {
+		s := nodeStats{Node: node}
+		stats := zkcache.Stats{}
+		if err := a.request(http.MethodGet, node+"/stats", &stats); err != nil {
+			s.Err = err.Error()
+			rows = append(rows, []string{node, "-", "-", "-", "-", "-", "-", "-"})
+		} else {
+			s.Stats = &stats
+			hitRate := "-"
+			if total := stats.Hits + stats.HotHits + stats.Misses; total > 0 {
+				hitRate = fmt.Sprintf("%.1f%%", float64(stats.Hits+stats.HotHits)*100/float64(total))
+			}
+			rows = append(rows, []string{node, stats.Name, strconv.Itoa(stats.Entries), strconv.FormatInt(stats.Bytes, 10),
+				strconv.FormatInt(stats.Hits+stats.HotHits, 10), strconv.FormatInt(stats.Misses, 10), hitRate,
+				strconv.FormatInt(stats.Evictions, 10)})
+		}
+		res = append(res, s)
+	}
+	return a.print(res, []string{"NODE", "GROUP", "ENTRIES", "BYTES", "HITS", "MISSES", "HIT RATE", "EVICTIONS"}, rows)
+}
+
+// 让节点执行下线迁移, 节点从hash环中摘除后推送热点数据, 进程继续运行
+func runDrain(a *app, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("drain", flag.ExitOnError), args, 1, commands["drain"].usage)
+	if err != nil {
+		return err
+	}
+	node := strings.TrimSuffix(args[0], "/")
+	report := zkcache.DrainReport{}
+	// 迁移本身有超时, 这里不使用全局的请求超时
+	timeout := a.timeout
+	a.timeout = 0
+	err = a.request(http.MethodPost, node+"/drain", &report)
+	a.timeout = timeout
+	if err != nil {
+		return err
+	}
+	return a.print(report, []string{"NODE", "TOTAL", "SENT", "FAILED", "SKIPPED", "ELAPSED"}, [][]string{{
+		node, strconv.Itoa(report.Total), strconv.Itoa(report.Sent), strconv.Itoa(report.Failed),
+		strconv.Itoa(report.Skipped), report.Elapsed.Round(time.Millisecond).String(),
+	}})
+}
+
+func (a *app) nodes() ([]string, error) {
+	c, err := a.cacheClient()
+	if err != nil {
+		return nil, err
+	}
+	nodes := c.Nodes()
+	if len(nodes) == 0 {
+		return nil, client.ErrNoNodes
+	}
+	return nodes, nil
+}
@@ -0,0 +1,125 @@
+// zkcache: 集群运维命令行工具
+//
+//	zkcache [全局参数] <命令> [命令参数] [参数...]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"zkCache/client"
+	"zkCache/registry"
+)
+
+type command struct {
+	usage string
+	run   func(app *app, args []string) error
+}
+
+var commands map[string]command
+
+// 命令的处理函数中会引用usage, 在init中初始化以避免初始化循环
+func init() {
+	commands = map[string]command{
+		"get":     {"get <key>", runGet},
+		"set":     {"set [-ttl 1m] <key> <value>", runSet},
+		"del":     {"del <key>", runDel},
+		"scan":    {"scan [-prefix p] [-limit n] [-cursor c] [-all]", runScan},
+		"members": {"members  注册中心中的节点及其在hash环上的占比", runMembers},
+		"locate":  {"locate [-replicas n] <key>  key的归属节点及副本节点", runLocate},
+		"stats":   {"stats  各节点的运行统计", runStats},
+		"drain":   {"drain <node>  节点下线迁移", runDrain},
+		"prewarm": {"prewarm [-file keys.txt] [-c 8] [-rate 0] [-batch 1000] [key...]  通过数据源预热key", runPrewarm},
+		"seed":    {"seed -file data.txt|data.json [-ttl 0] [-c 8] [-rate 0] [-batch 1000]  直接写入key/value", runSeed},
+		"bench":   {"bench [-n 10000] [-c 16] [-keys 1000] [-size 64] [-reads 0.8]  压测", runBench},
+	}
+}
+
+type app struct {
+	cfg     client.Config
+	output  string
+	timeout time.Duration
+	client  *client.Client
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: zkcache [flags] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range []string{"get", "set", "del", "scan", "members", "locate", "stats", "drain", "prewarm", "seed", "bench"} {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+}
+
+func main() {
+	a := &app{}
+	var nodes, service string
+	flag.StringVar(&a.cfg.Registry, "registry", registry.ServiceURL, "registry url")
+	flag.StringVar(&service, "service", "cache", "service name in registry")
+	flag.StringVar(&nodes, "nodes", "", "comma separated node urls, skip registry when set")
+	flag.StringVar(&a.cfg.Group, "group", "", "cache group, empty for the node's default group")
+	flag.StringVar(&a.output, "o", "table", "output format: table or json")
+	flag.DurationVar(&a.timeout, "timeout", 2*time.Second, "request timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	a.cfg.ServiceName = registry.ServiceName(service)
+	a.cfg.Timeout = a.timeout
+	if nodes != "" {
+		a.cfg.Nodes = strings.Split(nodes, ",")
+	}
+	if a.output != "table" && a.output != "json" {
+		fmt.Fprintln(os.Stderr, "unknown output format:", a.output)
+		os.Exit(2)
+	}
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", args[0])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(a, args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	if a.client != nil {
+		a.client.Close()
+	}
+}
+
+// 按需创建客户端, 同一次执行只创建一次
+func (a *app) cacheClient() (*client.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+	c, err := client.New(a.cfg)
+	if err != nil {
+		return nil, err
+	}
+	a.client = c
+	return c, nil
+}
+
+func (a *app) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), a.timeout)
+}
+
+// 解析命令参数, 位置参数个数不符时返回错误
+func parseArgs(fs *flag.FlagSet, args []string, n int, usage string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		return nil, fmt.Errorf("usage: zkcache %s", usage)
+	}
+	return fs.Args(), nil
+}
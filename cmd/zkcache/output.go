@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"zkCache/pkg/response"
+)
+
+// 按 -o 输出: json 直接输出v, table 输出header和rows
+func (a *app) print(v interface{}, header []string, rows [][]string) error {
+	if a.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// {"code":200,"data":...,"msg":"success"}
+type envelope struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 请求节点或注册中心的HTTP接口, 解析响应中的data
+func (a *app) request(method string, url string, data interface{}) error {
+	return a.send(method, url, nil, data)
+}
+
+// 同request, body非nil时以JSON发送
+func (a *app) send(method string, url string, body interface{}, data interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := (&http.Client{Timeout: a.timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	env := envelope{}
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		return fmt.Errorf("%s returned: %v", url, res.Status)
+	}
+	if env.Code != response.SUCCESS {
+		return fmt.Errorf("%s returned %d: %s", url, env.Code, env.Msg)
+	}
+	if data != nil && len(env.Data) > 0 {
+		return json.Unmarshal(env.Data, data)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	zkcache "zkCache"
+	"zkCache/loader"
+)
+
+// 报告中最多输出的失败条数
+const maxFailures = 100
+
+type prewarmFlags struct {
+	concurrency int
+	rate        int
+	batch       int
+	ttl         time.Duration
+}
+
+func (f *prewarmFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.concurrency, "c", 8, "keys processed concurrently by the node")
+	fs.IntVar(&f.rate, "rate", 0, "max keys per second, 0 means unlimited")
+	fs.IntVar(&f.batch, "batch", 1000, "keys sent per request")
+}
+
+// 通过数据源预热key, key来自参数或文件(每行一个, - 表示标准输入)
+func runPrewarm(a *app, args []string) error {
+	fs := flag.NewFlagSet("prewarm", flag.ExitOnError)
+	f := &prewarmFlags{}
+	f.register(fs)
+	file := fs.String("file", "", "file with one key per line, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keys := fs.Args()
+	if *file != "" {
+		fromFile, err := readKeys(*file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, fromFile...)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("usage: zkcache %s", commands["prewarm"].usage)
+	}
+	report, err := a.prewarm("prewarm", keys, f, func(batch []string) interface{} {
+		return map[string]interface{}{"keys": batch}
+	})
+	if err != nil {
+		return err
+	}
+	return a.printPrewarm(report)
+}
+
+// 直接写入文件中的key/value, 格式同file数据源: key=value 每行一条, 或 .json 对象
+func runSeed(a *app, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	f := &prewarmFlags{}
+	f.register(fs)
+	fs.DurationVar(&f.ttl, "ttl", 0, "expire after ttl, 0 means the group's default ttl")
+	file := fs.String("file", "", "key/value file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: zkcache %s", commands["seed"].usage)
+	}
+	entries, err := loader.ReadKV(*file)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	report, err := a.prewarm("seed", keys, f, func(batch []string) interface{} {
+		m := make(map[string]string, len(batch))
+		for _, key := range batch {
+			m[key] = entries[key]
+		}
+		return map[string]interface{}{"entries": m}
+	})
+	if err != nil {
+		return err
+	}
+	return a.printPrewarm(report)
+}
+
+func readKeys(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// 分批发给任一节点, 由节点把每个key交给归属节点; 每批完成后在标准错误输出进度
+func (a *app) prewarm(op string, keys []string, f *prewarmFlags, body func(batch []string) interface{}) (zkcache.PrewarmReport, error) {
+	total := zkcache.PrewarmReport{}
+	nodes, err := a.nodes()
+	if err != nil {
+		return total, err
+	}
+	query := url.Values{}
+	query.Set("concurrency", strconv.Itoa(f.concurrency))
+	query.Set("rate", strconv.Itoa(f.rate))
+	if a.cfg.Group != "" {
+		query.Set("group", a.cfg.Group)
+	}
+	if f.ttl > 0 {
+		query.Set("ttl", f.ttl.String())
+	}
+	batchSize := f.batch
+	if batchSize <= 0 {
+		batchSize = len(keys)
+	}
+	// 每批的耗时取决于数据源, 不使用全局的请求超时
+	timeout := a.timeout
+	a.timeout = 0
+	defer func() { a.timeout = timeout }()
+	start := time.Now()
+	for i := 0; i < len(keys); i += batchSize {
+		end := i + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		report := zkcache.PrewarmReport{}
+		// 节点不可用时换下一个节点, 预热和写入都可以重复执行
+		for _, node := range nodes {
+			path := strings.TrimSuffix(node, "/") + "/" + op + "?" + query.Encode()
+			if err = a.send(http.MethodPost, path, body(keys[i:end]), &report); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return total, err
+		}
+		mergeReport(&total, report)
+		total.Elapsed = time.Since(start)
+		fmt.Fprintf(os.Stderr, "%s: %d/%d loaded=%d cached=%d seeded=%d failed=%d\n",
+			op, end, len(keys), total.Loaded, total.Cached, total.Seeded, total.Failed)
+	}
+	return total, nil
+}
+
+func mergeReport(total *zkcache.PrewarmReport, r zkcache.PrewarmReport) {
+	total.Total += r.Total
+	total.Loaded += r.Loaded
+	total.Cached += r.Cached
+	total.Seeded += r.Seeded
+	total.Failed += r.Failed
+	total.Skipped += r.Skipped
+	for _, f := range r.Failures {
+		if len(total.Failures) < maxFailures {
+			total.Failures = append(total.Failures, f)
+		}
+	}
+}
+
+func (a *app) printPrewarm(r zkcache.PrewarmReport) error {
+	if a.output == "table" {
+		for _, f := range r.Failures {
+			fmt.Fprintf(os.Stderr, "failed: %s: %s\n", f.Key, f.Err)
+		}
+	}
+	return a.print(r, []string{"TOTAL", "LOADED", "CACHED", "SEEDED", "FAILED", "SKIPPED", "ELAPSED"}, [][]string{{
+		strconv.Itoa(r.Total), strconv.Itoa(r.Loaded), strconv.Itoa(r.Cached), strconv.Itoa(r.Seeded),
+		strconv.Itoa(r.Failed), strconv.Itoa(r.Skipped), r.Elapsed.Round(time.Millisecond).String(),
+	}})
+}
@@ -44,7 +44,7 @@ func New(count int, hash Hash) *Map {
 // 根据环的顺时针来选择命中的节点。
 func (m *Map) Get(key string) string {
 	m.mu.RLock()
-	defer m.mu.Unlock()
+	defer m.mu.RUnlock()
 	if len(m.keys) == 0 {
 		return ""
 	}
@@ -55,6 +55,29 @@ func (m *Map) Get(key string) string {
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
 
+// 从key在环上的位置开始顺时针选择至多n个不同的真实节点, 第一个即为Get的结果
+func (m *Map) GetN(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := int64(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	urls := make([]string, 0, n)
+	set := make(map[string]struct{}, n)
+	for i := 0; i < len(m.keys) && len(urls) < n; i++ {
+		url := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if _, ok := set[url]; !ok {
+			urls = append(urls, url)
+			set[url] = struct{}{}
+		}
+	}
+	return urls
+}
+
 func (m *Map) Set(urls ...string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -85,7 +108,7 @@ func (m *Map) existLocation(i int64) bool {
 
 func (m *Map) RemoveNodeByUrl(targetUrl string) {
 	m.mu.Lock()
-	m.mu.Unlock()
+	defer m.mu.Unlock()
 	var nums []int64
 	for i, url := range m.hashMap {
 		if url == targetUrl {
@@ -117,3 +140,35 @@ func (m *Map) GetUrlsSortByKey() []string {
 	}
 	return urls
 }
+
+// 每个真实节点在hash环上负责的区间占比, 合计为1
+func (m *Map) Shares() map[string]float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	shares := make(map[string]float64)
+	if len(m.keys) == 0 {
+		return shares
+	}
+	// key的hash值范围为[0, 2^32)
+	const space = float64(math.MaxUint32) + 1
+	clip := func(x int64) float64 {
+		if x < 0 {
+			return 0
+		}
+		if x > math.MaxUint32 {
+			return space
+		}
+		return float64(x) + 1
+	}
+	// 每个虚拟节点负责 (上一个虚拟节点, 自身] 的区间, 超出最后一个虚拟节点的部分绕回第一个
+	prev := int64(-1)
+	for _, key := range m.keys {
+		shares[m.hashMap[key]] += clip(key) - clip(prev)
+		prev = key
+	}
+	shares[m.hashMap[m.keys[0]]] += space - clip(prev)
+	for url := range shares {
+		shares[url] /= space
+	}
+	return shares
+}
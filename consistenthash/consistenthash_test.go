@@ -24,3 +24,36 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestGetN(t *testing.T) {
+	m := New(5, nil)
+	m.Set("a", "b", "c")
+	for _, key := range []string{"1", "11", "24", "38"} {
+		urls := m.GetN(key, 2)
+		if len(urls) != 2 || urls[0] != m.Get(key) || urls[0] == urls[1] {
+			t.Fatal("check GetN", key, urls)
+		}
+		if all := m.GetN(key, 5); len(all) != 3 {
+			t.Fatal("check GetN more than nodes", key, all)
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	m := New(100, nil)
+	m.Set("a", "b", "c")
+	shares := m.Shares()
+	sum := 0.0
+	for _, url := range []string{"a", "b", "c"} {
+		if shares[url] <= 0 {
+			t.Fatal("check share", url, shares)
+		}
+		sum += shares[url]
+	}
+	if len(shares) != 3 || sum < 0.9999 || sum > 1.0001 {
+		t.Fatal("shares should sum to 1", shares)
+	}
+	if len(New(5, nil).Shares()) != 0 {
+		t.Fatal("empty ring")
+	}
+}
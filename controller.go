@@ -1,14 +1,20 @@
 package zkcache
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"zkCache/lease"
 	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/pubsub"
+	"zkCache/ratelimit"
 	"zkCache/registry"
 	"zkCache/singleflight"
+	"zkCache/writeback"
 	"zkCache/zklog"
 
 	"github.com/sirupsen/logrus"
@@ -21,7 +27,33 @@ type Controller struct {
 	cache    *synCache
 	nodePool *NodePool
 	loader   *singleflight.Group
+	// 副本数, 包含归属节点, 原子读写
+	replicas int64
+	// 默认过期时间 单位纳秒, 原子读写
+	defaultTTL int64
+	// 为DB加载的数据生成标签
+	tagFunc TagFunc
+	topics  *pubsub.Broker
+	changes *changeLog
+	// 由cache的锁保护
+	persist *persistence
+	// 写入同步到数据源, 由cache的锁保护
+	writer *writeback.Writer
+	// 开启写入同步时按key分段串行化归属节点上的写入
+	writeMu [64]sync.Mutex
+	stats   counters
+	// *hotCache, SetHotKeys时整体替换
+	hot     atomic.Value
+	limiter *ratelimit.Limiter
+	locks   *lease.Table
+	// 正在进行的数据迁移, 见Transfer
+	transferMu sync.Mutex
+	transfers  map[string]*transferSession
+	// 使用者设置的淘汰和拒绝写入回调
+	onEvicted  lru.OnEvictedFunc
+	onRejected lru.OnRejectedFunc
 
+	reqMu        sync.Mutex
 	reqRemoteMap map[Key][]int64
 }
 
@@ -33,6 +65,9 @@ var (
 
 type Get func(key string) (string, error)
 
+// 写入时取消key的过期时间; 以毫秒传给其他节点时仍为负数
+const NoExpire = -time.Millisecond
+
 func NewController(name string, maxSize int, get Get, onEvicted lru.OnEvictedFunc) *Controller {
 	mu.Lock()
 	defer mu.Unlock()
@@ -40,14 +75,25 @@ func NewController(name string, maxSize int, get Get, onEvicted lru.OnEvictedFun
 		panic("controller name exist")
 	}
 	c := &Controller{
-		name:     name,
-		get:      get,
-		nodePool: &NodePool{},
-		cache:    NewCache(maxSize, onEvicted),
-		loader:   &singleflight.Group{},
+		name:      name,
+		get:       get,
+		nodePool:  NewNodePool(""),
+		cache:     NewCache(maxSize, onEvicted),
+		loader:    &singleflight.Group{},
+		replicas:  1,
+		topics:    pubsub.New(TopicReplay),
+		changes:   newChangeLog(ChangeLogSize),
+		limiter:   ratelimit.New(),
+		locks:     lease.New(),
+		transfers: make(map[string]*transferSession),
 
+		onEvicted:    onEvicted,
 		reqRemoteMap: make(map[Key][]int64),
 	}
+	c.hot.Store(newHotCache(DefaultHotKeyConfig))
+	c.cache.lru.OnChange = c.onChange
+	c.cache.lru.OnEvicted = c.evicted
+	c.cache.lru.OnRejected = c.rejected
 	controller[name] = c
 	return c
 }
@@ -61,26 +107,95 @@ func GetController(name string) (*Controller, bool) {
 	return nil, false
 }
 
+// 已创建的全部Controller, 按名称排序
+func Controllers() []*Controller {
+	mu.Lock()
+	defer mu.Unlock()
+	list := make([]*Controller, 0, len(controller))
+	for _, c := range controller {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
 func (c *Controller) UpdateNodePool(nodes []string) {
-	c.nodePool.nodes = nodes
+	c.nodePool.mu.Lock()
+	self := c.nodePool.url
+	joined := !containsNode(c.nodePool.nodes, self) && containsNode(nodes, self)
+	c.nodePool.mu.Unlock()
+	c.nodePool.Set(nodes...)
+	// 新加入hash环, 从旧归属节点预热数据
+	if joined && len(nodes) > 1 {
+		go c.warmUp(self, nodes)
+	}
+}
+
+func containsNode(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Controller) SetSelfUrl(url string) {
+	c.nodePool.mu.Lock()
+	defer c.nodePool.mu.Unlock()
 	c.nodePool.url = url
 }
 
+// 设置副本数(包含归属节点), 数据会写入归属节点及其在hash环上的后继节点
+func (c *Controller) SetReplicas(n int) {
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreInt64(&c.replicas, int64(n))
+}
+
+func (c *Controller) Replicas() int {
+	return int(atomic.LoadInt64(&c.replicas))
+}
+
+// 设置默认过期时间, 作用于从DB加载以及未指定ttl的写入; 0表示不过期
+func (c *Controller) SetDefaultTTL(ttl time.Duration) {
+	atomic.StoreInt64(&c.defaultTTL, int64(ttl))
+}
+
+func (c *Controller) DefaultTTL() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.defaultTTL))
+}
+
+// 设置节点间通信方式, 使用gRPC时各节点需要同时提供gRPC服务
+func (c *Controller) SetPeerTransport(t Transport) {
+	c.nodePool.SetTransport(t)
+}
+
+func (c *Controller) Name() string {
+	return c.name
+}
+
 func (c *Controller) Get(key string, reqCode int64) ([]byte, error) {
 
 	if key == "" {
 		return nil, fmt.Errorf("key not exist")
 	}
+	hc := c.hotKeys()
+	hot := hc.detector.Record(key)
 	if v, ok := c.cache.get(key); ok {
+		atomic.AddInt64(&c.stats.hits, 1)
 		zklog.Logger.WithFields(logrus.Fields{
 			"key": key,
 			"msg": "hit...",
 		}).Debug()
 		return []byte(v), nil
 	}
+	if v, ok := hc.get(key); ok {
+		atomic.AddInt64(&c.stats.hotHits, 1)
+		return []byte(v), nil
+	}
+	atomic.AddInt64(&c.stats.misses, 1)
 	zklog.Logger.WithFields(logrus.Fields{
 		"key": key,
 		"msg": "not hit, call load() ...",
@@ -88,87 +203,253 @@ func (c *Controller) Get(key string, reqCode int64) ([]byte, error) {
 	val, err := c.load(key, reqCode)
 	if err != nil {
 		zklog.Logger.WithField("err", err).Warn()
+		return val, err
 	}
-	return val, err
+	c.keepHot(key, val, hot)
+	return val, nil
 }
 
 func (c *Controller) load(key string, reqCode int64) ([]byte, error) {
-	c.nodePool.mu.Lock()
 	code := reqCode
 	if code == 0 {
 		code = time.Now().UnixNano()
 	}
+	c.reqMu.Lock()
 	if recordCodeList, exist := c.reqRemoteMap[Key(key)]; exist {
 		for _, recordCode := range recordCodeList {
 			if recordCode == code {
-				c.nodePool.mu.Unlock()
+				c.reqMu.Unlock()
 				return nil, errors.New("二次环形访问...")
 			}
 		}
 	}
 	c.reqRemoteMap[Key(key)] = append(c.reqRemoteMap[Key(key)], code)
-	localNode := 0
-	for i := 0; i < len(c.nodePool.nodes); i++ {
-		if c.nodePool.url == c.nodePool.nodes[i] {
-			localNode = i
-			break
-		}
-	}
-	remoteNode := (localNode + 1) % len(c.nodePool.nodes)
-	for remoteNode != localNode {
-		zklog.Logger.WithFields(logrus.Fields{
-			"remoteNode_index":  remoteNode,
-			"localNode_index: ": localNode,
-		}).Debug()
-		remoteUrl := c.nodePool.nodes[remoteNode]
-		c.nodePool.mu.Unlock()
-		view, err := c.loader.Do(key, code, func() ([]byte, error) {
-			zklog.Logger.WithField("remoteUrl", remoteUrl).Debug()
-			if value, err := c.getFromPeer(remoteUrl, key, code); err != nil {
-				return nil, err
-			} else {
-				return value, nil
-			}
-		})
+	c.reqMu.Unlock()
 
-		if err != nil {
-			// 忽略错误 继续循环
-			zklog.Logger.WithFields(logrus.Fields{
-				"msg": "可能是节点突然挂了 || 或者是二次环形访问  ..... ",
-				"err": err.Error(),
-			}).Warn("Controller request to remote:")
-		} else {
-			value := ValueResp{}
-			json.Unmarshal(view, &value)
-			zklog.Logger.WithFields(logrus.Fields{
-				"data": value.Data,
-			}).Info()
-			c.cache.set(key, value.Data)
-			return []byte(value.Data), nil
-		}
-		c.nodePool.mu.Lock()
-		remoteNode = (remoteNode + 1) % len(c.nodePool.nodes)
-	}
-	// 如果所有节点都不存在->访问设定的DB
-	data, err := c.getLocalhost(key)
+	view, err := c.loader.Do(key, code, func() ([]byte, error) {
+		return c.loadFromReplicas(key, code)
+	})
 
 	// 移除http环形访问标志
+	c.reqMu.Lock()
 	for i, recordCode := range c.reqRemoteMap[Key(key)] {
 		if code == recordCode {
-			c.reqRemoteMap[Key(key)] = append(c.reqRemoteMap[Key(key)][:i], c.reqRemoteMap[Key(key)][i:]...)
+			c.reqRemoteMap[Key(key)] = append(c.reqRemoteMap[Key(key)][:i], c.reqRemoteMap[Key(key)][i+1:]...)
 			break
 		}
 	}
 	if len(c.reqRemoteMap[Key(key)]) == 0 {
 		delete(c.reqRemoteMap, Key(key))
 	}
+	c.reqMu.Unlock()
 
-	c.nodePool.mu.Unlock()
 	if err != nil {
 		zklog.Logger.WithField("err", err).Warn()
-		return nil, errors.New("can not find the value by key: " + key)
+		// 数据源返回的错误视为不存在, 带错误码的错误保留原错误码
+		code, ok := response.ErrCode(err)
+		if !ok {
+			code = response.NOT_FOUND
+		}
+		return nil, response.NewErrWithMsg(code, "can not find the value by key: "+key)
+	}
+	return view, nil
+}
+
+// 依次读取归属节点及其副本节点, 以版本最大的数据为准并修复落后的副本
+// 所有副本都不存在时, 由第一个可达的节点(正常情况下即归属节点)访问设定的DB并同步给其他副本
+func (c *Controller) loadFromReplicas(key string, code int64) ([]byte, error) {
+	self := c.nodePool.self()
+	nodes := c.nodePool.PickNodes(key, c.Replicas())
+	if len(nodes) == 0 {
+		// 尚未收到节点列表, 视为单节点
+		return c.getLocalhost(key, true)
+	}
+
+	owner := ""
+	var latest *lru.Entry
+	found := make(map[string]uint64)
+	reachable := make([]string, 0, len(nodes))
+	// 各副本中最大的删除版本, 不大于它的数据已被删除
+	deleted := c.cache.deleted(key)
+	for _, node := range nodes {
+		if node == self {
+			if owner == "" {
+				owner = self
+			}
+			continue
+		}
+		resp, err := c.nodePool.peek(node, c.name, key)
+		if err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"msg":  "可能是节点突然挂了 ..... ",
+				"node": node,
+				"err":  err.Error(),
+			}).Warn("Controller request to replica:")
+			continue
+		}
+		if owner == "" {
+			owner = node
+		}
+		reachable = append(reachable, node)
+		if resp.Deleted > deleted {
+			deleted = resp.Deleted
+		}
+		if e := resp.Entry; resp.Found {
+			found[node] = e.Version
+			if latest == nil || e.Version > latest.Version {
+				latest = &e
+			}
+		}
+	}
+
+	if latest != nil && latest.Version <= deleted {
+		// 删除未同步到的副本上的旧数据, 重新同步删除
+		for node, version := range found {
+			if version <= deleted {
+				go c.deleteOnPeer(node, key, deleted)
+			}
+		}
+		latest = nil
+	}
+	if latest != nil {
+		// 读修复
+		for _, node := range reachable {
+			if version, ok := found[node]; !ok || version < latest.Version {
+				go c.pushToPeer(node, *latest)
+			}
+		}
+		if containsNode(nodes, self) {
+			c.cache.merge(*latest)
+		}
+		zklog.Logger.WithFields(logrus.Fields{
+			"key":     key,
+			"version": latest.Version,
+		}).Debug("hit replica")
+		return []byte(latest.Value), nil
+	}
+
+	switch owner {
+	case self:
+		return c.getLocalhost(key, true)
+	case "":
+		// 所有副本都不可达, 直接访问DB但不缓存
+		return c.getLocalhost(key, false)
+	}
+	view, err := c.getFromPeer(owner, key, code)
+	if err != nil {
+		// 归属节点返回的业务错误(如数据不存在)不再访问DB, 只有归属节点不可达时才由本节点加载
+		if errCode, ok := response.ErrCode(err); ok {
+			return nil, response.NewErrWithMsg(errCode, fmt.Sprintf("owner %s: %v", owner, err))
+		}
+		zklog.Logger.WithFields(logrus.Fields{
+			"owner": owner,
+			"err":   err.Error(),
+		}).Warn("Controller request to owner:")
+		return c.getLocalhost(key, false)
+	}
+	return view, nil
+}
+
+// 写入key, 由归属节点执行并同步给副本; tags非空时替换key原有的标签
+func (c *Controller) Set(key string, value string, tags ...string) error {
+	return c.SetWithTTL(key, value, 0, tags...)
+}
+
+// 同Set, ttl>0 时设置过期时间, 小于0(NoExpire)时取消过期时间
+// 为0时使用默认过期时间, 未设置默认过期时间时保留key原有的过期时间
+func (c *Controller) SetWithTTL(key string, value string, ttl time.Duration, tags ...string) error {
+	if key == "" {
+		return fmt.Errorf("key not exist")
+	}
+	c.hotKeys().remove(key)
+	return c.onOwner(key, func() error {
+		_, err := c.SetLocalWithTTL(key, value, ttl, tags...)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "set", c.name, SetReq{
+			Key:   key,
+			Value: value,
+			Tags:  tags,
+			TTL:   ttl.Milliseconds(),
+		}, nil)
+	})
+}
+
+// 在key的归属节点上执行操作: 本节点为归属节点时调用local, 否则调用remote
+// 归属节点不可达时依次尝试副本节点, 业务错误直接返回
+func (c *Controller) onOwner(key string, local func() error, remote func(node string) error) error {
+	self := c.nodePool.self()
+	nodes := c.nodePool.PickNodes(key, c.Replicas())
+	if len(nodes) == 0 {
+		return local()
+	}
+	var err error
+	for _, node := range nodes {
+		if node == self {
+			return local()
+		}
+		if err = remote(node); err == nil {
+			return nil
+		}
+		if _, ok := response.ErrCode(err); ok {
+			return err
+		}
+		zklog.Logger.WithFields(logrus.Fields{
+			"node": node,
+			"key":  key,
+			"err":  err.Error(),
+		}).Warn("Controller request to replica:")
+	}
+	return err
+}
+
+// 在本节点写入并同步给其他副本, 返回新的版本号
+// 超过单条大小上限时返回 response.ENTRY_TOO_LARGE
+func (c *Controller) SetLocal(key string, value string, tags ...string) (uint64, error) {
+	return c.SetLocalWithTTL(key, value, 0, tags...)
+}
+
+// ttl为0时使用默认过期时间, 见 SetDefaultTTL; 开启写入同步时同时写入数据源, 见 EnableWriteback
+func (c *Controller) SetLocalWithTTL(key string, value string, ttl time.Duration, tags ...string) (uint64, error) {
+	if ttl == 0 {
+		ttl = c.DefaultTTL()
+	}
+	defer c.lockWrite(key)()
+	if err := c.writeThrough(key, value, false); err != nil {
+		return 0, err
+	}
+	e, err := c.cache.setWithTTL(key, value, ttl, tags...)
+	if err != nil {
+		return 0, err
+	}
+	c.writeBehind(key, value, false)
+	c.replicate(e)
+	return e.Version, nil
+}
+
+// 本节点缓存中的数据, 不会触发加载
+func (c *Controller) GetLocal(key string) (lru.Entry, bool) {
+	return c.cache.getWithVersion(key)
+}
+
+// 异步同步给除本节点外的其他副本
+func (c *Controller) replicate(e lru.Entry) {
+	self := c.nodePool.self()
+	for _, node := range c.nodePool.PickNodes(e.Key, c.Replicas()) {
+		if node != self {
+			go c.pushToPeer(node, e)
+		}
+	}
+}
+
+func (c *Controller) pushToPeer(node string, e lru.Entry) {
+	if err := c.nodePool.handoff(node, c.name, []lru.Entry{e}); err != nil {
+		zklog.Logger.WithFields(logrus.Fields{
+			"node": node,
+			"key":  e.Key,
+			"err":  err.Error(),
+		}).Warn("replicate failed")
 	}
-	return data, nil
 }
 
 // {"code":200,"data":"value","msg":"success"}
@@ -180,17 +461,20 @@ type ValueResp struct {
 
 // 向远程发起请求
 func (c *Controller) getFromPeer(baseUrl string, key string, code int64) ([]byte, error) {
-	if value, err := c.nodePool.Get(baseUrl, c.name, key, code); err != nil {
+	if value, err := c.nodePool.getValue(baseUrl, c.name, key, code); err != nil {
 		return nil, err
 	} else {
 		return value, nil
 	}
 }
 
-// 按照设定的规则->search DB
-func (c *Controller) getLocalhost(key string) ([]byte, error) {
+// 按照设定的规则->search DB, store为true时写入本地并同步给副本
+func (c *Controller) getLocalhost(key string, store bool) ([]byte, error) {
 	zklog.Logger.WithField("msg", "try to search [Data Source]").Debug()
-	value, err := c.get(key)
+	if c.get == nil {
+		return nil, response.NewErrWithMsg(response.ERROR, fmt.Sprintf("controller %s has no data source", c.name))
+	}
+	value, err := c.loadSource(key)
 	if err != nil {
 		zklog.Logger.WithFields(logrus.Fields{
 			"msg": "[Data Source] not hit........",
@@ -203,6 +487,15 @@ func (c *Controller) getLocalhost(key string) ([]byte, error) {
 		"msg": "[Data Source] hit........",
 		"key": key,
 	}).Debug()
-	c.cache.set(key, value)
+	if store {
+		var tags []string
+		if c.tagFunc != nil {
+			tags = c.tagFunc(key, value)
+		}
+		// 新加载的数据经过准入策略, 被拒绝时不缓存也不同步
+		if e, ok := c.cache.add(key, value, c.DefaultTTL(), tags...); ok {
+			c.replicate(e)
+		}
+	}
 	return []byte(value), nil
 }
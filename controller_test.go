@@ -29,37 +29,3 @@ var db = map[string]string{
 // 		t.Fatalf("never hit: %s", view)
 // 	}
 // }
-
-// func TestTopic(t *testing.T) {
-// 	stop := make(chan os.Signal, 1)
-// 	signal.Notify(stop, os.Interrupt)
-
-// 	go func() {
-
-// 		// addr := "http://localhost:9999"
-// 		// // topic
-// 		// topic := NewController("topic", 0, nil, nil)
-// 		// // subscribe
-// 		// subscribe := NewController("subscribe", 0, nil, nil)
-
-// 		// time.Sleep(4 * time.Second)
-// 		// topic.SetTopic("topicName")
-// 		// subscribe.Subscribe(addr, "topicName")
-// 		// subscribe.PublicTopicMsg("topicName", "msg")
-// 	}()
-
-// 	go func() {
-// 		addr := "http://localhost:9999"
-// 		// zkCache := NewController("test", 0, nil, nil)
-// 		nodePool := NewNodePool(addr)
-// 		// nodePool.Set(addr)
-// 		// zkCache.RegisterPeers(nodePool)
-// 		log.Println("zkCache is running at", addr)
-// 		log.Fatal(http.ListenAndServe(addr[7:], nodePool))
-// 	}()
-
-// 	select {
-// 	case <-stop:
-// 		return
-// 	}
-// }
@@ -0,0 +1,95 @@
+package zkcache
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/writeback"
+)
+
+type IncrReq struct {
+	Key   string `json:"key"`
+	Delta int64  `json:"delta"`
+	// 毫秒, 仅在key不存在时生效
+	TTL int64 `json:"ttl"`
+}
+
+// 在归属节点上原子地将key的值加上delta并返回结果
+// key不存在时从0开始, ttl>0 时为新建的key设置过期时间
+func (c *Controller) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key not exist")
+	}
+	var n int64
+	err := c.onOwner(key, func() (err error) {
+		n, err = c.IncrLocal(key, delta, ttl)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "incr", c.name, IncrReq{
+			Key:   key,
+			Delta: delta,
+			TTL:   ttl.Milliseconds(),
+		}, &n)
+	})
+	return n, err
+}
+
+// 同Incr, 将key的值减去delta
+func (c *Controller) Decr(key string, delta int64, ttl time.Duration) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, errOverflow(key)
+	}
+	return c.Incr(key, -delta, ttl)
+}
+
+// 开启写入同步时同Set写入数据源; write-through时先计算结果写入数据源, 成功后再写缓存
+func (c *Controller) IncrLocal(key string, delta int64, ttl time.Duration) (int64, error) {
+	defer c.lockWrite(key)()
+	if w := c.getWriter(); w != nil && w.Mode() == writeback.Through {
+		var n int64
+		if cur, ok := c.cache.getWithVersion(key); ok {
+			var err error
+			if n, err = parseCounter(key, cur.Value); err != nil {
+				return 0, err
+			}
+		}
+		next, err := addCounter(key, n, delta)
+		if err != nil {
+			return 0, err
+		}
+		if err := c.writeThrough(key, strconv.FormatInt(next, 10), false); err != nil {
+			return 0, err
+		}
+	}
+	e, err := c.cache.incr(key, delta, ttl)
+	if err != nil {
+		return 0, err
+	}
+	c.writeBehind(key, e.Value, false)
+	c.replicate(e)
+	return strconv.ParseInt(e.Value, 10, 64)
+}
+
+// 结果超出int64范围时返回错误, 与Redis一致不做回绕
+func addCounter(key string, n int64, delta int64) (int64, error) {
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, errOverflow(key)
+	}
+	return n + delta, nil
+}
+
+func errOverflow(key string) error {
+	return response.NewErrWithMsg(response.PARAMETER_ERROR,
+		fmt.Sprintf("increment or decrement of key: %s would overflow", key))
+}
+
+func parseCounter(key string, value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, response.NewErrWithMsg(response.PARAMETER_ERROR,
+			fmt.Sprintf("value of key: %s is not an integer", key))
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package zkcache
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"zkCache/pkg/response"
+)
+
+func TestIncr(t *testing.T) {
+	controllers, _ := newCluster(t, "incr", 3, 2)
+	key := "views"
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(c *Controller) {
+			defer wg.Done()
+			if _, err := c.Incr(key, 2, 0); err != nil {
+				t.Error(err)
+			}
+		}(controllers[i%len(controllers)])
+	}
+	wg.Wait()
+	if n, err := controllers[0].Decr(key, 10, 0); err != nil || n != 50 {
+		t.Fatal("check counter", n, err)
+	}
+
+	controllers[0].Set("name", "zk")
+	_, err := controllers[1].Incr("name", 1, 0)
+	if code, _ := response.ErrCode(err); code != response.PARAMETER_ERROR {
+		t.Fatal("value is not an integer", err)
+	}
+}
+
+func TestIncrTTL(t *testing.T) {
+	c := NewController("incr-ttl", 0, nil, nil)
+	if n, _ := c.Incr("rate", 1, 20*time.Millisecond); n != 1 {
+		t.Fatal("check counter", n)
+	}
+	if n, _ := c.Incr("rate", 1, time.Hour); n != 2 {
+		t.Fatal("check counter", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := c.Incr("rate", 1, 0); n != 1 {
+		t.Fatal("counter should be expired", n)
+	}
+}
+
+func TestIncrOverflow(t *testing.T) {
+	c := NewController("incr-overflow", 0, nil, nil)
+	c.Set("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := c.Incr("max", 1, 0); err == nil {
+		t.Fatal("incr should not overflow")
+	}
+	if v, _ := c.GetLocal("max"); v.Value != strconv.FormatInt(math.MaxInt64, 10) {
+		t.Fatal("value should not change on overflow", v)
+	}
+	if _, err := c.Decr("min", math.MinInt64, 0); err == nil {
+		t.Fatal("negating MinInt64 should overflow")
+	}
+	if n, err := c.Decr("min", math.MaxInt64, 0); err != nil || n != -math.MaxInt64 {
+		t.Fatal("check counter", n, err)
+	}
+	_, err := c.Decr("min", 2, 0)
+	if code, _ := response.ErrCode(err); code != response.PARAMETER_ERROR {
+		t.Fatal("decr should not overflow", err)
+	}
+}
@@ -0,0 +1,88 @@
+package zkcache
+
+import (
+	"fmt"
+	"zkCache/lru"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 删除key, 由归属节点执行并同步给副本, 返回删除前归属节点上是否存在
+func (c *Controller) Delete(key string) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("key not exist")
+	}
+	c.hotKeys().remove(key)
+	var exist bool
+	err := c.onOwner(key, func() (err error) {
+		exist, err = c.deleteOnOwner(DeleteReq{Key: key})
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "delete", c.name, DeleteReq{Key: key}, &exist)
+	})
+	return exist, err
+}
+
+// 归属节点上删除, 开启写入同步时同时从数据源删除
+func (c *Controller) deleteOnOwner(req DeleteReq) (bool, error) {
+	if req.Replica {
+		return c.DeleteLocal(req), nil
+	}
+	defer c.lockWrite(req.Key)()
+	if err := c.writeThrough(req.Key, "", true); err != nil {
+		return false, err
+	}
+	exist := c.DeleteLocal(req)
+	c.writeBehind(req.Key, "", true)
+	return exist, nil
+}
+
+// 在本节点删除并记录删除版本, 非副本请求时异步同步给其他副本
+// 同步失败的副本上的旧数据版本不大于删除版本, 不会被读修复写回
+func (c *Controller) DeleteLocal(req DeleteReq) bool {
+	c.hotKeys().remove(req.Key)
+	exist, version := c.cache.delete(req.Key, req.Version)
+	if exist {
+		c.publishSystemEvent(SystemEvent{Event: "delete", Key: req.Key})
+	}
+	if req.Replica {
+		return exist
+	}
+	self := c.nodePool.self()
+	for _, node := range c.nodePool.PickNodes(req.Key, c.Replicas()) {
+		if node != self {
+			go c.deleteOnPeer(node, req.Key, version)
+		}
+	}
+	return exist
+}
+
+func (c *Controller) deleteOnPeer(node string, key string, version uint64) {
+	err := c.nodePool.post(node, "delete", c.name, DeleteReq{Key: key, Replica: true, Version: version}, nil)
+	if err != nil {
+		zklog.Logger.WithFields(logrus.Fields{
+			"node": node,
+			"key":  key,
+			"err":  err.Error(),
+		}).Warn("replicate delete failed")
+	}
+}
+
+// 读取归属节点缓存中的数据, 不会触发加载
+func (c *Controller) Peek(key string) (lru.Entry, bool, error) {
+	if key == "" {
+		return lru.Entry{}, false, fmt.Errorf("key not exist")
+	}
+	var e lru.Entry
+	var found bool
+	err := c.onOwner(key, func() error {
+		e, found = c.GetLocal(key)
+		return nil
+	}, func(node string) error {
+		resp, err := c.nodePool.peek(node, c.name, key)
+		e, found = resp.Entry, resp.Found
+		return err
+	})
+	return e, found, err
+}
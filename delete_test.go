@@ -0,0 +1,91 @@
+package zkcache
+
+import (
+	"testing"
+	"time"
+	"zkCache/lru"
+)
+
+func TestDelete(t *testing.T) {
+	controllers, _ := newCluster(t, "delete", 3, 2)
+	controllers[0].Set("k", "v")
+	nodes := controllers[0].nodePool.PickNodes("k", 2)
+	waitFor(t, func() bool {
+		_, ok := byUrl(controllers, nodes[1]).GetLocal("k")
+		return ok
+	})
+	other := outsider(controllers, "k")
+	if exist, err := other.Delete("k"); err != nil || !exist {
+		t.Fatal("check delete", exist, err)
+	}
+	// 删除同步给副本
+	for _, node := range nodes {
+		c := byUrl(controllers, node)
+		waitFor(t, func() bool {
+			_, ok := c.GetLocal("k")
+			return !ok
+		})
+	}
+	if exist, err := other.Delete("k"); err != nil || exist {
+		t.Fatal("key should not exist", exist, err)
+	}
+}
+
+func TestSetWithTTLAndPeek(t *testing.T) {
+	controllers, _ := newCluster(t, "peek", 2, 1)
+	other := outsider(controllers, "k")
+	if _, found, err := other.Peek("k"); err != nil || found {
+		t.Fatal("key should not exist", found, err)
+	}
+	if err := other.SetWithTTL("k", "v", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	e, found, err := other.Peek("k")
+	if err != nil || !found || e.Value != "v" || e.Expire == 0 {
+		t.Fatal("check peek", e, found, err)
+	}
+	// 不带ttl时保留原有的过期时间
+	other.Set("k", "v2")
+	if e2, _, _ := other.Peek("k"); e2.Expire != e.Expire || e2.Value != "v2" {
+		t.Fatal("expire should be kept", e2)
+	}
+	if _, ok := other.GetLocal("k"); ok {
+		t.Fatal("peek should not load into non-owner")
+	}
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	controllers, _ := newCluster(t, "tombstone", 3, 2)
+	controllers[0].Set("k", "v")
+	nodes := controllers[0].nodePool.PickNodes("k", 2)
+	owner, replica := byUrl(controllers, nodes[0]), byUrl(controllers, nodes[1])
+	waitFor(t, func() bool {
+		_, ok := replica.GetLocal("k")
+		return ok
+	})
+	stale, _ := replica.GetLocal("k")
+	// 模拟同步给副本的删除失败
+	owner.cache.delete("k", 0)
+	other := outsider(controllers, "k")
+	if v, err := other.Get("k", 0); err == nil {
+		t.Fatal("deleted key should not be read from stale replica", string(v))
+	}
+	if _, ok := owner.GetLocal("k"); ok {
+		t.Fatal("read repair should not resurrect deleted key")
+	}
+	// 重新同步删除
+	waitFor(t, func() bool {
+		_, ok := replica.GetLocal("k")
+		return !ok
+	})
+	if replica.Handoff([]lru.Entry{stale}) != 0 || owner.Handoff([]lru.Entry{stale}) != 0 {
+		t.Fatal("old version should be rejected after delete")
+	}
+	// 删除之后的新写入不受影响
+	if err := other.Set("k", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := other.Get("k", 0); err != nil || string(v) != "v2" {
+		t.Fatal("check set after delete", string(v), err)
+	}
+}
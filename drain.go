@@ -0,0 +1,103 @@
+package zkcache
+
+import (
+	"context"
+	"time"
+	"zkCache/consistenthash"
+	"zkCache/lru"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 下线迁移时每次推送给同一节点的条数
+const drainBatchSize = 100
+
+// 下线迁移进度
+type DrainReport struct {
+	// 需要迁移的热点数据条数
+	Total int `json:"total"`
+	// 已成功交给新归属节点的条数
+	Sent int `json:"sent"`
+	// 推送失败的条数
+	Failed int `json:"failed"`
+	// 没有可接收节点或超时未处理的条数
+	Skipped int           `json:"skipped"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// 将最热的limit条数据推送给本节点下线后的归属节点, limit<=0 表示全部
+// progress 每推送完一批调用一次, 可为nil; ctx 结束时停止推送并返回当前进度
+func (c *Controller) Drain(ctx context.Context, limit int, progress func(DrainReport)) DrainReport {
+	start := time.Now()
+	entries := c.cache.hottest(limit)
+	report := DrainReport{Total: len(entries)}
+	peers := c.nodePool.peers()
+	if len(peers) == 0 {
+		report.Skipped = report.Total
+		report.Elapsed = time.Since(start)
+		return report
+	}
+
+	// 本节点离开后的hash环
+	ring := consistenthash.New(defaultVirtualNodeCount, nil)
+	ring.Set(peers...)
+	owners := make([]string, 0)
+	batches := make(map[string][]lru.Entry)
+	for _, e := range entries {
+		owner := ring.Get(e.Key)
+		if _, ok := batches[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		batches[owner] = append(batches[owner], e)
+	}
+
+	for _, owner := range owners {
+		batch := batches[owner]
+		for len(batch) > 0 {
+			select {
+			case <-ctx.Done():
+				report.Skipped = report.Total - report.Sent - report.Failed
+				report.Elapsed = time.Since(start)
+				zklog.Logger.WithFields(logrus.Fields{
+					"controller": c.name,
+					"sent":       report.Sent,
+					"skipped":    report.Skipped,
+				}).Warn("drain timeout")
+				return report
+			default:
+			}
+			n := drainBatchSize
+			if n > len(batch) {
+				n = len(batch)
+			}
+			if err := c.nodePool.handoff(owner, c.name, batch[:n]); err != nil {
+				zklog.Logger.WithFields(logrus.Fields{
+					"owner": owner,
+					"err":   err,
+				}).Warn("drain handoff failed")
+				report.Failed += n
+			} else {
+				report.Sent += n
+			}
+			batch = batch[n:]
+			report.Elapsed = time.Since(start)
+			if progress != nil {
+				progress(report)
+			}
+		}
+	}
+	report.Elapsed = time.Since(start)
+	return report
+}
+
+// 接收其他节点推送过来的数据(下线迁移、预热、副本同步), 仅当本地不存在或版本更旧时写入
+func (c *Controller) Handoff(entries []lru.Entry) int {
+	accepted := 0
+	for _, e := range entries {
+		if c.cache.merge(e) {
+			accepted++
+		}
+	}
+	return accepted
+}
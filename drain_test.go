@@ -0,0 +1,53 @@
+package zkcache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDrain(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]string)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := HandoffReq{}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, e := range req.Entries {
+			received[e.Key] = e.Value
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"code":200,"msg":"success","data":null}`))
+	}))
+	defer peer.Close()
+
+	c := NewController("drain", 0, nil, nil)
+	c.SetSelfUrl("http://localhost:1")
+	c.UpdateNodePool([]string{"http://localhost:1", peer.URL})
+	for k, v := range db {
+		c.cache.set(k, v)
+	}
+
+	report := c.Drain(context.Background(), 2, nil)
+	if report.Total != 2 || report.Sent != 2 || len(received) != 2 {
+		t.Fatal("check drain report", report, received)
+	}
+	for k, v := range received {
+		if db[k] != v {
+			t.Fatalf("handoff value error, key: %s", k)
+		}
+	}
+}
+
+func TestDrainWithoutPeers(t *testing.T) {
+	c := NewController("drain-alone", 0, nil, nil)
+	c.SetSelfUrl("http://localhost:1")
+	c.UpdateNodePool([]string{"http://localhost:1"})
+	c.cache.set("k", "v")
+	if report := c.Drain(context.Background(), 0, nil); report.Skipped != 1 {
+		t.Fatal("check drain report", report)
+	}
+}
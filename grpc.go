@@ -0,0 +1,213 @@
+package zkcache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/rpc"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Watch每次从变更流读取的事件数
+const watchBatch = 100
+
+// 本节点的gRPC服务(定义见 rpc/zkcache.proto), 请求中的group为空时使用controller, 未注册时返回PARAMETER_ERROR
+// 同时注册服务反射, grpcurl等工具无需.proto文件即可调用
+func NewGRPCServer(controller *Controller, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	rpc.RegisterCacheServer(s, &grpcServer{controller: controller, group: SelectController})
+	reflection.Register(s)
+	return s
+}
+
+// gRPC与HTTP共用端口: 明文HTTP/2且content-type为application/grpc的请求交给gRPC服务, 其余交给handler
+func GRPCHandler(s *grpc.Server, handler http.Handler) http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+type grpcServer struct {
+	rpc.UnimplementedCacheServer
+	controller *Controller
+	// 按请求中的group选择Controller
+	group func(group string, def *Controller) (*Controller, error)
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *rpc.GetRequest) (*rpc.GetResponse, error) {
+	if req.Key == "" {
+		return nil, rpc.Error(ctx, response.NewErr(response.PARAMETER_ERROR))
+	}
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	value, err := c.Get(req.Key, req.Code)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	return &rpc.GetResponse{Value: string(value)}, nil
+}
+
+func (s *grpcServer) GetMany(ctx context.Context, req *rpc.GetManyRequest) (*rpc.GetManyResponse, error) {
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	items := make([]*rpc.Item, len(req.Keys))
+	for i, key := range req.Keys {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		items[i] = &rpc.Item{Key: key}
+		if value, err := c.Get(key, req.Code); err == nil {
+			items[i].Value, items[i].Found = string(value), true
+		}
+	}
+	return &rpc.GetManyResponse{Items: items}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, req *rpc.SetRequest) (*rpc.SetResponse, error) {
+	if req.Key == "" {
+		return nil, rpc.Error(ctx, response.NewErr(response.PARAMETER_ERROR))
+	}
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	if err := c.SetWithTTL(req.Key, req.Value, time.Duration(req.Ttl)*time.Millisecond, req.Tags...); err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	return &rpc.SetResponse{}, nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *rpc.DeleteRequest) (*rpc.DeleteResponse, error) {
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	existed, err := c.Delete(req.Key)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	return &rpc.DeleteResponse{Existed: existed}, nil
+}
+
+func (s *grpcServer) Stats(ctx context.Context, req *rpc.StatsRequest) (*rpc.StatsResponse, error) {
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	stats := c.Stats()
+	rejections := make(map[string]int64, len(stats.Rejections))
+	for reason, n := range stats.Rejections {
+		rejections[string(reason)] = n
+	}
+	resp := &rpc.StatsResponse{
+		Name:       stats.Name,
+		Entries:    int64(stats.Entries),
+		Bytes:      stats.Bytes,
+		Hits:       stats.Hits,
+		HotHits:    stats.HotHits,
+		Misses:     stats.Misses,
+		Evictions:  stats.Evictions,
+		Rejections: rejections,
+	}
+	if sp := stats.Spill; sp != nil {
+		resp.Spill = &rpc.SpillStats{
+			Entries:     int64(sp.Entries),
+			LiveBytes:   sp.LiveBytes,
+			FileBytes:   sp.FileBytes,
+			Compactions: int64(sp.Compactions),
+		}
+	}
+	if wb := stats.Writeback; wb != nil {
+		resp.Writeback = &rpc.WritebackStats{
+			Mode:      string(wb.Mode),
+			Queued:    int64(wb.Queued),
+			LagMs:     wb.Lag.Milliseconds(),
+			Written:   wb.Written,
+			Coalesced: wb.Coalesced,
+			Retries:   wb.Retries,
+			RetryInMs: wb.RetryIn.Milliseconds(),
+			Failures:  wb.Failures,
+			LastError: wb.LastError,
+		}
+	}
+	return resp, nil
+}
+
+// 与 /events 相同, 按序号推送本节点的变更事件, 直到客户端断开
+func (s *grpcServer) Watch(req *rpc.WatchRequest, stream rpc.Cache_WatchServer) error {
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return rpc.Error(stream.Context(), err)
+	}
+	epoch, since := req.Epoch, req.Since
+	for {
+		events, lost, wait := c.Changes(epoch, since, watchBatch)
+		if lost {
+			if epoch != c.ChangeEpoch() {
+				since = 0
+			}
+			if err := stream.Send(&rpc.WatchEvent{Epoch: c.ChangeEpoch(), Seq: since, Lost: true}); err != nil {
+				return err
+			}
+		}
+		epoch = c.ChangeEpoch()
+		for _, e := range events {
+			err := stream.Send(&rpc.WatchEvent{
+				Epoch:   e.Epoch,
+				Seq:     e.Seq,
+				Op:      string(e.Op),
+				Key:     e.Key,
+				Value:   e.Value,
+				Version: e.Version,
+				Time:    e.Time,
+			})
+			if err != nil {
+				return err
+			}
+			since = e.Seq
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-wait:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s *grpcServer) Peer(ctx context.Context, req *rpc.PeerRequest) (*rpc.PeerResponse, error) {
+	c, err := s.group(req.Group, s.controller)
+	if err != nil {
+		return nil, rpc.Error(ctx, err)
+	}
+	data, err := c.ServePeer(req.Path, req.Body)
+	raw, merr := json.Marshal(data)
+	if err != nil {
+		// 业务错误附带的数据(如版本不一致时的当前版本号)放在trailer中
+		if merr == nil && data != nil {
+			rpc.SetErrorData(ctx, raw)
+		}
+		return nil, rpc.Error(ctx, err)
+	}
+	if merr != nil {
+		return nil, rpc.Error(ctx, merr)
+	}
+	return &rpc.PeerResponse{Data: raw}, nil
+}
@@ -0,0 +1,159 @@
+package zkcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func dialRPC(t *testing.T, url string) rpc.CacheClient {
+	conn, err := grpc.Dial(strings.TrimPrefix(url, "http://"), append(rpc.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rpc.NewCacheClient(conn)
+}
+
+func TestGRPCClient(t *testing.T) {
+	c := NewController("grpcClient", 0, func(key string) (string, error) {
+		if key == "db" {
+			return "from db", nil
+		}
+		return "", errors.New("not found")
+	}, nil)
+	srv := newPeerServer(c)
+	defer srv.Close()
+	client := dialRPC(t, srv.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	watch, err := client.Watch(ctx, &rpc.WatchRequest{Group: "grpcClient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Set(ctx, &rpc.SetRequest{Group: "grpcClient", Key: "key", Value: "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client.Get(ctx, &rpc.GetRequest{Group: "grpcClient", Key: "key"}); err != nil || resp.Value != "value" {
+		t.Fatal("check get", resp, err)
+	}
+	_, err = client.Get(ctx, &rpc.GetRequest{Group: "grpcClient", Key: "missing"})
+	if code, ok := response.ErrCode(err); !ok || code != response.NOT_FOUND {
+		t.Fatal("missing key should be NOT_FOUND", err)
+	}
+	// 其他错误保留原错误码
+	noSource := newPeerServer(NewController("grpcNoSource", 0, nil, nil))
+	defer noSource.Close()
+	_, err = dialRPC(t, noSource.URL).Get(ctx, &rpc.GetRequest{Key: "missing"})
+	if code, ok := response.ErrCode(err); !ok || code != response.ERROR {
+		t.Fatal("missing data source should be ERROR", err)
+	}
+	_, err = client.Set(ctx, &rpc.SetRequest{Group: "grpcClient"})
+	if code, ok := response.ErrCode(err); !ok || code != response.PARAMETER_ERROR {
+		t.Fatal("empty key should be PARAMETER_ERROR", err)
+	}
+
+	many, err := client.GetMany(ctx, &rpc.GetManyRequest{Group: "grpcClient", Keys: []string{"key", "missing", "db"}})
+	if err != nil || len(many.Items) != 3 || !many.Items[0].Found || many.Items[1].Found || many.Items[2].Value != "from db" {
+		t.Fatal("check get many", many, err)
+	}
+	if resp, err := client.Delete(ctx, &rpc.DeleteRequest{Group: "grpcClient", Key: "key"}); err != nil || !resp.Existed {
+		t.Fatal("check delete", resp, err)
+	}
+	if stats, err := client.Stats(ctx, &rpc.StatsRequest{Group: "grpcClient"}); err != nil || stats.Name != "grpcClient" || stats.Entries != 1 {
+		t.Fatal("check stats", stats, err)
+	}
+
+	want := []string{"set:key", "set:db", "delete:key"}
+	for _, w := range want {
+		e, err := watch.Recv()
+		if err != nil || e.Op+":"+e.Key != w {
+			t.Fatal("check watch event", w, e, err)
+		}
+	}
+}
+
+// 未注册的group返回PARAMETER_ERROR, 不使用默认的分组
+func TestGRPCUnknownGroup(t *testing.T) {
+	c := NewController("grpcGroup", 0, nil, nil)
+	c.Set("key", "value")
+	s := NewGRPCServer(c)
+	srv := httptest.NewServer(GRPCHandler(s, http.NotFoundHandler()))
+	defer srv.Close()
+	client := dialRPC(t, srv.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if resp, err := client.Get(ctx, &rpc.GetRequest{Key: "key"}); err != nil || resp.Value != "value" {
+		t.Fatal("empty group should use the default controller", resp, err)
+	}
+	_, err := client.Get(ctx, &rpc.GetRequest{Group: "grpcGroupTypo", Key: "key"})
+	if code, ok := response.ErrCode(err); !ok || code != response.PARAMETER_ERROR {
+		t.Fatal("unknown group should be PARAMETER_ERROR", err)
+	}
+	watch, err := client.Watch(ctx, &rpc.WatchRequest{Group: "grpcGroupTypo"})
+	if err == nil {
+		_, err = watch.Recv()
+	}
+	if code, ok := response.ErrCode(err); !ok || code != response.PARAMETER_ERROR {
+		t.Fatal("unknown group should be PARAMETER_ERROR on watch", err)
+	}
+}
+
+func TestGRPCPeerTransport(t *testing.T) {
+	controllers, _ := newCluster(t, "grpcPeer", 3, 2)
+	for _, c := range controllers {
+		c.SetPeerTransport(TransportGRPC)
+	}
+	owner := byUrl(controllers, controllers[0].nodePool.PickNodes("key", 1)[0])
+	other := controllers[0]
+	if other == owner {
+		other = controllers[1]
+	}
+
+	if err := other.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := owner.GetLocal("key"); !ok || e.Value != "value" {
+		t.Fatal("owner should store the value", e)
+	}
+	if value, err := other.Get("key", 0); err != nil || string(value) != "value" {
+		t.Fatal("check get", string(value), err)
+	}
+
+	// 业务错误经gRPC传输后保持不变
+	e, _ := owner.GetLocal("key")
+	version, err := other.CompareAndSet("key", e.Version+1, "stale")
+	if code, ok := response.ErrCode(err); !ok || code != response.VERSION_MISMATCH || version != e.Version {
+		t.Fatal("check cas over grpc", version, err)
+	}
+	if _, err := other.Lock("key", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.Lock("key", time.Second)
+	if code, ok := response.ErrCode(err); !ok || code != response.LOCK_HELD {
+		t.Fatal("check lock over grpc", err)
+	}
+
+	// 连接按节点复用
+	other.nodePool.mu.Lock()
+	conns := len(other.nodePool.conns)
+	other.nodePool.mu.Unlock()
+	if conns == 0 || conns > 2 {
+		t.Fatal("check connection reuse", conns)
+	}
+	other.nodePool.Set(other.nodePool.self())
+	if len(other.nodePool.conns) != 0 {
+		t.Fatal("connections to removed nodes should be closed")
+	}
+}
@@ -0,0 +1,110 @@
+package zkcache
+
+import (
+	"sync"
+	"time"
+	"zkCache/hotkey"
+	"zkCache/lru"
+)
+
+type HotKeyConfig struct {
+	// 统计的key个数
+	TopK int
+	// 一个窗口内的请求数达到该值视为热点
+	Threshold int
+	Window    time.Duration
+	// 热点副本的有效期, 过期前读到的可能是旧数据; 为0时不保存热点副本, 只做统计
+	TTL time.Duration
+	// 热点副本允许的最大空间  单位字节
+	CacheSize int
+}
+
+var DefaultHotKeyConfig = HotKeyConfig{
+	TopK:      32,
+	Threshold: 1000,
+	Window:    time.Second,
+	TTL:       time.Second,
+	CacheSize: 4 << 20,
+}
+
+// 热点副本: 非归属节点上热点key的短期本地副本, 与本节点负责的数据分开存放
+// 不参与复制、持久化和变更流
+// 热点探测和副本都只在本节点: 各节点按自己收到的请求分别统计, 不与其他节点同步
+// 经本节点写入或删除时副本立即失效; 经其他节点写入时不会通知本节点, 在TTL内仍返回旧值
+type hotCache struct {
+	mu       sync.Mutex
+	lru      *lru.Cache
+	ttl      time.Duration
+	detector *hotkey.Detector
+}
+
+func newHotCache(cfg HotKeyConfig) *hotCache {
+	return &hotCache{
+		lru:      lru.New(cfg.CacheSize, nil),
+		ttl:      cfg.TTL,
+		detector: hotkey.New(cfg.TopK, 16*cfg.TopK, cfg.Threshold, cfg.Window),
+	}
+}
+
+func (h *hotCache) get(key string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lru.Get(key)
+}
+
+func (h *hotCache) set(key string, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lru.SetEntry(lru.Entry{Key: key, Value: value, Expire: time.Now().Add(h.ttl).UnixNano()})
+}
+
+func (h *hotCache) remove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lru.Remove(key)
+}
+
+func (h *hotCache) cached(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.lru.GetEntry(key)
+	return ok
+}
+
+// 替换热点探测配置, 已有的热点副本和统计被丢弃; 可以在服务过程中调用
+func (c *Controller) SetHotKeys(cfg HotKeyConfig) {
+	c.hot.Store(newHotCache(cfg))
+}
+
+func (c *Controller) hotKeys() *hotCache {
+	return c.hot.Load().(*hotCache)
+}
+
+// 本节点统计到的请求最多的key, 不包含其他节点的统计; Cached表示本节点持有热点副本
+func (c *Controller) HotKeys() []HotKeyStat {
+	hot := c.hotKeys()
+	top := hot.detector.Top()
+	keys := make([]HotKeyStat, 0, len(top))
+	for _, k := range top {
+		keys = append(keys, HotKeyStat{HotKey: k, Cached: hot.cached(k.Key)})
+	}
+	return keys
+}
+
+type HotKeyStat struct {
+	hotkey.HotKey
+	Cached bool `json:"cached"`
+}
+
+// 加载完成后, 本节点不负责的热点key保存一份短期副本
+func (c *Controller) keepHot(key string, value []byte, hot bool) {
+	hc := c.hotKeys()
+	if !hot || hc.ttl <= 0 {
+		return
+	}
+	nodes := c.nodePool.PickNodes(key, c.Replicas())
+	if len(nodes) == 0 || containsNode(nodes, c.nodePool.self()) {
+		return
+	}
+	hc.set(key, string(value))
+}
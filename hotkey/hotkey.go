@@ -0,0 +1,161 @@
+package hotkey
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 分片数, 按key的哈希分片, 每个分片单独加锁, 避免每次请求都争用同一把锁
+const shardCount = 16
+
+// 热点key探测: count-min sketch估算每个key的请求次数, 只保留次数最多的k个key
+// 每经过一个窗口所有计数减半, 使计数近似于最近一个窗口内的请求数
+// 同一个key总是落在同一个分片, 各分片分别统计和衰减
+type Detector struct {
+	k         int
+	threshold uint32
+	shards    [shardCount]shard
+}
+
+type shard struct {
+	mu     sync.Mutex
+	window time.Duration
+	sketch [4][]uint32
+	mask   uint64
+	// 本分片中次数最多的至多k个key
+	top   map[string]uint32
+	start time.Time
+}
+
+type HotKey struct {
+	Key   string `json:"key"`
+	Count uint32 `json:"count"`
+	// 是否达到阈值
+	Hot bool `json:"hot"`
+}
+
+// k: 保留的key个数; width: sketch每行的计数器个数, 平均分给各分片
+// threshold: 一个窗口内的请求数达到该值视为热点
+func New(k int, width int, threshold int, window time.Duration) *Detector {
+	w := 64
+	for w*shardCount < width {
+		w <<= 1
+	}
+	d := &Detector{
+		k:         k,
+		threshold: uint32(threshold),
+	}
+	now := time.Now()
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.window = window
+		s.mask = uint64(w - 1)
+		s.top = make(map[string]uint32, k)
+		s.start = now
+		for j := range s.sketch {
+			s.sketch[j] = make([]uint32, w)
+		}
+	}
+	return d
+}
+
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// 用哈希的高位选择分片, 低位用于sketch的下标
+func (d *Detector) shard(h uint64) *shard {
+	return &d.shards[h>>60%shardCount]
+}
+
+// 记录一次请求, 返回key是否为热点
+func (d *Detector) Record(key string) bool {
+	h1 := hash(key)
+	s := d.shard(h1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.start) >= s.window {
+		s.decay()
+	}
+	h2 := h1>>32 | 1
+	count := ^uint32(0)
+	for i := range s.sketch {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		s.sketch[i][idx]++
+		if s.sketch[i][idx] < count {
+			count = s.sketch[i][idx]
+		}
+	}
+	s.offer(key, count, d.k)
+	return count >= d.threshold
+}
+
+// 需持有锁
+func (s *shard) offer(key string, count uint32, k int) {
+	if _, ok := s.top[key]; ok || len(s.top) < k {
+		s.top[key] = count
+		return
+	}
+	minKey, min := "", ^uint32(0)
+	for k, c := range s.top {
+		if c < min {
+			minKey, min = k, c
+		}
+	}
+	if count > min {
+		delete(s.top, minKey)
+		s.top[key] = count
+	}
+}
+
+// 需持有锁
+func (s *shard) decay() {
+	s.start = time.Now()
+	for i := range s.sketch {
+		for j := range s.sketch[i] {
+			s.sketch[i][j] >>= 1
+		}
+	}
+	for k, c := range s.top {
+		if c >>= 1; c == 0 {
+			delete(s.top, k)
+		} else {
+			s.top[k] = c
+		}
+	}
+}
+
+// key当前是否为热点
+func (d *Detector) IsHot(key string) bool {
+	s := d.shard(hash(key))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.top[key] >= d.threshold
+}
+
+// 请求次数最多的至多k个key, 按次数从高到低排列
+func (d *Detector) Top() []HotKey {
+	keys := make([]HotKey, 0, d.k)
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.Lock()
+		for k, c := range s.top {
+			keys = append(keys, HotKey{Key: k, Count: c, Hot: c >= d.threshold})
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > d.k {
+		keys = keys[:d.k]
+	}
+	return keys
+}
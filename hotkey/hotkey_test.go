@@ -0,0 +1,73 @@
+package hotkey
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetector(t *testing.T) {
+	d := New(2, 64, 10, time.Hour)
+	for i := 0; i < 10; i++ {
+		d.Record("hot")
+	}
+	for i := 0; i < 5; i++ {
+		d.Record("warm")
+	}
+	for i := 0; i < 100; i++ {
+		d.Record(fmt.Sprintf("cold%d", i))
+	}
+	if !d.IsHot("hot") || d.IsHot("warm") {
+		t.Fatal("check IsHot")
+	}
+	top := d.Top()
+	if len(top) != 2 || top[0].Key != "hot" || !top[0].Hot || top[1].Key != "warm" || top[1].Hot {
+		t.Fatal("check top", top)
+	}
+}
+
+func TestDecay(t *testing.T) {
+	d := New(4, 64, 4, 20*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		d.Record("key")
+	}
+	if !d.IsHot("key") {
+		t.Fatal("key should be hot")
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 经过一个窗口后计数减半
+	if d.Record("key") {
+		t.Fatal("key should cool down")
+	}
+	if top := d.Top(); len(top) != 1 || top[0].Count != 3 {
+		t.Fatal("check decayed count", top)
+	}
+}
+
+// 不同分片中的key合并后仍只返回次数最多的k个
+func TestConcurrentRecord(t *testing.T) {
+	d := New(3, 1024, 100, time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				d.Record(fmt.Sprintf("key%d", j%10))
+				d.Record(fmt.Sprintf("cold%d-%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	top := d.Top()
+	if len(top) != 3 {
+		t.Fatal("check top size", top)
+	}
+	for _, k := range top {
+		if !strings.HasPrefix(k.Key, "key") || k.Count < 80 {
+			t.Fatal("check top", top)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package zkcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHotKeys(t *testing.T) {
+	controllers, _ := newCluster(t, "hotkey", 2, 1)
+	owner := byUrl(controllers, controllers[0].nodePool.PickNodes("celebrity", 1)[0])
+	other := outsider(controllers, "celebrity")
+	cfg := DefaultHotKeyConfig
+	cfg.Threshold = 3
+	cfg.TTL = time.Minute
+	other.SetHotKeys(cfg)
+	owner.Set("celebrity", "v1")
+
+	for i := 0; i < 3; i++ {
+		if v, err := other.Get("celebrity", 0); err != nil || string(v) != "v1" {
+			t.Fatal("check get", string(v), err)
+		}
+	}
+	// 归属节点上的新值不会同步到热点副本, 说明读取不再访问归属节点
+	owner.SetLocal("celebrity", "v2")
+	if v, _ := other.Get("celebrity", 0); string(v) != "v1" || other.Stats().HotHits != 1 {
+		t.Fatal("should be served by hot cache", string(v))
+	}
+	if _, ok := other.GetLocal("celebrity"); ok {
+		t.Fatal("hot copy should be kept apart from owned data")
+	}
+	keys := other.HotKeys()
+	if len(keys) != 1 || keys[0].Key != "celebrity" || !keys[0].Hot || !keys[0].Cached {
+		t.Fatal("check hot keys", keys)
+	}
+
+	// 本节点写入时丢弃热点副本
+	other.Set("celebrity", "v3")
+	if v, _ := other.Get("celebrity", 0); string(v) != "v3" {
+		t.Fatal("hot copy should be dropped on set", string(v))
+	}
+
+	// TTL为0时只统计不保存副本
+	cfg.TTL = 0
+	other.SetHotKeys(cfg)
+	for i := 0; i < 3; i++ {
+		other.Get("celebrity", 0)
+	}
+	owner.SetLocal("celebrity", "v4")
+	if v, _ := other.Get("celebrity", 0); string(v) != "v4" {
+		t.Fatal("hot copy should be disabled", string(v))
+	}
+	if keys := other.HotKeys(); len(keys) != 1 || !keys[0].Hot || keys[0].Cached {
+		t.Fatal("check hot keys without copies", keys)
+	}
+}
@@ -0,0 +1,104 @@
+package lease
+
+import (
+	"sync"
+	"time"
+)
+
+// 保存在key的归属节点上的锁, 过期后自动释放
+type Table struct {
+	mu    sync.Mutex
+	locks map[string]Lease
+	// 最近一次发放的fencing token
+	token uint64
+	calls int
+}
+
+// 每加锁该次数清理一次已过期的锁
+const sweepInterval = 1024
+
+type Lease struct {
+	Key string `json:"key"`
+	// fencing token, 持有者用它释放、续期锁, 并携带给下游存储以拒绝过期持有者的写入
+	Token uint64 `json:"token"`
+	// 过期时间 UnixMilli
+	Expire int64 `json:"expire"`
+}
+
+func New() *Table {
+	return &Table{locks: make(map[string]Lease)}
+}
+
+// 加锁, 已被他人持有且未过期时返回false及当前的持有情况
+func (t *Table) Acquire(key string, ttl time.Duration, now time.Time) (Lease, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.calls++; t.calls%sweepInterval == 0 {
+		t.sweep(now)
+	}
+	if l, ok := t.held(key, now); ok {
+		return l, false
+	}
+	l := Lease{Key: key, Token: t.next(now), Expire: now.Add(ttl).UnixMilli()}
+	t.locks[key] = l
+	return l, true
+}
+
+// 释放锁, token与当前持有者不一致(或锁已过期)时返回false
+func (t *Table) Release(key string, token uint64, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.held(key, now); ok && l.Token == token {
+		delete(t.locks, key)
+		return true
+	}
+	return false
+}
+
+// 续期, token与当前持有者不一致(或锁已过期)时返回false
+func (t *Table) Refresh(key string, token uint64, ttl time.Duration, now time.Time) (Lease, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.held(key, now)
+	if !ok || l.Token != token {
+		return l, false
+	}
+	l.Expire = now.Add(ttl).UnixMilli()
+	t.locks[key] = l
+	return l, true
+}
+
+// 需持有锁; 顺便删除已过期的锁
+func (t *Table) held(key string, now time.Time) (Lease, bool) {
+	l, ok := t.locks[key]
+	if ok && l.Expire <= now.UnixMilli() {
+		delete(t.locks, key)
+		return Lease{}, false
+	}
+	return l, ok
+}
+
+// 需持有锁; token单调递增且不小于当前时间的纳秒数
+// 归属节点切换后, 只要节点间时钟大致同步, 新节点发放的token仍大于旧节点发放的token
+func (t *Table) next(now time.Time) uint64 {
+	t.token++
+	if ns := uint64(now.UnixNano()); ns > t.token {
+		t.token = ns
+	}
+	return t.token
+}
+
+// 需持有锁
+func (t *Table) sweep(now time.Time) {
+	for key := range t.locks {
+		t.held(key, now)
+	}
+}
+
+// 当前未过期的锁个数
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(time.Now())
+	return len(t.locks)
+}
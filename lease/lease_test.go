@@ -0,0 +1,51 @@
+package lease
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	table := New()
+	now := time.Unix(1000, 0)
+	l1, ok := table.Acquire("job", time.Second, now)
+	if !ok || l1.Token < uint64(now.UnixNano()) || l1.Expire != now.Add(time.Second).UnixMilli() {
+		t.Fatal("check acquire", l1)
+	}
+	if held, ok := table.Acquire("job", time.Second, now); ok || held.Token != l1.Token {
+		t.Fatal("lock should be held", held)
+	}
+	if _, ok := table.Refresh("job", l1.Token+1, time.Second, now); ok {
+		t.Fatal("refresh with wrong token should fail")
+	}
+	if l, ok := table.Refresh("job", l1.Token, 2*time.Second, now.Add(500*time.Millisecond)); !ok || l.Expire != now.Add(2500*time.Millisecond).UnixMilli() {
+		t.Fatal("check refresh", l)
+	}
+	if table.Release("job", l1.Token+1, now) || !table.Release("job", l1.Token, now) {
+		t.Fatal("check release")
+	}
+
+	// 过期后自动释放, token继续递增
+	l2, _ := table.Acquire("job", time.Second, now)
+	l3, ok := table.Acquire("job", time.Second, now.Add(time.Second))
+	if !ok || l3.Token <= l2.Token || l2.Token <= l1.Token {
+		t.Fatal("check expire and token", l2, l3)
+	}
+	if table.Release("job", l2.Token, now.Add(time.Second)) {
+		t.Fatal("expired holder should not release")
+	}
+}
+
+func TestTokenAcrossTables(t *testing.T) {
+	old, fresh := New(), New()
+	now := time.Unix(1000, 0)
+	var last Lease
+	for i := 0; i < 100; i++ {
+		last, _ = old.Acquire("job", time.Nanosecond, now)
+	}
+	// 新的归属节点在稍后的时间发放的token更大
+	l, _ := fresh.Acquire("job", time.Second, now.Add(time.Millisecond))
+	if l.Token <= last.Token {
+		t.Fatal("token should increase across tables", last, l)
+	}
+}
@@ -0,0 +1,140 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 从本地文件读取
+// path为目录时, key对应目录下的同名文件, 文件内容即为值;
+// path为文件时, .json文件为一个字符串到字符串的对象, 其他文件每行一个 key=value, 以#开头的行为注释;
+// 文件修改后在下次读取时重新加载
+func File(path string) (Func, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return dirLoader(path), nil
+	}
+	f := &kvFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f.load, nil
+}
+
+func dirLoader(dir string) Func {
+	return func(key string) (string, error) {
+		// 不允许访问目录之外的文件
+		if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+			return "", ErrNotFound
+		}
+		data, err := os.ReadFile(filepath.Join(dir, key))
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+type kvFile struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	size    int64
+	data    map[string]string
+}
+
+func (f *kvFile) load(key string) (string, error) {
+	if info, err := os.Stat(f.path); err == nil {
+		f.mu.RLock()
+		changed := !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+		f.mu.RUnlock()
+		if changed {
+			if err := f.reload(); err != nil {
+				// 重新加载失败时继续使用旧数据, 记录本次的修改时间, 文件再次修改前不重复解析
+				zklog.Logger.WithFields(logrus.Fields{
+					"path": f.path,
+					"err":  err.Error(),
+				}).Warn("reload file failed, keep old data")
+				f.mu.Lock()
+				f.modTime, f.size = info.ModTime(), info.Size()
+				f.mu.Unlock()
+			}
+		}
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if v, ok := f.data[key]; ok {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+func (f *kvFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := parseKV(f.path, content)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data, f.modTime, f.size = data, info.ModTime(), info.Size()
+	return nil
+}
+
+// 读取key=value或JSON文件中的全部数据, 格式同 File
+func ReadKV(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKV(path, content)
+}
+
+func parseKV(path string, content []byte) (map[string]string, error) {
+	data := make(map[string]string)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("loader: parse %s: %v", path, err)
+		}
+		return data, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64<<10), maxValueSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("loader: %s line %d: want key=value", path, n)
+		}
+		data[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return data, scanner.Err()
+}
@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "key"), []byte("value"), 0644)
+	os.WriteFile(filepath.Join(filepath.Dir(dir), "secret"), []byte("secret"), 0644)
+	fn, err := File(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fn("key"); err != nil || v != "value" {
+		t.Fatal("check dir", v, err)
+	}
+	for _, key := range []string{"missing", "../secret", "..", ""} {
+		if _, err := fn(key); !errors.Is(err, ErrNotFound) {
+			t.Fatal("should be not found", key, err)
+		}
+	}
+}
+
+func TestFileKV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(path, []byte("# comment\nkey = value\nurl=http://a?b=c\n"), 0644)
+	fn, err := File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fn("key"); err != nil || v != "value" {
+		t.Fatal("check kv", v, err)
+	}
+	if v, _ := fn("url"); v != "http://a?b=c" {
+		t.Fatal("only the first = separates key and value", v)
+	}
+	if _, err := fn("# comment"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("comment should be ignored", err)
+	}
+
+	// 修改后重新加载
+	os.WriteFile(path, []byte("key=changed\n"), 0644)
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	if v, err := fn("key"); err != nil || v != "changed" {
+		t.Fatal("file should be reloaded", v, err)
+	}
+
+	// 重新加载失败时继续使用旧数据, 文件再次修改前不重复解析
+	os.WriteFile(path, []byte("no separator\n"), 0644)
+	os.Chtimes(path, time.Now().Add(2*time.Second), time.Now().Add(2*time.Second))
+	if v, err := fn("key"); err != nil || v != "changed" {
+		t.Fatal("old data should be kept", v, err)
+	}
+	f := &kvFile{path: path, data: map[string]string{"key": "old"}}
+	if v, err := f.load("key"); err != nil || v != "old" {
+		t.Fatal("old data should be kept", v, err)
+	}
+	if info, _ := os.Stat(path); !f.modTime.Equal(info.ModTime()) || f.size != info.Size() {
+		t.Fatal("failed mtime should be recorded", f.modTime)
+	}
+
+	if _, err := File(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing file should fail")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(bad, []byte("no separator\n"), 0644)
+	if _, err := File(bad); err == nil {
+		t.Fatal("bad line should fail")
+	}
+}
+
+func TestFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	os.WriteFile(path, []byte(`{"key": "value"}`), 0644)
+	fn, err := File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fn("key"); err != nil || v != "value" {
+		t.Fatal("check json", v, err)
+	}
+}
+
+func TestReadKV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.txt")
+	os.WriteFile(path, []byte("a=1\nb=2\n"), 0644)
+	data, err := ReadKV(path)
+	if err != nil || len(data) != 2 || data["b"] != "2" {
+		t.Fatal("check kv", data, err)
+	}
+}
@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 从HTTP源站读取, urlTemplate中的 {key} 替换为转义后的key, 如 http://origin/items/{key}
+// 200返回响应体, 404视为不存在, 其余状态码视为错误
+func HTTP(urlTemplate string, timeout time.Duration, header map[string]string) (Func, error) {
+	if !strings.Contains(urlTemplate, "{key}") {
+		return nil, fmt.Errorf("loader: url template %q must contain {key}", urlTemplate)
+	}
+	if _, err := url.Parse(strings.ReplaceAll(urlTemplate, "{key}", "key")); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: timeout}
+	return func(key string) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(urlTemplate, "{key}", url.PathEscape(key)), nil)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return "", ErrNotFound
+		default:
+			return "", fmt.Errorf("loader: origin returned %v", res.Status)
+		}
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxValueSize+1))
+		if err != nil {
+			return "", err
+		}
+		if len(body) > maxValueSize {
+			return "", fmt.Errorf("loader: value of key %s exceeds %d bytes", key, maxValueSize)
+		}
+		return string(body), nil
+	}, nil
+}
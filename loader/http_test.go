@@ -0,0 +1,49 @@
+package loader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/items/a%2Fb":
+			w.Write([]byte("escaped"))
+		case "/items/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/items/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer origin.Close()
+
+	if _, err := HTTP(origin.URL+"/items", time.Second, nil); err == nil {
+		t.Fatal("template without {key} should be rejected")
+	}
+	fn, err := HTTP(origin.URL+"/items/{key}", 50*time.Millisecond, map[string]string{"Authorization": "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fn("a/b"); err != nil || v != "escaped" {
+		t.Fatal("key should be escaped", v, err)
+	}
+	if _, err := fn("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("404 should be not found", err)
+	}
+	if _, err := fn("broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatal("502 should be an error", err)
+	}
+	if _, err := fn("slow"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatal("timeout should be an error", err)
+	}
+}
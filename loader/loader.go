@@ -0,0 +1,113 @@
+// 内置的数据源加载器, 返回值可直接作为 zkcache.NewController 的 get 参数
+package loader
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 数据源中不存在该key, 其他错误表示数据源访问失败
+var ErrNotFound = errors.New("loader: key not found")
+
+// 单个值的最大长度, 防止数据源返回异常数据占满内存
+const maxValueSize = 16 << 20
+
+type Func func(key string) (string, error)
+
+type Stats struct {
+	// 分组名
+	Group   string `json:"group"`
+	Backend string `json:"backend"`
+	Loads   int64  `json:"loads"`
+	Hits    int64  `json:"hits"`
+	// 数据源中不存在
+	Misses int64 `json:"misses"`
+	Errors int64 `json:"errors"`
+	// 平均耗时
+	AvgLatency time.Duration `json:"avgLatency"`
+	LastError  string        `json:"lastError,omitempty"`
+}
+
+type counted struct {
+	group   string
+	backend string
+	loads   int64
+	hits    int64
+	misses  int64
+	errors  int64
+	// 累计耗时 单位纳秒
+	latency int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+var (
+	mu      sync.Mutex
+	loaders = make(map[string]*counted)
+)
+
+// 统计fn的调用情况, 按分组记录; 同一分组重复调用时替换之前的统计
+func Instrument(group string, backend string, fn Func) Func {
+	c := &counted{group: group, backend: backend}
+	mu.Lock()
+	loaders[group] = c
+	mu.Unlock()
+	return func(key string) (string, error) {
+		start := time.Now()
+		value, err := fn(key)
+		atomic.AddInt64(&c.latency, int64(time.Since(start)))
+		atomic.AddInt64(&c.loads, 1)
+		switch {
+		case err == nil:
+			atomic.AddInt64(&c.hits, 1)
+		case errors.Is(err, ErrNotFound):
+			atomic.AddInt64(&c.misses, 1)
+		default:
+			atomic.AddInt64(&c.errors, 1)
+			c.mu.Lock()
+			c.lastError = err.Error()
+			c.mu.Unlock()
+		}
+		return value, err
+	}
+}
+
+// 所有加载器的统计, 按分组名排序
+func AllStats() []Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	res := make([]Stats, 0, len(loaders))
+	for _, c := range loaders {
+		s := Stats{
+			Group:   c.group,
+			Backend: c.backend,
+			Loads:   atomic.LoadInt64(&c.loads),
+			Hits:    atomic.LoadInt64(&c.hits),
+			Misses:  atomic.LoadInt64(&c.misses),
+			Errors:  atomic.LoadInt64(&c.errors),
+		}
+		if s.Loads > 0 {
+			s.AvgLatency = time.Duration(atomic.LoadInt64(&c.latency) / s.Loads)
+		}
+		c.mu.Lock()
+		s.LastError = c.lastError
+		c.mu.Unlock()
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Group < res[j].Group })
+	return res
+}
+
+// 固定的数据, 用于演示和测试
+func Static(data map[string]string) Func {
+	return func(key string) (string, error) {
+		if v, ok := data[key]; ok {
+			return v, nil
+		}
+		return "", ErrNotFound
+	}
+}
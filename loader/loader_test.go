@@ -0,0 +1,45 @@
+package loader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	fail := errors.New("boom")
+	fn := Instrument("instrument", "static", func(key string) (string, error) {
+		switch key {
+		case "hit":
+			return "value", nil
+		case "miss":
+			return "", ErrNotFound
+		}
+		return "", fail
+	})
+	fn("hit")
+	fn("hit")
+	fn("miss")
+	if _, err := fn("error"); err != fail {
+		t.Fatal("error should be returned as is", err)
+	}
+	for _, s := range AllStats() {
+		if s.Group != "instrument" {
+			continue
+		}
+		if s.Backend != "static" || s.Loads != 4 || s.Hits != 2 || s.Misses != 1 || s.Errors != 1 || s.LastError != "boom" {
+			t.Fatal("check stats", s)
+		}
+		return
+	}
+	t.Fatal("stats not found")
+}
+
+func TestStatic(t *testing.T) {
+	fn := Static(map[string]string{"key": "value"})
+	if v, err := fn("key"); err != nil || v != "value" {
+		t.Fatal("check static", v, err)
+	}
+	if _, err := fn("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("check not found", err)
+	}
+}
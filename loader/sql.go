@@ -0,0 +1,46 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 执行带一个参数的查询, 参数为key, 取第一行第一列作为值, 没有结果视为不存在
+// 如 SELECT value FROM items WHERE id = ?  占位符的写法取决于驱动
+func SQL(db *sql.DB, query string, timeout time.Duration) Func {
+	return func(key string) (string, error) {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var value sql.NullString
+		err := db.QueryRowContext(ctx, query, key).Scan(&value)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !value.Valid) {
+			return "", ErrNotFound
+		}
+		return value.String, err
+	}
+}
+
+// 打开数据库并检查连接, 驱动需要由调用方导入
+func OpenSQL(driver string, dsn string, query string, timeout time.Duration) (Func, *sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	ping := timeout
+	if ping <= 0 {
+		ping = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ping)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return SQL(db, query, timeout), db, nil
+}
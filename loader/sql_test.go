@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// 内存中的假驱动, 查询参数作为key在data中查找
+type fakeDriver struct {
+	data map[string]interface{}
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+type fakeStmt struct{ d *fakeDriver }
+
+type fakeRows struct {
+	value interface{}
+	done  bool
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt{c.d}, nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return 1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	key, _ := args[0].(string)
+	if key == "slow" {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if key == "broken" {
+		return nil, errors.New("connection reset")
+	}
+	value, ok := s.d.data[key]
+	return &fakeRows{value: value, done: !ok}, nil
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0] = r.value
+	r.done = true
+	return nil
+}
+
+func TestSQL(t *testing.T) {
+	sql.Register("loader-fake", &fakeDriver{data: map[string]interface{}{
+		"key":  "value",
+		"null": nil,
+	}})
+	fn, db, err := OpenSQL("loader-fake", "", "SELECT value FROM items WHERE id = ?", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := fn("key"); err != nil || v != "value" {
+		t.Fatal("check sql", v, err)
+	}
+	for _, key := range []string{"missing", "null"} {
+		if _, err := fn(key); !errors.Is(err, ErrNotFound) {
+			t.Fatal("should be not found", key, err)
+		}
+	}
+	if _, err := fn("broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatal("driver error should be returned", err)
+	}
+	if _, _, err := OpenSQL("loader-unknown", "", "", time.Second); err == nil {
+		t.Fatal("unknown driver should fail")
+	}
+}
@@ -0,0 +1,85 @@
+package zkcache
+
+import (
+	"fmt"
+	"time"
+	"zkCache/lease"
+	"zkCache/pkg/response"
+)
+
+type LockReq struct {
+	Key string `json:"key"`
+	// 毫秒
+	TTL   int64  `json:"ttl"`
+	Token uint64 `json:"token"`
+}
+
+// 在key的归属节点上加锁, 返回带有fencing token的租约; 锁已被占用时返回 response.LOCK_HELD
+// 持有者需要在租约过期前Refresh, 持有者挂掉后锁在ttl后自动释放
+//
+// 锁只保存在归属节点的内存中, 不复制也不持久化:
+// 归属节点挂掉或hash环变化后, 锁由新的归属节点(或副本节点)重新开始管理, 原有的锁丢失,
+// 其他调用者可以立即加锁成功, 此时原持有者的Refresh/Unlock会返回 response.LOCK_NOT_HELD
+// 新节点发放的token仍大于旧token(依赖节点间时钟大致同步), 下游存储应拒绝携带更小token的写入
+func (c *Controller) Lock(key string, ttl time.Duration) (lease.Lease, error) {
+	return c.lockOnOwner("lock", LockReq{Key: key, TTL: ttl.Milliseconds()}, c.LockLocal)
+}
+
+// 释放锁, token不是当前持有者时返回 response.LOCK_NOT_HELD
+func (c *Controller) Unlock(key string, token uint64) error {
+	_, err := c.lockOnOwner("unlock", LockReq{Key: key, Token: token}, func(req LockReq) (lease.Lease, error) {
+		return lease.Lease{}, c.UnlockLocal(req)
+	})
+	return err
+}
+
+// 续期为从现在开始的ttl, token不是当前持有者时返回 response.LOCK_NOT_HELD
+func (c *Controller) Refresh(key string, token uint64, ttl time.Duration) (lease.Lease, error) {
+	return c.lockOnOwner("refresh", LockReq{Key: key, Token: token, TTL: ttl.Milliseconds()}, c.RefreshLocal)
+}
+
+func (c *Controller) lockOnOwner(path string, req LockReq, local func(req LockReq) (lease.Lease, error)) (lease.Lease, error) {
+	if req.Key == "" {
+		return lease.Lease{}, fmt.Errorf("key not exist")
+	}
+	var l lease.Lease
+	err := c.onOwner(req.Key, func() (err error) {
+		l, err = local(req)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, path, c.name, req, &l)
+	})
+	return l, err
+}
+
+func (c *Controller) LockLocal(req LockReq) (lease.Lease, error) {
+	if req.TTL <= 0 {
+		return lease.Lease{}, response.NewErrWithMsg(response.PARAMETER_ERROR, "ttl must be positive")
+	}
+	l, ok := c.locks.Acquire(req.Key, time.Duration(req.TTL)*time.Millisecond, time.Now())
+	if !ok {
+		return lease.Lease{}, response.NewErrWithMsg(response.LOCK_HELD,
+			fmt.Sprintf("key: %s is locked until %s", req.Key, time.UnixMilli(l.Expire).Format(time.RFC3339Nano)))
+	}
+	return l, nil
+}
+
+func (c *Controller) UnlockLocal(req LockReq) error {
+	if !c.locks.Release(req.Key, req.Token, time.Now()) {
+		return response.NewErrWithMsg(response.LOCK_NOT_HELD,
+			fmt.Sprintf("key: %s is not locked by token: %d", req.Key, req.Token))
+	}
+	return nil
+}
+
+func (c *Controller) RefreshLocal(req LockReq) (lease.Lease, error) {
+	if req.TTL <= 0 {
+		return lease.Lease{}, response.NewErrWithMsg(response.PARAMETER_ERROR, "ttl must be positive")
+	}
+	l, ok := c.locks.Refresh(req.Key, req.Token, time.Duration(req.TTL)*time.Millisecond, time.Now())
+	if !ok {
+		return lease.Lease{}, response.NewErrWithMsg(response.LOCK_NOT_HELD,
+			fmt.Sprintf("key: %s is not locked by token: %d", req.Key, req.Token))
+	}
+	return l, nil
+}
@@ -0,0 +1,80 @@
+package zkcache
+
+import (
+	"testing"
+	"time"
+	"zkCache/pkg/response"
+)
+
+func TestLock(t *testing.T) {
+	controllers, _ := newCluster(t, "lock", 2, 1)
+	l, err := controllers[0].Lock("job", time.Minute)
+	if err != nil || l.Token == 0 {
+		t.Fatal("check lock", l, err)
+	}
+	// 其他节点上的调用者看到同一把锁
+	_, err = controllers[1].Lock("job", time.Minute)
+	if code, ok := response.ErrCode(err); !ok || code != response.LOCK_HELD {
+		t.Fatal("lock should be held", err)
+	}
+	if _, err := controllers[1].Refresh("job", l.Token, time.Minute); err != nil {
+		t.Fatal("check refresh", err)
+	}
+	err = controllers[0].Unlock("job", l.Token+1)
+	if code, ok := response.ErrCode(err); !ok || code != response.LOCK_NOT_HELD {
+		t.Fatal("unlock with wrong token should fail", err)
+	}
+	if err := controllers[1].Unlock("job", l.Token); err != nil {
+		t.Fatal("check unlock", err)
+	}
+	l2, err := controllers[1].Lock("job", time.Minute)
+	if err != nil || l2.Token <= l.Token {
+		t.Fatal("token should increase", l2, err)
+	}
+}
+
+func TestLockExpire(t *testing.T) {
+	controllers, _ := newCluster(t, "lock-expire", 2, 1)
+	l, _ := controllers[0].Lock("job", 50*time.Millisecond)
+	// 持有者挂掉不再续期, 锁过期后其他调用者可以加锁
+	time.Sleep(60 * time.Millisecond)
+	if _, err := controllers[1].Lock("job", time.Minute); err != nil {
+		t.Fatal("lock should expire", err)
+	}
+	if _, err := controllers[0].Refresh("job", l.Token, time.Minute); err == nil {
+		t.Fatal("expired holder should not refresh")
+	}
+}
+
+// 归属节点挂掉后锁丢失: 副本节点接管后其他调用者可以立即加锁, 原持有者需依靠fencing token
+func TestLockLostOnFailover(t *testing.T) {
+	controllers, servers := newCluster(t, "lock-failover", 2, 2)
+	ownerUrl := controllers[0].nodePool.PickNodes("job", 1)[0]
+	var other *Controller
+	for _, c := range controllers {
+		if c.nodePool.self() != ownerUrl {
+			other = c
+		}
+	}
+	l, err := other.Lock("job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		if s.URL == ownerUrl {
+			s.Close()
+		}
+	}
+
+	l2, err := other.Lock("job", time.Minute)
+	if err != nil {
+		t.Fatal("replica should take over and grant the lock", err)
+	}
+	if l2.Token <= l.Token {
+		t.Fatal("new token should be larger than the lost one", l, l2)
+	}
+	_, err = other.Refresh("job", l.Token, time.Minute)
+	if code, ok := response.ErrCode(err); !ok || code != response.LOCK_NOT_HELD {
+		t.Fatal("old holder should lose the lock", err)
+	}
+}
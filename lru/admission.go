@@ -0,0 +1,125 @@
+package lru
+
+import "hash/fnv"
+
+// 准入策略: 缓存已满时决定新数据是否值得替换即将被淘汰的数据
+// 在持有缓存锁的情况下调用, 无需自行加锁
+type Admission interface {
+	// 记录一次访问(命中或未命中)
+	Record(key string)
+	// 新数据candidate是否可以替换victim
+	Admit(candidate string, victim string) bool
+}
+
+// 计数器上限, 与4bit计数器一致
+const maxCount = 15
+
+// TinyLFU: doorkeeper过滤只访问过一次的key, count-min sketch估算访问频率
+// 访问次数达到样本上限后计数减半, 使频率随时间衰减
+type TinyLFU struct {
+	door    []uint64
+	sketch  [4][]uint8
+	mask    uint64
+	samples int
+	limit   int
+}
+
+// size为预计的缓存条数
+func NewTinyLFU(size int) *TinyLFU {
+	width := 64
+	for width < size {
+		width <<= 1
+	}
+	t := &TinyLFU{
+		// 每个key约占8bit
+		door:  make([]uint64, width/8),
+		mask:  uint64(width - 1),
+		limit: 10 * width,
+	}
+	for i := range t.sketch {
+		t.sketch[i] = make([]uint8, width)
+	}
+	return t
+}
+
+func hashKey(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
+
+// 第一次访问只写入doorkeeper, 之后才计入sketch
+func (t *TinyLFU) Record(key string) {
+	h1, h2 := hashKey(key)
+	if t.doorAdd(h1, h2) {
+		for i := range t.sketch {
+			idx := (h1 + uint64(i)*h2) & t.mask
+			if t.sketch[i][idx] < maxCount {
+				t.sketch[i][idx]++
+			}
+		}
+	}
+	t.samples++
+	if t.samples >= t.limit {
+		t.reset()
+	}
+}
+
+func (t *TinyLFU) Admit(candidate string, victim string) bool {
+	return t.Estimate(candidate) > t.Estimate(victim)
+}
+
+// 估算key的访问频率
+func (t *TinyLFU) Estimate(key string) int {
+	h1, h2 := hashKey(key)
+	min := uint8(maxCount)
+	for i := range t.sketch {
+		if v := t.sketch[i][(h1+uint64(i)*h2)&t.mask]; v < min {
+			min = v
+		}
+	}
+	n := int(min)
+	if t.doorHas(h1, h2) {
+		n++
+	}
+	return n
+}
+
+// 写入doorkeeper, 返回写入前是否已存在
+func (t *TinyLFU) doorAdd(h1, h2 uint64) bool {
+	bits := uint64(len(t.door) * 64)
+	exist := true
+	for i := uint64(0); i < 3; i++ {
+		bit := (h1 + i*h2) % bits
+		if t.door[bit/64]&(1<<(bit%64)) == 0 {
+			exist = false
+			t.door[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return exist
+}
+
+func (t *TinyLFU) doorHas(h1, h2 uint64) bool {
+	bits := uint64(len(t.door) * 64)
+	for i := uint64(0); i < 3; i++ {
+		bit := (h1 + i*h2) % bits
+		if t.door[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 计数减半并清空doorkeeper
+func (t *TinyLFU) reset() {
+	t.samples = 0
+	for i := range t.door {
+		t.door[i] = 0
+	}
+	for i := range t.sketch {
+		for j := range t.sketch[i] {
+			t.sketch[i][j] >>= 1
+		}
+	}
+}
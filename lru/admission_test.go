@@ -0,0 +1,85 @@
+package lru
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTinyLFU(t *testing.T) {
+	tlfu := NewTinyLFU(100)
+	for i := 0; i < 5; i++ {
+		tlfu.Record("hot")
+	}
+	tlfu.Record("cold")
+	if tlfu.Estimate("hot") != 5 || tlfu.Estimate("cold") != 1 || tlfu.Estimate("none") != 0 {
+		t.Fatal("check estimate", tlfu.Estimate("hot"), tlfu.Estimate("cold"))
+	}
+	if tlfu.Admit("cold", "hot") || !tlfu.Admit("hot", "cold") {
+		t.Fatal("check admit")
+	}
+	// 达到样本上限后计数减半
+	for i := 0; i < tlfu.limit; i++ {
+		tlfu.Record("other")
+	}
+	if n := tlfu.Estimate("hot"); n >= 5 {
+		t.Fatal("frequency should decay", n)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	reasons := make([]string, 0)
+	lru := New(2*(len("k1"+"v1")+EntryOverhead), func(key string, value string) {
+		reasons = append(reasons, "evicted:"+key)
+	})
+	lru.OnRejected = func(key string, value string, reason EvictReason) {
+		reasons = append(reasons, string(reason)+":"+key)
+	}
+	lru.Admission = NewTinyLFU(10)
+	lru.Set("k1", "v1")
+	lru.Set("k2", "v2")
+	for i := 0; i < 3; i++ {
+		lru.Get("k1")
+		lru.Get("k2")
+	}
+	// 缓存已满, 访问次数少的新数据被拒绝
+	if lru.Admit("k3", "v3") || lru.Len() != 2 {
+		t.Fatal("k3 should be rejected")
+	}
+	for i := 0; i < 5; i++ {
+		lru.Get("k3")
+	}
+	if !lru.Admit("k3", "v3") {
+		t.Fatal("k3 should be admitted")
+	}
+	lru.Set("k3", "v3")
+	if !reflect.DeepEqual(reasons, []string{"rejected:k3", "evicted:k1"}) {
+		t.Fatal("check reasons", reasons)
+	}
+}
+
+func TestMaxEntrySize(t *testing.T) {
+	reasons := make([]string, 0)
+	lru := New(0, nil)
+	lru.OnRejected = func(key string, value string, reason EvictReason) {
+		reasons = append(reasons, string(reason)+":"+key)
+	}
+	lru.MaxEntrySize = len("key"+"value") + EntryOverhead
+	lru.Set("key", "value")
+	lru.Set("other", "v")
+	// 超过上限的新值被拒绝, 旧值也被删除
+	lru.Set("key", strings.Repeat("v", 100))
+	if _, ok := lru.Get("key"); ok || lru.Len() != 1 {
+		t.Fatal("oversized value should be rejected")
+	}
+	if !reflect.DeepEqual(reasons, []string{"too_large:key"}) {
+		t.Fatal("check reasons", reasons)
+	}
+
+	// 大于整个缓存的值不会清空缓存
+	lru = New(len("key"+"value")+EntryOverhead, nil)
+	lru.Set("key", "value")
+	if reason := lru.SetEntry(Entry{Key: "big", Value: strings.Repeat("v", 100)}); reason != ReasonTooLarge || lru.Len() != 1 {
+		t.Fatal("value larger than cache should be rejected", reason)
+	}
+}
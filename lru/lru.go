@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"time"
 )
 
 type Cache struct {
@@ -11,15 +12,77 @@ type Cache struct {
 	size  int
 	list  *list.List
 	cache map[string]*list.Element
-	// 被删除时触发
+	// 单条缓存项允许的最大空间, 0表示只受maxSize限制  单位字节
+	MaxEntrySize int
+	// 准入策略, 为nil表示全部接受; 只作用于经Admit判断的新加载的数据
+	Admission Admission
+	// 超出maxSize被淘汰时触发
 	OnEvicted OnEvictedFunc
+	// 拒绝写入时触发, 附带拒绝的原因
+	OnRejected OnRejectedFunc
+	// 每次变更(写入、删除、过期、淘汰)时触发, 在持有锁的情况下调用, 不能阻塞
+	// 过期是惰性的: 只在读取或写入到已过期的key时删除并触发OpExpire
+	OnChange OnChangeFunc
+	// 计算缓存项大小, 默认为DefaultSizer; 应在写入数据之前设置
+	Sizer Sizer
+	// 版本时钟, 每次写入递增; 写入更大的外部版本时跟随前进
+	clock uint64
+	// 标签索引
+	tags tagIndex
 }
 
 type OnEvictedFunc func(key string, value string)
 
+type OnRejectedFunc func(key string, value string, reason EvictReason)
+
+// 拒绝写入的原因
+type EvictReason string
+
+const (
+	// 超过单条大小上限, 拒绝写入
+	ReasonTooLarge EvictReason = "too_large"
+	// 准入策略拒绝写入
+	ReasonRejected EvictReason = "rejected"
+)
+
+type OnChangeFunc func(op Op, e Entry)
+
+// 变更类型
+type Op string
+
+const (
+	OpSet    Op = "set"
+	OpDelete Op = "delete"
+	OpExpire Op = "expire"
+	OpEvict  Op = "evict"
+)
+
 type entry struct {
-	key   string
-	value string
+	key     string
+	value   string
+	version uint64
+	// 过期时间 UnixNano, 0表示永不过期
+	expire int64
+	tags   []string
+	// 写入时由Sizer计算的大小
+	size int
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expire != 0 && e.expire <= now
+}
+
+// Entry 对外暴露的缓存项,用于节点间迁移
+type Entry struct {
+	Key     string   `json:"key"`
+	Value   string   `json:"value"`
+	Version uint64   `json:"version"`
+	Expire  int64    `json:"expire,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func (e *entry) export() Entry {
+	return Entry{Key: e.key, Value: e.value, Version: e.version, Expire: e.expire, Tags: e.tags}
 }
 
 func New(maxSize int, onEvicted OnEvictedFunc) *Cache {
@@ -29,6 +92,8 @@ func New(maxSize int, onEvicted OnEvictedFunc) *Cache {
 		list:      list.New(),
 		cache:     make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		Sizer:     DefaultSizer{},
+		tags:      make(tagIndex),
 	}
 }
 
@@ -37,14 +102,59 @@ func (c *Cache) Len() int {
 	return c.list.Len()
 }
 
+// 查找未过期的缓存项, 已过期的顺便删除
+func (c *Cache) lookup(key string) (*list.Element, bool) {
+	if c.Admission != nil {
+		c.Admission.Record(key)
+	}
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if ele.Value.(*entry).expired(time.Now().UnixNano()) {
+		c.removeElement(ele, OpExpire)
+		return nil, false
+	}
+	return ele, true
+}
+
 func (c *Cache) Get(key string) (value string, ok bool) {
-	if ele, ok := c.cache[key]; ok {
+	if ele, ok := c.lookup(key); ok {
 		c.list.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		return kv.value, true
 	}
 	return
 }
+
+// 同Get, 额外返回版本号
+func (c *Cache) GetWithVersion(key string) (value string, version uint64, ok bool) {
+	if ele, ok := c.lookup(key); ok {
+		c.list.MoveToFront(ele)
+		kv := ele.Value.(*entry)
+		return kv.value, kv.version, true
+	}
+	return
+}
+
+// 同Get, 返回完整的缓存项
+func (c *Cache) GetEntry(key string) (Entry, bool) {
+	if ele, ok := c.lookup(key); ok {
+		c.list.MoveToFront(ele)
+		return ele.Value.(*entry).export(), true
+	}
+	return Entry{}, false
+}
+
+// 读取未过期的缓存项, 不更新访问顺序, 也不删除已过期的数据
+func (c *Cache) Peek(key string) (Entry, bool) {
+	ele, ok := c.cache[key]
+	if !ok || ele.Value.(*entry).expired(time.Now().UnixNano()) {
+		return Entry{}, false
+	}
+	return ele.Value.(*entry).export(), true
+}
+
 func (c *Cache) GetAll() map[string]string {
 	copy := make(map[string]string)
 	for k, v := range c.cache {
@@ -53,41 +163,173 @@ func (c *Cache) GetAll() map[string]string {
 	return copy
 }
 
+// 按最近访问顺序(热度从高到低)返回至多n个缓存项, n<=0 表示全部
+func (c *Cache) Hottest(n int) []Entry {
+	if n <= 0 || n > c.list.Len() {
+		n = c.list.Len()
+	}
+	now := time.Now().UnixNano()
+	entries := make([]Entry, 0, n)
+	for ele := c.list.Front(); ele != nil && len(entries) < n; ele = ele.Next() {
+		if kv := ele.Value.(*entry); !kv.expired(now) {
+			entries = append(entries, kv.export())
+		}
+	}
+	return entries
+}
+
 func (c *Cache) Remove(key string) {
 	if ele, ok := c.cache[key]; ok {
-		value := ele.Value.(*entry).value
-		c.size -= (len(value) + len(key))
-		c.list.Remove(ele)
-		delete(c.cache, key)
+		c.removeElement(ele, OpDelete)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element, op Op) {
+	kv := ele.Value.(*entry)
+	c.size -= kv.size
+	c.list.Remove(ele)
+	delete(c.cache, kv.key)
+	c.tags.remove(kv.key, kv.tags)
+	c.emit(op, kv)
+}
+
+func (c *Cache) emit(op Op, kv *entry) {
+	if c.OnChange != nil {
+		c.OnChange(op, kv.export())
 	}
 }
 
-func (c *Cache) Set(key string, value string) {
+// 写入并返回新的版本号; 超过单条大小上限时不写入, 见SetEntry
+func (c *Cache) Set(key string, value string) uint64 {
+	c.clock++
+	version := c.clock
+	c.SetWithVersion(key, value, version)
+	return version
+}
+
+// 按准入策略判断新加载的数据是否可以写入, 拒绝时触发OnRejected(ReasonRejected)
+func (c *Cache) Admit(key string, value string) bool {
+	if _, ok := c.cache[key]; ok || c.Admission == nil || c.maxSize == 0 {
+		return true
+	}
+	size := c.Sizer.Size(key, value)
+	if ele := c.list.Back(); ele != nil && c.size+size > c.maxSize && c.fits(size) {
+		if !c.Admission.Admit(key, ele.Value.(*entry).key) {
+			c.reject(key, value, ReasonRejected)
+			return false
+		}
+	}
+	return true
+}
+
+// 生成新的版本号, 用于不对应缓存项的操作, 例如删除记录
+func (c *Cache) NextVersion() uint64 {
+	c.clock++
+	return c.clock
+}
+
+// 使之后生成的版本号大于version, 用于同步其他节点的删除
+func (c *Cache) Observe(version uint64) {
+	if version > c.clock {
+		c.clock = version
+	}
+}
+
+func (c *Cache) fits(size int) bool {
+	return (c.MaxEntrySize == 0 || size <= c.MaxEntrySize) && (c.maxSize == 0 || size <= c.maxSize)
+}
+
+func (c *Cache) reject(key string, value string, reason EvictReason) {
+	if c.OnRejected != nil {
+		c.OnRejected(key, value, reason)
+	}
+}
+
+// 以指定版本写入, 用于同步其他节点的数据; 已存在的key保留原有的过期时间和标签
+func (c *Cache) SetWithVersion(key string, value string, version uint64) EvictReason {
+	e := Entry{Key: key, Value: value, Version: version}
+	if ele, ok := c.lookup(key); ok {
+		kv := ele.Value.(*entry)
+		e.Expire, e.Tags = kv.expire, kv.tags
+	}
+	return c.SetEntry(e)
+}
+
+// 设置过期时间 UnixNano, 0表示永不过期; key不存在时返回false
+// 同时生成新的版本号, 使其他节点上的旧副本可以被覆盖
+func (c *Cache) Touch(key string, expire int64) (uint64, bool) {
+	ele, ok := c.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	c.clock++
+	kv := ele.Value.(*entry)
+	kv.version = c.clock
+	kv.expire = expire
+	c.list.MoveToFront(ele)
+	c.emit(OpSet, kv)
+	return kv.version, true
+}
+
+// 按缓存项原样写入(版本号、过期时间、标签)
+// 超过单条大小上限时拒绝写入并删除已有的旧数据, 返回ReasonTooLarge
+func (c *Cache) SetEntry(e Entry) EvictReason {
+	return c.setEntry(e, true)
+}
+
+// 同SetEntry, 用于读回其他层(如磁盘)中原有的数据, 不触发OnChange(OpSet); 因此被淘汰的数据仍会触发OpEvict
+func (c *Cache) Promote(e Entry) EvictReason {
+	return c.setEntry(e, false)
+}
+
+func (c *Cache) setEntry(e Entry, emit bool) EvictReason {
+	key, value := e.Key, e.Value
+	if e.Version > c.clock {
+		c.clock = e.Version
+	}
+	size := c.Sizer.Size(key, value)
+	if !c.fits(size) {
+		c.Remove(key)
+		c.reject(key, value, ReasonTooLarge)
+		return ReasonTooLarge
+	}
 	if ele, ok := c.cache[key]; ok {
 		c.list.MoveToFront(ele)
 		kv := ele.Value.(*entry)
-		c.size += (len(value) - len(kv.value))
+		c.size += size - kv.size
+		kv.size = size
 		kv.value = value
+		kv.version = e.Version
+		kv.expire = e.Expire
+		c.tags.remove(key, kv.tags)
+		kv.tags = e.Tags
 	} else {
 		ele := c.list.PushFront(&entry{
-			key:   key,
-			value: value,
+			key:     key,
+			value:   value,
+			version: e.Version,
+			expire:  e.Expire,
+			tags:    e.Tags,
+			size:    size,
 		})
 		c.cache[key] = ele
-		c.size += (len(key) + len(value))
+		c.size += size
+	}
+	c.tags.add(key, e.Tags)
+	if emit {
+		c.emit(OpSet, c.cache[key].Value.(*entry))
 	}
 	// 新添加 || 更新 都有可能触发
 	for c.maxSize != 0 && c.maxSize < c.size {
 		c.removeBack()
 	}
+	return ""
 }
 
 func (c *Cache) removeBack() {
 	if ele := c.list.Back(); ele != nil {
-		c.list.Remove(ele)
+		c.removeElement(ele, OpEvict)
 		kv := ele.Value.(*entry)
-		c.size -= (len(kv.key) + len(kv.value))
-		delete(c.cache, kv.key)
 		if c.OnEvicted != nil {
 			c.OnEvicted(kv.key, kv.value)
 		}
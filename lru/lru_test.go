@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGet(t *testing.T) {
@@ -31,7 +32,7 @@ func TestGet(t *testing.T) {
 func TestRemoveBack(t *testing.T) {
 	k := []string{"key1", "key2", "k3"}
 	v := []string{"value1", "value2", "v3"}
-	lru := New(len(k[0]+v[0]+k[1]+v[1]), nil)
+	lru := New(len(k[0]+v[0]+k[1]+v[1])+2*EntryOverhead, nil)
 	for i := 0; i < len(k); i++ {
 		lru.Set(k[i], v[i])
 	}
@@ -50,7 +51,7 @@ func TestOnEvicted(t *testing.T) {
 	}
 	k := []string{"key1", "key2"}
 	v := []string{"value1", "value2"}
-	lru := New(len(k[0]+v[0]), callback)
+	lru := New(len(k[0]+v[0])+EntryOverhead, callback)
 	for i := 0; i < len(k); i++ {
 		lru.Set(k[i], v[i])
 	}
@@ -59,3 +60,137 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatal("check keys", keys)
 	}
 }
+
+func TestHottest(t *testing.T) {
+	lru := New(0, nil)
+	lru.Set("key1", "value1")
+	lru.Set("key2", "value2")
+	lru.Set("key3", "value3")
+	lru.Get("key1")
+
+	hot := lru.Hottest(2)
+	if len(hot) != 2 || hot[0].Key != "key1" || hot[1].Key != "key3" {
+		t.Fatal("check hottest order", hot)
+	}
+	if all := lru.Hottest(0); len(all) != 3 || all[2].Key != "key2" {
+		t.Fatal("check hottest all", all)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	lru := New(0, nil)
+	v1 := lru.Set("key1", "value1")
+	v2 := lru.Set("key2", "value2")
+	v3 := lru.Set("key1", "value3")
+	if !(v1 < v2 && v2 < v3) {
+		t.Fatal("version must increase", v1, v2, v3)
+	}
+	lru.SetWithVersion("key2", "remote", 100)
+	if value, version, ok := lru.GetWithVersion("key2"); !ok || value != "remote" || version != 100 {
+		t.Fatal("check SetWithVersion", value, version)
+	}
+	if v := lru.Set("key3", "value3"); v <= 100 {
+		t.Fatal("clock must follow remote version", v)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lru := New(0, nil)
+	lru.Set("key1", "value1")
+	lru.Set("key2", "value2")
+	lru.Touch("key1", time.Now().Add(10*time.Millisecond).UnixNano())
+	lru.Set("key1", "value3")
+	if e, ok := lru.GetEntry("key1"); !ok || e.Value != "value3" || e.Expire == 0 {
+		t.Fatal("update should keep expire", e)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatal("key1 should be expired")
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatal("key2 never expires")
+	}
+}
+
+func TestScan(t *testing.T) {
+	lru := New(0, nil)
+	for _, k := range []string{"user:3", "order:1", "user:1", "user:2", "user:10"} {
+		lru.Set(k, k)
+	}
+	keys, next := lru.Scan("user:", "", 3)
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:10", "user:2"}) || next != "user:2" {
+		t.Fatal("check first page", keys, next)
+	}
+	keys, next = lru.Scan("user:", next, 3)
+	if !reflect.DeepEqual(keys, []string{"user:3"}) || next != "" {
+		t.Fatal("check last page", keys, next)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	ops := make([]string, 0)
+	lru := New(len("key1"+"value1")+EntryOverhead, nil)
+	lru.OnChange = func(op Op, e Entry) {
+		ops = append(ops, string(op)+":"+e.Key)
+	}
+	lru.Set("key1", "value1")
+	lru.Set("key2", "value2")
+	lru.Touch("key2", time.Now().Add(-time.Second).UnixNano())
+	lru.Get("key2")
+	lru.Set("key3", "v3")
+	lru.Remove("key3")
+
+	want := []string{"set:key1", "set:key2", "evict:key1", "set:key2", "expire:key2", "set:key3", "delete:key3"}
+	if !reflect.DeepEqual(want, ops) {
+		t.Fatal("check ops", ops)
+	}
+}
+
+func TestSizer(t *testing.T) {
+	lru := New(0, nil)
+	lru.Set("key", "value")
+	if lru.Size() != len("key"+"value")+EntryOverhead {
+		t.Fatal("check default size", lru.Size())
+	}
+	lru.Set("key", "v")
+	lru.Remove("key")
+	if lru.Size() != 0 {
+		t.Fatal("size should be 0 after remove", lru.Size())
+	}
+
+	lru = New(len("k1"+"v1"+"k2"+"v2"), nil)
+	lru.Sizer = BytesSizer{}
+	lru.Set("k1", "v1")
+	lru.Set("k2", "v2")
+	if lru.Len() != 2 || lru.Size() != 8 {
+		t.Fatal("check BytesSizer", lru.Len(), lru.Size())
+	}
+	if !lru.RemoveOldest() || lru.Len() != 1 {
+		t.Fatal("check RemoveOldest")
+	}
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatal("k1 should be removed")
+	}
+
+	lru.Set("k3", "v3")
+	lru.SetMaxSize(len("k3" + "v3"))
+	if lru.Len() != 1 || lru.Size() != 4 {
+		t.Fatal("shrink should evict oldest", lru.Len(), lru.Size())
+	}
+}
+
+func TestTouch(t *testing.T) {
+	lru := New(0, nil)
+	v1 := lru.Set("key", "value")
+	expire := time.Now().Add(time.Minute).UnixNano()
+	v2, ok := lru.Touch("key", expire)
+	if !ok || v2 <= v1 {
+		t.Fatal("touch should bump version", v1, v2)
+	}
+	if e, _ := lru.GetEntry("key"); e.Expire != expire || e.Value != "value" {
+		t.Fatal("check touch", e)
+	}
+	if _, ok := lru.Touch("missing", expire); ok {
+		t.Fatal("missing key should not be touched")
+	}
+}
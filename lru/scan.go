@@ -0,0 +1,70 @@
+package lru
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 大顶堆, 用于在不复制全部key的情况下选出最小的limit个key
+type keyHeap []string
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// 未过期的全部key, 无序
+func (c *Cache) Keys() []string {
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, len(c.cache))
+	for k, ele := range c.cache {
+		if !ele.Value.(*entry).expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// 按key的字典序返回cursor之后以prefix开头的至多limit个key
+// next为本批最后一个key, 作为下一批的cursor; 为空表示遍历结束
+func (c *Cache) Scan(prefix string, cursor string, limit int) (keys []string, next string) {
+	return c.selectKeys(cursor, limit, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// 选出cursor之后满足match的最小的limit个key(按字典序), limit<=0 表示全部
+func (c *Cache) selectKeys(cursor string, limit int, match func(key string) bool) (keys []string, next string) {
+	now := time.Now().UnixNano()
+	h := make(keyHeap, 0)
+	more := false
+	for k, ele := range c.cache {
+		if k <= cursor || ele.Value.(*entry).expired(now) || (match != nil && !match(k)) {
+			continue
+		}
+		if limit <= 0 || h.Len() < limit {
+			heap.Push(&h, k)
+			continue
+		}
+		more = true
+		if k < h[0] {
+			h[0] = k
+			heap.Fix(&h, 0)
+		}
+	}
+	keys = []string(h)
+	sort.Strings(keys)
+	if more {
+		next = keys[len(keys)-1]
+	}
+	return keys, next
+}
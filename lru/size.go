@@ -0,0 +1,46 @@
+package lru
+
+// 计算缓存项占用的内存空间 单位字节
+type Sizer interface {
+	Size(key string, value string) int
+}
+
+// 64位平台上每个缓存项的固定开销估算:
+// list.Element(48) + entry(80) + map中的key和指针及桶的摊销(40)
+const EntryOverhead = 168
+
+// 默认的计算方式: key和value的长度加上固定开销
+type DefaultSizer struct{}
+
+func (DefaultSizer) Size(key string, value string) int {
+	return len(key) + len(value) + EntryOverhead
+}
+
+// 只计算key和value的长度, 不含固定开销
+type BytesSizer struct{}
+
+func (BytesSizer) Size(key string, value string) int {
+	return len(key) + len(value)
+}
+
+// 当前占用内存空间 单位字节
+func (c *Cache) Size() int {
+	return c.size
+}
+
+// 淘汰最久未访问的缓存项, 缓存为空时返回false
+func (c *Cache) RemoveOldest() bool {
+	if c.list.Len() == 0 {
+		return false
+	}
+	c.removeBack()
+	return true
+}
+
+// 修改容量, 缩小时立即淘汰最久未访问的缓存项; 0表示不限制
+func (c *Cache) SetMaxSize(maxSize int) {
+	c.maxSize = maxSize
+	for c.maxSize != 0 && c.maxSize < c.size {
+		c.removeBack()
+	}
+}
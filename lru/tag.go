@@ -0,0 +1,58 @@
+package lru
+
+// 标签 => 带有该标签的key
+type tagIndex map[string]map[string]struct{}
+
+func (t tagIndex) add(key string, tags []string) {
+	for _, tag := range tags {
+		keys, ok := t[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (t tagIndex) remove(key string, tags []string) {
+	for _, tag := range tags {
+		if keys, ok := t[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(t, tag)
+			}
+		}
+	}
+}
+
+// 替换key的标签, key不存在时返回false
+func (c *Cache) SetTags(key string, tags ...string) bool {
+	ele, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	kv := ele.Value.(*entry)
+	c.tags.remove(key, kv.tags)
+	kv.tags = tags
+	c.tags.add(key, tags)
+	c.emit(OpSet, kv)
+	return true
+}
+
+// 带有标签tag的所有key
+func (c *Cache) KeysByTag(tag string) []string {
+	keys := make([]string, 0, len(c.tags[tag]))
+	for key := range c.tags[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// 删除带有标签tag的所有缓存项, 返回删除的个数
+func (c *Cache) RemoveTag(tag string) int {
+	keys := c.KeysByTag(tag)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return len(keys)
+}
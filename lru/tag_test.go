@@ -0,0 +1,38 @@
+package lru
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestRemoveTag(t *testing.T) {
+	lru := New(0, nil)
+	lru.Set("product:1:price", "10")
+	lru.Set("product:1:detail", "detail")
+	lru.Set("product:2:price", "20")
+	lru.SetTags("product:1:price", "product:1", "price")
+	lru.SetTags("product:1:detail", "product:1")
+	lru.SetTags("product:2:price", "product:2", "price")
+
+	keys := lru.KeysByTag("price")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "product:1:price" || keys[1] != "product:2:price" {
+		t.Fatal("check KeysByTag", keys)
+	}
+	if n := lru.RemoveTag("product:1"); n != 2 || lru.Len() != 1 {
+		t.Fatal("check RemoveTag", n, lru.Len())
+	}
+	if keys := lru.KeysByTag("price"); len(keys) != 1 || keys[0] != "product:2:price" {
+		t.Fatal("tag index should be cleaned", keys)
+	}
+}
+
+func TestTagCleanedOnEvicted(t *testing.T) {
+	lru := New(len("k1"+"v1")+EntryOverhead, nil)
+	lru.Set("k1", "v1")
+	lru.SetTags("k1", "tag")
+	lru.Set("k2", "v2")
+	if keys := lru.KeysByTag("tag"); len(keys) != 0 || len(lru.tags) != 0 {
+		t.Fatal("tag index should be cleaned on evicted", keys)
+	}
+}
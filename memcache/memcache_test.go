@@ -0,0 +1,139 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	zkcache "zkCache"
+)
+
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, name string) *client {
+	c := zkcache.NewController(name, 0, func(key string) (string, error) {
+		return "", fmt.Errorf("%s not exist", key)
+	}, nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(c)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// 发送请求并读取lines行响应, 以 | 连接
+func (c *client) do(t *testing.T, req string, lines int) string {
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	resp := make([]string, 0, lines)
+	for i := 0; i < lines; i++ {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp = append(resp, strings.TrimRight(line, "\r\n"))
+	}
+	return strings.Join(resp, "|")
+}
+
+func TestStorage(t *testing.T) {
+	c := dial(t, "memcache-storage")
+	cases := []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"set k 0 0 1\r\na\r\n", 1, "STORED"},
+		{"get k missing\r\n", 3, "VALUE k 0 1|a|END"},
+		{"add k 0 0 1\r\nb\r\n", 1, "NOT_STORED"},
+		{"add k2 0 0 1\r\nb\r\n", 1, "STORED"},
+		{"replace missing 0 0 1\r\nc\r\n", 1, "NOT_STORED"},
+		{"replace k 0 0 1\r\nc\r\n", 1, "STORED"},
+		{"get k k2\r\n", 5, "VALUE k 0 1|c|VALUE k2 0 1|b|END"},
+		{"delete k2\r\n", 1, "DELETED"},
+		{"delete k2\r\n", 1, "NOT_FOUND"},
+		{"set n 0 0 2\r\n10\r\n", 1, "STORED"},
+		{"incr n 5\r\n", 1, "15"},
+		{"decr n 20\r\n", 1, "0"},
+		{"incr k 1\r\n", 1, "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		{"incr missing 1\r\n", 1, "NOT_FOUND"},
+		{"touch k 100\r\n", 1, "TOUCHED"},
+		{"touch missing 100\r\n", 1, "NOT_FOUND"},
+		{"set k 0 0 1 noreply\r\nd\r\nget k\r\n", 3, "VALUE k 0 1|d|END"},
+		{"set k 0 0 2\r\nabc\r\n", 1, "CLIENT_ERROR bad data chunk"},
+		{"unknown\r\n", 1, "ERROR"},
+		{"version\r\n", 1, "VERSION zkcache"},
+	}
+	for _, tc := range cases {
+		if got := c.do(t, tc.req, tc.lines); got != tc.want {
+			t.Fatalf("%q: want %q, got %q", tc.req, tc.want, got)
+		}
+	}
+}
+
+func TestCas(t *testing.T) {
+	c := dial(t, "memcache-cas")
+	c.do(t, "set k 0 0 1\r\na\r\n", 1)
+	var version uint64
+	line := c.do(t, "gets k\r\n", 3)
+	fmt.Sscanf(line, "VALUE k 0 1 %d", &version)
+	if version == 0 {
+		t.Fatal("check gets", line)
+	}
+	if got := c.do(t, fmt.Sprintf("cas k 0 0 1 %d\r\nb\r\n", version+100), 1); got != "EXISTS" {
+		t.Fatal("stale cas should fail", got)
+	}
+	if got := c.do(t, fmt.Sprintf("cas k 0 0 1 %d\r\nb\r\n", version), 1); got != "STORED" {
+		t.Fatal("check cas", got)
+	}
+	if got := c.do(t, fmt.Sprintf("cas missing 0 0 1 %d\r\nb\r\n", version), 1); got != "NOT_FOUND" {
+		t.Fatal("cas on missing key", got)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := dial(t, "memcache-expire")
+	c.do(t, "set k 0 -1 1\r\na\r\n", 1)
+	if got := c.do(t, "get k\r\n", 1); got != "END" {
+		t.Fatal("negative exptime should expire immediately", got)
+	}
+	// 超过30天视为unix时间戳
+	c.do(t, fmt.Sprintf("set k 0 %d 1\r\na\r\n", time.Now().Add(time.Hour).Unix()), 1)
+	if got := c.do(t, "get k\r\n", 3); got != "VALUE k 0 1|a|END" {
+		t.Fatal("absolute exptime", got)
+	}
+	// 与memcached一致, exptime为0时清除原有的过期时间
+	controller, _ := zkcache.GetController("memcache-expire")
+	c.do(t, "set k 0 100 1\r\na\r\n", 1)
+	c.do(t, "set k 0 0 1\r\na\r\n", 1)
+	if e, _ := controller.GetLocal("k"); e.Expire != 0 {
+		t.Fatal("set with exptime 0 should clear expire", e)
+	}
+	c.do(t, "set k 0 100 1\r\na\r\n", 1)
+	e, _ := controller.GetLocal("k")
+	if got := c.do(t, fmt.Sprintf("cas k 0 0 1 %d\r\nb\r\n", e.Version), 1); got != "STORED" {
+		t.Fatal("check cas", got)
+	}
+	if e, _ := controller.GetLocal("k"); e.Expire != 0 || e.Value != "b" {
+		t.Fatal("cas with exptime 0 should clear expire", e)
+	}
+	if ttl, del := expireTTL(time.Now().Add(-time.Hour).Unix()); !del || ttl > 0 {
+		t.Fatal("past timestamp should expire", ttl)
+	}
+	if ttl, _ := expireTTL(60); ttl != time.Minute {
+		t.Fatal("relative exptime", ttl)
+	}
+}
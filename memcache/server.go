@@ -0,0 +1,413 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	zkcache "zkCache"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 单个value的最大长度
+	maxValueLen = 1 << 20
+	// 超过该秒数的exptime视为unix时间戳
+	relativeExpireLimit = 30 * 24 * 3600
+	// incr/decr 版本冲突时的重试次数
+	casRetry = 10
+)
+
+// memcached文本协议的TCP服务, 命令映射到Controller上; 不支持二进制协议
+// 不保存flags(读取时总是返回0); cas unique即缓存项的版本号; 与memcached一致, 写入时exptime为0表示永不过期
+type Server struct {
+	controller *zkcache.Controller
+	mu         sync.Mutex
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+}
+
+func NewServer(controller *zkcache.Controller) *Server {
+	return &Server{controller: controller, conns: make(map[net.Conn]struct{})}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// 处理连接直到Close, Close之后返回nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// 关闭监听和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+type session struct {
+	s *Server
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	sess := &session{s: s, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	for {
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				zklog.Logger.WithFields(logrus.Fields{
+					"remote": conn.RemoteAddr().String(),
+					"err":    err.Error(),
+				}).Debug("memcache connection closed")
+			}
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			sess.reply("ERROR")
+		} else if strings.ToLower(args[0]) == "quit" {
+			sess.w.Flush()
+			return
+		} else if !sess.exec(strings.ToLower(args[0]), args[1:]) {
+			sess.w.Flush()
+			return
+		}
+		if err := sess.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *session) reply(line string) {
+	c.w.WriteString(line + "\r\n")
+}
+
+// 返回false时关闭连接
+func (c *session) exec(name string, args []string) bool {
+	switch name {
+	case "get", "gets":
+		if len(args) == 0 {
+			c.reply("ERROR")
+			return true
+		}
+		c.get(args, name == "gets")
+	case "set", "add", "replace", "cas":
+		return c.store(name, args)
+	case "delete":
+		c.delete(args)
+	case "incr", "decr":
+		c.incr(args, name == "incr")
+	case "touch":
+		c.touch(args)
+	case "version":
+		c.reply("VERSION zkcache")
+	default:
+		c.reply("ERROR")
+	}
+	return true
+}
+
+func (c *session) get(keys []string, withCas bool) {
+	for _, key := range keys {
+		if withCas {
+			v, version, err := c.s.controller.GetWithVersion(key)
+			if err == nil {
+				fmt.Fprintf(c.w, "VALUE %s 0 %d %d\r\n%s\r\n", key, len(v), version, v)
+			}
+			continue
+		}
+		if v, err := c.s.controller.Get(key, 0); err == nil {
+			fmt.Fprintf(c.w, "VALUE %s 0 %d\r\n%s\r\n", key, len(v), v)
+		}
+	}
+	c.reply("END")
+}
+
+// <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (c *session) store(name string, args []string) bool {
+	n := 4
+	if name == "cas" {
+		n = 5
+	}
+	if len(args) < n || len(args) > n+1 {
+		c.reply("ERROR")
+		return true
+	}
+	noreply := len(args) == n+1 && args[n] == "noreply"
+	key := args[0]
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	size, sizeErr := strconv.Atoi(args[3])
+	if flagsErr != nil || expErr != nil || sizeErr != nil || size < 0 {
+		c.reply("CLIENT_ERROR bad command line format")
+		return true
+	}
+	if size > maxValueLen {
+		c.reply("SERVER_ERROR object too large for cache")
+		// 数据块无法跳过, 关闭连接
+		return false
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return false
+	}
+	if string(buf[size:]) != "\r\n" {
+		// 丢弃数据块的剩余部分
+		if buf[size+1] != '\n' {
+			c.r.ReadString('\n')
+		}
+		c.reply("CLIENT_ERROR bad data chunk")
+		return true
+	}
+	value := string(buf[:size])
+	// 过期时间与写入一起生效, 已过期时写入后删除
+	ttl, expired := expireTTL(exptime)
+
+	var result string
+	var err error
+	switch name {
+	case "set":
+		result, err = "STORED", c.s.controller.SetWithTTL(key, value, ttl)
+	case "add":
+		result, err = c.compareAndSet(key, 0, value, ttl)
+	case "replace":
+		e, found, perr := c.s.controller.Peek(key)
+		switch {
+		case perr != nil:
+			err = perr
+		case !found:
+			result = "NOT_STORED"
+		default:
+			if result, err = c.compareAndSet(key, e.Version, value, ttl); result == "NOT_FOUND" {
+				result = "NOT_STORED"
+			}
+		}
+	case "cas":
+		unique, perr := strconv.ParseUint(args[4], 10, 64)
+		if perr != nil {
+			c.reply("CLIENT_ERROR bad command line format")
+			return true
+		}
+		result, err = c.compareAndSet(key, unique, value, ttl)
+		if result == "NOT_STORED" {
+			result = "EXISTS"
+		}
+	}
+	if err == nil && result == "STORED" && expired {
+		_, err = c.s.controller.Delete(key)
+	}
+	if noreply {
+		return true
+	}
+	if err != nil {
+		c.serverError(err)
+		return true
+	}
+	c.reply(result)
+	return true
+}
+
+// CompareAndSet的结果: STORED / NOT_STORED(版本不一致) / NOT_FOUND(cas时key已不存在)
+// ttl为0时保留原有的过期时间
+func (c *session) compareAndSet(key string, expected uint64, value string, ttl time.Duration) (string, error) {
+	_, err := c.s.controller.CompareAndSetWithTTL(key, expected, value, ttl)
+	if err == nil {
+		return "STORED", nil
+	}
+	if code, ok := response.ErrCode(err); !ok || code != response.VERSION_MISMATCH {
+		return "", err
+	}
+	if expected == 0 {
+		return "NOT_STORED", nil
+	}
+	// 版本不一致时再到归属节点确认key是否存在
+	_, found, err := c.s.controller.Peek(key)
+	switch {
+	case err != nil:
+		return "", err
+	case !found:
+		return "NOT_FOUND", nil
+	}
+	return "NOT_STORED", nil
+}
+
+// exptime: 0表示不过期, 不超过30天时为相对秒数, 否则为unix时间戳, 负数表示立即过期
+// 返回ttl(不过期时为zkcache.NoExpire), 以及是否已经过期
+func expireTTL(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return zkcache.NoExpire, false
+	case exptime < 0:
+		return zkcache.NoExpire, true
+	case exptime <= relativeExpireLimit:
+		return time.Duration(exptime) * time.Second, false
+	}
+	ttl := time.Until(time.Unix(exptime, 0))
+	return ttl, ttl <= 0
+}
+
+// delete <key> [noreply]
+func (c *session) delete(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		c.reply("ERROR")
+		return
+	}
+	exist, err := c.s.controller.Delete(args[0])
+	if len(args) == 2 && args[1] == "noreply" {
+		return
+	}
+	switch {
+	case err != nil:
+		c.serverError(err)
+	case exist:
+		c.reply("DELETED")
+	default:
+		c.reply("NOT_FOUND")
+	}
+}
+
+// incr|decr <key> <value> [noreply]
+// 基于版本号重试实现: key不存在返回NOT_FOUND, decr最小为0, 按无符号64位整数计算
+func (c *session) incr(args []string, incr bool) {
+	if len(args) < 2 || len(args) > 3 {
+		c.reply("ERROR")
+		return
+	}
+	noreply := len(args) == 3 && args[2] == "noreply"
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+	result, err := c.update(args[0], delta, incr)
+	if noreply {
+		return
+	}
+	if err != nil {
+		c.serverError(err)
+		return
+	}
+	c.reply(result)
+}
+
+func (c *session) update(key string, delta uint64, incr bool) (string, error) {
+	for i := 0; i < casRetry; i++ {
+		e, found, err := c.s.controller.Peek(key)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "NOT_FOUND", nil
+		}
+		n, err := strconv.ParseUint(e.Value, 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR cannot increment or decrement non-numeric value", nil
+		}
+		if incr {
+			n += delta
+		} else if n < delta {
+			n = 0
+		} else {
+			n -= delta
+		}
+		value := strconv.FormatUint(n, 10)
+		result, err := c.compareAndSet(key, e.Version, value, 0)
+		if err != nil {
+			return "", err
+		}
+		if result == "STORED" {
+			return value, nil
+		}
+	}
+	return "SERVER_ERROR too many concurrent updates", nil
+}
+
+// touch <key> <exptime> [noreply]
+func (c *session) touch(args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		c.reply("ERROR")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid exptime argument")
+		return
+	}
+	var exist bool
+	if ttl, del := expireTTL(exptime); del {
+		exist, err = c.s.controller.Delete(args[0])
+	} else {
+		exist, err = c.s.controller.Touch(args[0], ttl)
+	}
+	if len(args) == 3 && args[2] == "noreply" {
+		return
+	}
+	switch {
+	case err != nil:
+		c.serverError(err)
+	case exist:
+		c.reply("TOUCHED")
+	default:
+		c.reply("NOT_FOUND")
+	}
+}
+
+func (c *session) serverError(err error) {
+	if code, ok := response.ErrCode(err); ok && code == response.ENTRY_TOO_LARGE {
+		c.reply("SERVER_ERROR object too large for cache")
+		return
+	}
+	c.reply("SERVER_ERROR " + strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
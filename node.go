@@ -1,13 +1,26 @@
 package zkcache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
+	"zkCache/consistenthash"
+	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/rpc"
 	"zkCache/zklog"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
@@ -20,33 +33,71 @@ type NodePool struct {
 	url     string
 	coreUrl string
 	mu      sync.Mutex
-	// coreMap *consistenthash.Map
+	coreMap *consistenthash.Map
 	// 存放所有节点,包含本地节点 || 顺序按照hash圆环的顺序,通过定位本地节点来确定遍历的顺序
 	nodes []string
+	// 节点间通信方式, 默认HTTP
+	transport Transport
+	// gRPC传输下按节点复用的连接
+	conns map[string]*grpc.ClientConn
 }
 
-// // 选择真实节点
-// func (n *NodePool) PickRealNode(key string) (string, bool) {
-// 	n.mu.Lock()
-// 	defer n.mu.Unlock()
-// 	if peer := n.coreMap.Get(key); peer != "" && peer != n.url {
-// 		n.Log("Pick node %s", peer)
-// 		return peer, true
-// 	}
-// 	return "", false
-// }
+// 节点间通信方式
+type Transport string
 
-// // 选择真实节点
-// func (n *NodePool) PickFormPool(key string) (string, bool) {
-// 	n.mu.Lock()
-// 	defer n.mu.Unlock()
+const (
+	TransportHTTP Transport = "http"
+	// 需要各节点都提供gRPC服务, 见 NewGRPCServer
+	TransportGRPC Transport = "grpc"
+)
 
-// 	if peer := n.coreMap.Get(key); peer != "" && peer != n.url {
-// 		n.Log("Pick node %s", peer)
-// 		return peer, true
-// 	}
-// 	return "", false
-// }
+// 节点间单次请求的超时时间
+const peerTimeout = 5 * time.Second
+
+// 节点间请求
+var peerClient = &http.Client{Timeout: peerTimeout}
+
+// 选择真实节点, 返回key的归属节点以及是否为远程节点
+func (n *NodePool) PickRealNode(key string) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.coreMap == nil {
+		return "", false
+	}
+	if peer := n.coreMap.Get(key); peer != "" && peer != n.url {
+		return peer, true
+	}
+	return "", false
+}
+
+// 选择key的归属节点及其后继节点, 共至多n个
+func (n *NodePool) PickNodes(key string, count int) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.coreMap == nil {
+		return nil
+	}
+	return n.coreMap.GetN(key, count)
+}
+
+func (n *NodePool) self() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.url
+}
+
+// 除本地节点外的所有节点
+func (n *NodePool) peers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	peers := make([]string, 0, len(n.nodes))
+	for _, node := range n.nodes {
+		if node != n.url {
+			peers = append(peers, node)
+		}
+	}
+	return peers
+}
 
 func (h *NodePool) Get(baseUrl string, group string, key string, code int64) ([]byte, error) {
 
@@ -63,10 +114,11 @@ func (h *NodePool) Get(baseUrl string, group string, key string, code int64) ([]
 	// 	url.QueryEscape(key),
 	// )
 	u := fmt.Sprintf(
-		"%v/api?key=%v&code=%v",
+		"%v/api?key=%v&code=%v&group=%v",
 		baseUrl,
-		key,
+		url.QueryEscape(key),
 		code,
+		url.QueryEscape(group),
 	)
 	zklog.Logger.WithField("request url", u).Debug()
 
@@ -77,15 +129,18 @@ func (h *NodePool) Get(baseUrl string, group string, key string, code int64) ([]
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
-	}
-
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("reading response body: %v", err)
 	}
-
+	if res.StatusCode != http.StatusOK {
+		// 业务错误(如数据不存在)以非200状态码返回, 保留其中的错误码
+		resp := peerResp{}
+		if err := json.Unmarshal(bytes, &resp); err == nil && resp.Code != 0 && resp.Code != response.SUCCESS {
+			return nil, response.NewErrWithMsg(resp.Code, resp.Msg)
+		}
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
 	return bytes, nil
 }
 
@@ -101,25 +156,6 @@ func NewNodePool(url string) *NodePool {
 // }
 
 // func (n *NodePool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-// 	// revicer msg by system callBack      mark: /topicCall/
-// 	// if strings.HasPrefix(r.URL.Path, "/topicCall/") {
-// 	// 	temp := strings.Replace(n.url, "http://", "", -1)
-// 	// 	temp = strings.Replace(temp, "https://", "", -1)
-// 	// 	if temp == r.Host {
-// 	// 		parts := strings.SplitN(r.URL.Path[len("/topicCall/"):], "/", -1)
-// 	// 		if len(parts) != 2 {
-// 	// 			http.Error(w, "bad request", http.StatusBadRequest)
-// 	// 			return
-// 	// 		}
-// 	// 		msg := parts[1]
-// 	// 		// call back print || sub
-// 	// 		fmt.Println(msg)
-// 	// 		w.Header().Set("Content-Type", "application/octet-stream")
-// 	// 		w.Write([]byte(msg + "\n"))
-// 	// 		return
-// 	// 	}
-// 	// }
-
 // 	// search cache
 // 	fmt.Println("??????????????????????")
 // 	if !strings.HasPrefix(r.URL.Path, n.coreUrl) {
@@ -156,9 +192,202 @@ func NewNodePool(url string) *NodePool {
 // 	w.Write([]byte("\n"))
 // }
 
-// func (n *NodePool) Set(addrs ...string) {
-// 	n.mu.Lock()
-// 	defer n.mu.Unlock()
-// 	n.coreMap = consistenthash.New(defaultVirtualNodeCount, nil)
-// 	n.coreMap.Set(addrs...)
-// }
+func (n *NodePool) Set(addrs ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.coreMap = consistenthash.New(defaultVirtualNodeCount, nil)
+	n.coreMap.Set(addrs...)
+	n.nodes = addrs
+	// 关闭已下线节点的连接
+	for node, conn := range n.conns {
+		if !containsNode(addrs, node) {
+			conn.Close()
+			delete(n.conns, node)
+		}
+	}
+}
+
+func (n *NodePool) SetTransport(t Transport) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.transport = t
+}
+
+func (n *NodePool) useGRPC() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.transport == TransportGRPC
+}
+
+// 获取到节点的gRPC客户端, 连接建立后一直复用直到节点下线
+func (n *NodePool) rpcClient(baseUrl string) (rpc.CacheClient, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if conn, ok := n.conns[baseUrl]; ok {
+		return rpc.NewCacheClient(conn), nil
+	}
+	target := strings.TrimPrefix(strings.TrimPrefix(baseUrl, "http://"), "https://")
+	conn, err := grpc.Dial(target, append(rpc.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		return nil, err
+	}
+	if n.conns == nil {
+		n.conns = make(map[string]*grpc.ClientConn)
+	}
+	n.conns[baseUrl] = conn
+	return rpc.NewCacheClient(conn), nil
+}
+
+// 关闭所有gRPC连接
+func (n *NodePool) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for node, conn := range n.conns {
+		conn.Close()
+		delete(n.conns, node)
+	}
+}
+
+// 读取归属节点上的数据, 必要时由归属节点加载; 归属节点找不到数据时返回业务错误
+func (h *NodePool) getValue(baseUrl string, group string, key string, code int64) ([]byte, error) {
+	if h.useGRPC() {
+		client, err := h.rpcClient(baseUrl)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+		defer cancel()
+		resp, err := client.Get(ctx, &rpc.GetRequest{Group: group, Key: key, Code: code})
+		if err != nil {
+			return nil, err
+		}
+		return []byte(resp.Value), nil
+	}
+	view, err := h.Get(baseUrl, group, key, code)
+	if err != nil {
+		return nil, err
+	}
+	value := ValueResp{}
+	if err := json.Unmarshal(view, &value); err != nil {
+		return nil, fmt.Errorf("decoding response: %v", err)
+	}
+	if value.Code != response.SUCCESS {
+		return nil, response.NewErrWithMsg(value.Code, value.Msg)
+	}
+	return []byte(value.Data), nil
+}
+
+// {"code":200,"data":...,"msg":"success"}
+type peerResp struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 向远程节点的内部接口发起POST请求, data非空时解析响应数据, 返回业务错误时也会解析
+func (h *NodePool) post(baseUrl string, path string, group string, body interface{}, data interface{}) error {
+	if h.useGRPC() {
+		return h.postGRPC(baseUrl, path, group, body, data)
+	}
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%v/%v%v?group=%v", baseUrl, h.coreUrl, path, url.QueryEscape(group))
+	zklog.Logger.WithField("request url", u).Debug()
+	res, err := peerClient.Post(u, "application/json", buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resp := peerResp{}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return peerResult(resp.Data, data, businessErr(resp))
+}
+
+func businessErr(resp peerResp) error {
+	if resp.Code != response.SUCCESS {
+		return response.NewErrWithMsg(resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// 解析响应数据, 业务错误时同样解析(如版本不一致时的当前版本号), 之后返回err
+func peerResult(raw []byte, data interface{}, err error) error {
+	if data != nil && len(raw) > 0 {
+		if uerr := json.Unmarshal(raw, data); err == nil {
+			return uerr
+		}
+	}
+	return err
+}
+
+// 与post相同, 通过gRPC的Peer方法发送
+func (h *NodePool) postGRPC(baseUrl string, path string, group string, body interface{}, data interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client, err := h.rpcClient(baseUrl)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+	zklog.Logger.WithFields(logrus.Fields{
+		"node": baseUrl,
+		"path": path,
+	}).Debug("grpc peer request")
+	var trailer metadata.MD
+	resp, err := client.Peer(ctx, &rpc.PeerRequest{Group: group, Path: path, Body: raw}, grpc.Trailer(&trailer))
+	if err != nil {
+		return peerResult(rpc.ErrorData(trailer), data, err)
+	}
+	return peerResult(resp.Data, data, nil)
+}
+
+// 将缓存项交给远程节点
+func (h *NodePool) handoff(baseUrl string, group string, entries []lru.Entry) error {
+	return h.post(baseUrl, "handoff", group, HandoffReq{Entries: entries}, nil)
+}
+
+type HandoffReq struct {
+	Entries []lru.Entry `json:"entries"`
+}
+
+// 读取远程节点缓存中的数据及删除记录, 不会触发远程节点加载
+func (h *NodePool) peek(baseUrl string, group string, key string) (PeekResp, error) {
+	resp := PeekResp{}
+	err := h.post(baseUrl, "peek", group, PeekReq{Key: key}, &resp)
+	return resp, err
+}
+
+type PeekReq struct {
+	Key string `json:"key"`
+}
+
+type PeekResp struct {
+	Entry lru.Entry `json:"entry"`
+	Found bool      `json:"found"`
+	// 最近一次删除的版本号, 不大于它的副本数据已过时
+	Deleted uint64 `json:"deleted,omitempty"`
+}
+
+type SetReq struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Tags  []string `json:"tags,omitempty"`
+	// 毫秒, 含义同SetWithTTL
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+type DeleteReq struct {
+	Key string `json:"key"`
+	// 为true时只删除接收节点上的数据, 用于归属节点同步给副本
+	Replica bool `json:"replica,omitempty"`
+	// 归属节点上的删除版本, 只用于副本请求
+	Version uint64 `json:"version,omitempty"`
+}
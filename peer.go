@@ -0,0 +1,174 @@
+package zkcache
+
+import (
+	"encoding/json"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 节点间内部接口, 按路径分发, 请求体为JSON; HTTP与gRPC两种传输共用
+type peerHandler func(c *Controller, body []byte) (interface{}, error)
+
+var peerHandlers = map[string]peerHandler{
+	"handoff": func(c *Controller, body []byte) (interface{}, error) {
+		req := HandoffReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.Handoff(req.Entries), nil
+	},
+	"transfer": func(c *Controller, body []byte) (interface{}, error) {
+		req := TransferReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.Transfer(req), nil
+	},
+	"peek": func(c *Controller, body []byte) (interface{}, error) {
+		req := PeekReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		e, ok := c.GetLocal(req.Key)
+		return PeekResp{Entry: e, Found: ok, Deleted: c.cache.deleted(req.Key)}, nil
+	},
+	"set": func(c *Controller, body []byte) (interface{}, error) {
+		req := SetReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.SetLocalWithTTL(req.Key, req.Value, time.Duration(req.TTL)*time.Millisecond, req.Tags...)
+	},
+	"version": func(c *Controller, body []byte) (interface{}, error) {
+		req := PeekReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.GetWithVersionLocal(req.Key)
+	},
+	"cas": func(c *Controller, body []byte) (interface{}, error) {
+		req := CompareAndSetReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.CompareAndSetLocalWithTTL(req.Key, req.Expected, req.Value, time.Duration(req.TTL)*time.Millisecond)
+	},
+	"incr": func(c *Controller, body []byte) (interface{}, error) {
+		req := IncrReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.IncrLocal(req.Key, req.Delta, time.Duration(req.TTL)*time.Millisecond)
+	},
+	"invalidateTag": func(c *Controller, body []byte) (interface{}, error) {
+		req := InvalidateTagReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.InvalidateTagLocal(req.Tag), nil
+	},
+	"scan": func(c *Controller, body []byte) (interface{}, error) {
+		req := ScanReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.ScanLocal(req), nil
+	},
+	"publish": func(c *Controller, body []byte) (interface{}, error) {
+		req := PublishReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.PublishLocal(req.Topic, req.Data), nil
+	},
+	"ratelimit": func(c *Controller, body []byte) (interface{}, error) {
+		req := RateLimitReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.RateLimitLocal(req)
+	},
+	"delete": func(c *Controller, body []byte) (interface{}, error) {
+		req := DeleteReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.deleteOnOwner(req)
+	},
+	"touch": func(c *Controller, body []byte) (interface{}, error) {
+		req := TouchReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.TouchLocal(req), nil
+	},
+	"lock": func(c *Controller, body []byte) (interface{}, error) {
+		req := LockReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.LockLocal(req)
+	},
+	"unlock": func(c *Controller, body []byte) (interface{}, error) {
+		req := LockReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return nil, c.UnlockLocal(req)
+	},
+	"warm": func(c *Controller, body []byte) (interface{}, error) {
+		req := WarmReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.WarmLocal(req)
+	},
+	"refresh": func(c *Controller, body []byte) (interface{}, error) {
+		req := LockReq{}
+		if err := decodePeerReq(body, &req); err != nil {
+			return nil, err
+		}
+		return c.RefreshLocal(req)
+	},
+}
+
+func decodePeerReq(body []byte, req interface{}) error {
+	if err := json.Unmarshal(body, req); err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		return response.NewErr(response.PARAMETER_ERROR)
+	}
+	return nil
+}
+
+// 处理节点间内部请求, 返回的错误均为业务错误, 出错时data仍可能携带数据(如cas的当前版本)
+func (c *Controller) ServePeer(path string, body []byte) (interface{}, error) {
+	handler, ok := peerHandlers[path]
+	if !ok {
+		return nil, response.NewErrWithMsg(response.PARAMETER_ERROR, "unknown peer path: "+path)
+	}
+	data, err := handler(c, body)
+	if err != nil {
+		if _, ok := response.ErrCode(err); !ok {
+			zklog.Logger.WithFields(logrus.Fields{
+				"path": path,
+				"err":  err.Error(),
+			}).Warn("peer request failed")
+			err = response.NewErrWithMsg(response.ERROR, err.Error())
+		}
+	}
+	return data, err
+}
+
+// 按group选择Controller, 为空时使用def; 未注册的group返回PARAMETER_ERROR, 避免拼写错误时静默读写默认的分组
+func SelectController(group string, def *Controller) (*Controller, error) {
+	if group == "" {
+		return def, nil
+	}
+	if c, ok := GetController(group); ok {
+		return c, nil
+	}
+	return nil, response.NewErrWithMsg(response.PARAMETER_ERROR, "unknown group: "+group)
+}
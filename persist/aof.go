@@ -0,0 +1,246 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"zkCache/lru"
+	"zkCache/zklog"
+)
+
+// 日志刷盘策略
+type FsyncPolicy string
+
+const (
+	// 每条记录都刷盘
+	FsyncAlways FsyncPolicy = "always"
+	// 每秒刷盘一次, 宕机最多丢失一秒的数据
+	FsyncEverySec FsyncPolicy = "everysec"
+	// 由操作系统决定
+	FsyncNever FsyncPolicy = "never"
+)
+
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch p := FsyncPolicy(s); p {
+	case FsyncAlways, FsyncEverySec, FsyncNever:
+		return p, nil
+	case "":
+		return FsyncEverySec, nil
+	}
+	return "", fmt.Errorf("unknown fsync policy: %s", s)
+}
+
+// 一条变更记录
+type Record struct {
+	Seq   uint64    `json:"seq"`
+	Op    lru.Op    `json:"op"`
+	Entry lru.Entry `json:"entry"`
+}
+
+// 追加写的变更日志
+type AOF struct {
+	mu     sync.Mutex
+	path   string
+	f      *os.File
+	w      *bufio.Writer
+	policy FsyncPolicy
+	seq    uint64
+	stop   chan struct{}
+	closed bool
+}
+
+// 打开日志文件用于追加, seq为已有的最后一条记录序号
+func OpenAOF(path string, policy FsyncPolicy, seq uint64) (*AOF, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a := &AOF{
+		path:   path,
+		f:      f,
+		w:      bufio.NewWriter(f),
+		policy: policy,
+		seq:    seq,
+		stop:   make(chan struct{}),
+	}
+	if policy == FsyncEverySec {
+		go a.syncLoop()
+	}
+	return a, nil
+}
+
+// 追加一条记录并返回其序号
+func (a *AOF) Append(op lru.Op, e lru.Entry) (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return 0, fmt.Errorf("aof %s closed", a.path)
+	}
+	a.seq++
+	data, err := json.Marshal(Record{Seq: a.seq, Op: op, Entry: e})
+	if err != nil {
+		return 0, err
+	}
+	a.w.Write(data)
+	if err := a.w.WriteByte('\n'); err != nil {
+		return 0, err
+	}
+	if a.policy == FsyncAlways {
+		if err := a.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return a.seq, nil
+}
+
+// 最后一条记录的序号
+func (a *AOF) Seq() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.seq
+}
+
+// 需持有锁
+func (a *AOF) flush() error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	if a.policy == FsyncNever {
+		return nil
+	}
+	return a.f.Sync()
+}
+
+func (a *AOF) syncLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			if err := a.flush(); err != nil {
+				zklog.Logger.WithField("err", err).Error()
+			}
+			a.mu.Unlock()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// 旧日志文件, 快照写入成功后删除
+func OldPath(path string) string {
+	return path + ".old"
+}
+
+// 切换到新的日志文件, 当前文件并入旧日志文件(OldPath)
+// 快照写入成功后调用RemoveOld删除; 快照失败时旧日志保留, 启动时一并回放
+func (a *AOF) Rotate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	old := OldPath(a.path)
+	if _, err := os.Stat(old); os.IsNotExist(err) {
+		if err := os.Rename(a.path, old); err != nil {
+			return err
+		}
+	} else if err := appendFile(old, a.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	a.f = f
+	a.w.Reset(f)
+	return nil
+}
+
+func (a *AOF) RemoveOld() error {
+	err := os.Remove(OldPath(a.path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 将src的内容追加到dst末尾
+func appendFile(dst string, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (a *AOF) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	close(a.stop)
+	a.w.Flush()
+	a.f.Sync()
+	return a.f.Close()
+}
+
+// 按顺序回放日志中序号大于after的记录, 返回最后一条记录的序号
+// 末尾不完整的记录(写入时宕机)会被忽略
+func ReplayAOF(path string, after uint64, fn func(Record)) (uint64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return after, nil
+	}
+	if err != nil {
+		return after, err
+	}
+	defer f.Close()
+	last := after
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+		rec := Record{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return last, fmt.Errorf("replay aof %s: %v", path, err)
+		}
+		if rec.Seq > last {
+			last = rec.Seq
+		}
+		if rec.Seq > after {
+			fn(rec)
+		}
+	}
+}
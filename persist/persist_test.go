@@ -0,0 +1,73 @@
+package persist
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"zkCache/lru"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	entries := []lru.Entry{
+		{Key: "k1", Value: "v1", Version: 1},
+		{Key: "k2", Value: "v2", Version: 2, Expire: 100, Tags: []string{"t"}},
+	}
+	if err := WriteSnapshot(path, 10, entries); err != nil {
+		t.Fatal(err)
+	}
+	seq, got, err := ReadSnapshot(path)
+	if err != nil || seq != 10 || !reflect.DeepEqual(entries, got) {
+		t.Fatal("check snapshot", seq, got, err)
+	}
+	if seq, got, err := ReadSnapshot(filepath.Join(t.TempDir(), "none")); err != nil || seq != 0 || got != nil {
+		t.Fatal("missing snapshot should be empty", seq, got, err)
+	}
+}
+
+func TestAOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	aof, err := OpenAOF(path, FsyncAlways, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof.Append(lru.OpSet, lru.Entry{Key: "k1", Value: "v1"})
+	aof.Append(lru.OpSet, lru.Entry{Key: "k2", Value: "v2"})
+	if err := aof.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	aof.Append(lru.OpDelete, lru.Entry{Key: "k1"})
+	aof.Close()
+
+	replay := func(after uint64) []string {
+		ops := make([]string, 0)
+		fn := func(rec Record) { ops = append(ops, string(rec.Op)+":"+rec.Entry.Key) }
+		last, _ := ReplayAOF(OldPath(path), after, fn)
+		if last, _ = ReplayAOF(path, last, fn); last != 3 {
+			t.Fatal("check last seq", last)
+		}
+		return ops
+	}
+	if ops := replay(0); !reflect.DeepEqual(ops, []string{"set:k1", "set:k2", "delete:k1"}) {
+		t.Fatal("check replay", ops)
+	}
+	if ops := replay(2); !reflect.DeepEqual(ops, []string{"delete:k1"}) {
+		t.Fatal("records covered by snapshot should be skipped", ops)
+	}
+
+	// 重新打开后序号继续递增
+	aof, _ = OpenAOF(path, FsyncNever, 3)
+	if seq, _ := aof.Append(lru.OpSet, lru.Entry{Key: "k3"}); seq != 4 {
+		t.Fatal("check seq", seq)
+	}
+	aof.Close()
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	if p, err := ParseFsyncPolicy(""); err != nil || p != FsyncEverySec {
+		t.Fatal("default policy should be everysec", p, err)
+	}
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Fatal("unknown policy should be rejected")
+	}
+}
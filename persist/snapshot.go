@@ -0,0 +1,77 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"zkCache/lru"
+)
+
+// 快照文件头
+type header struct {
+	// 快照包含的最后一条日志序号, 回放日志时跳过序号不大于它的记录
+	Seq  uint64 `json:"seq"`
+	Time int64  `json:"time"`
+}
+
+// 写入快照: 第一行为文件头, 之后每行一个缓存项(JSON)
+// 先写临时文件再重命名, 保证快照文件总是完整的
+func WriteSnapshot(path string, seq uint64, entries []lru.Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header{Seq: seq, Time: time.Now().UnixNano()}); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// 读取快照, 文件不存在时返回空
+func ReadSnapshot(path string) (seq uint64, entries []lru.Entry, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	h := header{}
+	if err := dec.Decode(&h); err != nil {
+		return 0, nil, fmt.Errorf("read snapshot header %s: %v", path, err)
+	}
+	for dec.More() {
+		e := lru.Entry{}
+		if err := dec.Decode(&e); err != nil {
+			return 0, nil, fmt.Errorf("read snapshot %s: %v", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return h.Seq, entries, nil
+}
@@ -0,0 +1,177 @@
+package zkcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"zkCache/lru"
+	"zkCache/persist"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+type PersistConfig struct {
+	// 快照和变更日志所在目录
+	Dir string
+	// 定期快照的间隔, 0表示只在关闭时快照
+	SnapshotInterval time.Duration
+	// 是否开启变更日志
+	AOF   bool
+	Fsync persist.FsyncPolicy
+}
+
+type persistence struct {
+	cfg          PersistConfig
+	snapshotPath string
+	aofPath      string
+	aof          *persist.AOF
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// 从磁盘恢复数据并开启持久化, 应在节点注册到注册中心之前调用
+func (c *Controller) EnablePersistence(cfg PersistConfig) error {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return err
+	}
+	p := &persistence{
+		cfg:          cfg,
+		snapshotPath: filepath.Join(cfg.Dir, c.name+".snapshot"),
+		aofPath:      filepath.Join(cfg.Dir, c.name+".aof"),
+		stop:         make(chan struct{}),
+	}
+	start := time.Now()
+	seq, entries, err := persist.ReadSnapshot(p.snapshotPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	c.cache.mu.Lock()
+	for _, e := range entries {
+		if e.Expire == 0 || e.Expire > now {
+			c.cache.lru.SetEntry(e)
+		}
+	}
+	c.cache.unlock()
+
+	replayed := 0
+	if cfg.AOF {
+		apply := func(rec persist.Record) {
+			replayed++
+			c.cache.mu.Lock()
+			defer c.cache.unlock()
+			if rec.Op == lru.OpSet {
+				c.cache.lru.SetEntry(rec.Entry)
+			} else {
+				c.cache.lru.Remove(rec.Entry.Key)
+			}
+		}
+		if seq, err = persist.ReplayAOF(persist.OldPath(p.aofPath), seq, apply); err != nil {
+			return err
+		}
+		if seq, err = persist.ReplayAOF(p.aofPath, seq, apply); err != nil {
+			return err
+		}
+		if p.aof, err = persist.OpenAOF(p.aofPath, cfg.Fsync, seq); err != nil {
+			return err
+		}
+	}
+	zklog.Logger.WithFields(logrus.Fields{
+		"controller": c.name,
+		"snapshot":   len(entries),
+		"aof":        replayed,
+		"elapsed":    time.Since(start).String(),
+	}).Info("restore from disk")
+
+	c.cache.mu.Lock()
+	c.persist = p
+	c.cache.mu.Unlock()
+	if cfg.SnapshotInterval > 0 {
+		p.wg.Add(1)
+		go c.snapshotLoop(p)
+	}
+	return nil
+}
+
+func (c *Controller) snapshotLoop(p *persistence) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Snapshot(); err != nil {
+				zklog.Logger.WithField("err", err).Error()
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// 将当前数据写入快照, 之后变更日志中已包含在快照里的记录被丢弃
+func (c *Controller) Snapshot() error {
+	c.cache.mu.Lock()
+	p := c.persist
+	if p == nil {
+		c.cache.mu.Unlock()
+		return fmt.Errorf("controller %s persistence not enabled", c.name)
+	}
+	hottest := c.cache.lru.Hottest(0)
+	var seq uint64
+	if p.aof != nil {
+		seq = p.aof.Seq()
+		if err := p.aof.Rotate(); err != nil {
+			c.cache.mu.Unlock()
+			return err
+		}
+	}
+	c.cache.mu.Unlock()
+
+	// 从最冷到最热写入, 恢复时保持访问顺序
+	entries := make([]lru.Entry, len(hottest))
+	for i, e := range hottest {
+		entries[len(hottest)-1-i] = e
+	}
+	if err := persist.WriteSnapshot(p.snapshotPath, seq, entries); err != nil {
+		return err
+	}
+	if p.aof != nil {
+		return p.aof.RemoveOld()
+	}
+	return nil
+}
+
+// 写入最后一次快照并关闭变更日志, 未开启持久化时不做任何事
+func (c *Controller) ClosePersistence() error {
+	c.cache.mu.Lock()
+	p := c.persist
+	c.cache.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	close(p.stop)
+	p.wg.Wait()
+	err := c.Snapshot()
+	c.cache.mu.Lock()
+	c.persist = nil
+	c.cache.mu.Unlock()
+	if p.aof != nil {
+		p.aof.Close()
+	}
+	return err
+}
+
+// 缓存变更: 记录到变更流, 同步磁盘层, 开启变更日志时追加写入; 在持有缓存锁的情况下调用
+func (c *Controller) onChange(op lru.Op, e lru.Entry) {
+	c.changes.append(op, e)
+	c.spillChange(op, e)
+	if c.persist != nil && c.persist.aof != nil {
+		if _, err := c.persist.aof.Append(op, e); err != nil {
+			zklog.Logger.WithField("err", err).Error()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package zkcache
+
+import (
+	"testing"
+	"zkCache/persist"
+)
+
+// 模拟节点重启: 移除同名Controller后重新创建
+func restart(name string) *Controller {
+	mu.Lock()
+	delete(controller, name)
+	mu.Unlock()
+	return NewController(name, 0, nil, nil)
+}
+
+func TestPersistence(t *testing.T) {
+	cfg := PersistConfig{Dir: t.TempDir(), AOF: true, Fsync: persist.FsyncAlways}
+	c := NewController("persist", 0, nil, nil)
+	if err := c.EnablePersistence(cfg); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("k1", "v1", "tag")
+	c.Set("k2", "v2")
+	if err := c.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	// 快照之后的变更只在日志中
+	c.Set("k3", "v3")
+	c.cache.remove("k2")
+	version, _ := c.SetLocal("k1", "v1-new")
+	c.persist.aof.Close()
+
+	c = restart("persist")
+	if err := c.EnablePersistence(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer c.ClosePersistence()
+	if e, ok := c.GetLocal("k1"); !ok || e.Value != "v1-new" || e.Version != version || len(e.Tags) != 1 {
+		t.Fatal("check k1", e)
+	}
+	if _, ok := c.GetLocal("k2"); ok {
+		t.Fatal("k2 should be deleted")
+	}
+	if e, ok := c.GetLocal("k3"); !ok || e.Value != "v3" {
+		t.Fatal("check k3", e)
+	}
+}
+
+func TestSnapshotOnly(t *testing.T) {
+	cfg := PersistConfig{Dir: t.TempDir()}
+	c := NewController("persist-snapshot", 0, nil, nil)
+	c.EnablePersistence(cfg)
+	c.Set("k", "v")
+	if err := c.ClosePersistence(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = restart("persist-snapshot")
+	c.EnablePersistence(cfg)
+	if e, ok := c.GetLocal("k"); !ok || e.Value != "v" {
+		t.Fatal("check k", e)
+	}
+}
@@ -6,4 +6,14 @@ const (
 
 	// 参数错误
 	PARAMETER_ERROR = 2000
+	// 版本不一致
+	VERSION_MISMATCH = 2001
+	// 超过单条大小上限
+	ENTRY_TOO_LARGE = 2002
+	// 锁已被占用
+	LOCK_HELD = 2003
+	// 未持有锁或锁已过期
+	LOCK_NOT_HELD = 2004
+	// 数据不存在
+	NOT_FOUND = 2005
 )
@@ -22,3 +22,11 @@ func NewErrWithMsg(code int, msg string) error {
 		Msg:  msg,
 	}
 }
+
+// 获取错误码, 第二个返回值表示err是否为业务错误
+func ErrCode(err error) (int, bool) {
+	if res, ok := err.(*resErr); ok {
+		return res.Code, true
+	}
+	return ERROR, false
+}
@@ -11,9 +11,14 @@ type responseMsg struct {
 
 var ResponseMsg responseMsg
 var msg = map[int]string{
-	SUCCESS:         "success",
-	ERROR:           "服务器异常",
-	PARAMETER_ERROR: "参数不全或有误",
+	SUCCESS:          "success",
+	ERROR:            "服务器异常",
+	PARAMETER_ERROR:  "参数不全或有误",
+	VERSION_MISMATCH: "数据版本不一致",
+	ENTRY_TOO_LARGE:  "数据超过单条大小上限",
+	LOCK_HELD:        "锁已被占用",
+	LOCK_NOT_HELD:    "未持有锁或锁已过期",
+	NOT_FOUND:        "数据不存在",
 }
 
 func getMsg(code int) interface{} {
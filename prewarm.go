@@ -0,0 +1,230 @@
+package zkcache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 每处理完多少个key报告一次进度
+	prewarmProgressEvery = 100
+	// 报告中最多记录的失败条数
+	maxPrewarmFailures = 100
+)
+
+const (
+	WarmLoaded = "loaded"
+	WarmCached = "cached"
+	WarmSeeded = "seeded"
+)
+
+type PrewarmConfig struct {
+	// 同时处理的key数, 默认8
+	Concurrency int `json:"concurrency"`
+	// 每秒最多处理的key数, 0表示不限制
+	Rate int `json:"rate"`
+}
+
+type PrewarmReport struct {
+	Total int `json:"total"`
+	// 通过数据源加载的条数
+	Loaded int `json:"loaded"`
+	// 已在缓存中, 未访问数据源的条数
+	Cached int `json:"cached"`
+	// 直接写入的条数
+	Seeded int `json:"seeded"`
+	Failed int `json:"failed"`
+	// ctx结束时未处理的条数
+	Skipped  int              `json:"skipped"`
+	Failures []PrewarmFailure `json:"failures,omitempty"`
+	Elapsed  time.Duration    `json:"elapsed"`
+}
+
+type PrewarmFailure struct {
+	Key string `json:"key"`
+	Err string `json:"err"`
+}
+
+type WarmReq struct {
+	Key string `json:"key"`
+	// 非nil时直接写入该值, 不访问数据源
+	Value *string `json:"value,omitempty"`
+	// 毫秒, 只用于直接写入, 0表示使用默认过期时间
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+type WarmResp struct {
+	// loaded, cached 或 seeded
+	Result string `json:"result"`
+}
+
+// 预热: 每个key交给归属节点, 不在缓存中时通过数据源加载
+// progress 每处理完一批调用一次, 可为nil; ctx 结束时停止并返回当前进度
+func (c *Controller) Prewarm(ctx context.Context, keys []string, cfg PrewarmConfig, progress func(PrewarmReport)) PrewarmReport {
+	reqs := make([]WarmReq, len(keys))
+	for i, key := range keys {
+		reqs[i] = WarmReq{Key: key}
+	}
+	return c.prewarm(ctx, reqs, cfg, progress)
+}
+
+// 直接写入entries到各自的归属节点, 不访问数据源也不写回数据源; ttl为0时使用默认过期时间
+func (c *Controller) Seed(ctx context.Context, entries map[string]string, ttl time.Duration, cfg PrewarmConfig, progress func(PrewarmReport)) PrewarmReport {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	reqs := make([]WarmReq, len(keys))
+	for i, key := range keys {
+		value := entries[key]
+		reqs[i] = WarmReq{Key: key, Value: &value, TTL: ttl.Milliseconds()}
+	}
+	return c.prewarm(ctx, reqs, cfg, progress)
+}
+
+func (c *Controller) prewarm(ctx context.Context, reqs []WarmReq, cfg PrewarmConfig, progress func(PrewarmReport)) PrewarmReport {
+	start := time.Now()
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	report := PrewarmReport{Total: len(reqs)}
+	done := 0
+	var mu sync.Mutex
+	jobs := make(chan WarmReq)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				result, err := c.warmKey(req)
+				mu.Lock()
+				switch {
+				case err != nil:
+					report.Failed++
+					if len(report.Failures) < maxPrewarmFailures {
+						report.Failures = append(report.Failures, PrewarmFailure{Key: req.Key, Err: err.Error()})
+					}
+				case result == WarmCached:
+					report.Cached++
+				case result == WarmSeeded:
+					report.Seeded++
+				default:
+					report.Loaded++
+				}
+				done++
+				if progress != nil && done%prewarmProgressEvery == 0 {
+					r := report
+					r.Elapsed = time.Since(start)
+					progress(r)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	sent := 0
+feed:
+	for _, req := range reqs {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		select {
+		case jobs <- req:
+			sent++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	report.Skipped = len(reqs) - sent
+	report.Elapsed = time.Since(start)
+	zklog.Logger.WithFields(logrus.Fields{
+		"controller": c.name,
+		"total":      report.Total,
+		"loaded":     report.Loaded,
+		"cached":     report.Cached,
+		"seeded":     report.Seeded,
+		"failed":     report.Failed,
+		"skipped":    report.Skipped,
+		"elapsed":    report.Elapsed.String(),
+	}).Info("prewarm finished")
+	return report
+}
+
+// 在key的归属节点上预热
+func (c *Controller) warmKey(req WarmReq) (string, error) {
+	if req.Key == "" {
+		return "", response.NewErrWithMsg(response.PARAMETER_ERROR, "empty key")
+	}
+	resp := WarmResp{}
+	err := c.onOwner(req.Key, func() (err error) {
+		resp, err = c.WarmLocal(req)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "warm", c.name, req, &resp)
+	})
+	return resp.Result, err
+}
+
+// 在本节点预热并同步给其他副本; 不经过准入策略, 也不写回数据源
+func (c *Controller) WarmLocal(req WarmReq) (WarmResp, error) {
+	if req.Value != nil {
+		ttl := time.Duration(req.TTL) * time.Millisecond
+		if ttl <= 0 {
+			ttl = c.DefaultTTL()
+		}
+		e, err := c.cache.setWithTTL(req.Key, *req.Value, ttl)
+		if err != nil {
+			return WarmResp{}, err
+		}
+		c.replicate(e)
+		return WarmResp{Result: WarmSeeded}, nil
+	}
+	if _, ok := c.GetLocal(req.Key); ok {
+		return WarmResp{Result: WarmCached}, nil
+	}
+	if c.get == nil {
+		return WarmResp{}, fmt.Errorf("controller %s has no data source", c.name)
+	}
+	// 与正常读取共用singleflight, 同一key只加载一次
+	view, err := c.loader.Do(req.Key, time.Now().UnixNano(), func() ([]byte, error) {
+		value, err := c.loadSource(req.Key)
+		return []byte(value), err
+	})
+	if err != nil {
+		return WarmResp{}, err
+	}
+	value := string(view)
+	var tags []string
+	if c.tagFunc != nil {
+		tags = c.tagFunc(req.Key, value)
+	}
+	e, err := c.cache.setWithTTL(req.Key, value, c.DefaultTTL(), tags...)
+	if err != nil {
+		return WarmResp{}, err
+	}
+	c.replicate(e)
+	return WarmResp{Result: WarmLoaded}, nil
+}
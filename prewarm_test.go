@@ -0,0 +1,87 @@
+package zkcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrewarm(t *testing.T) {
+	controllers, _ := newCluster(t, "prewarm", 3, 1)
+	var loads int64
+	for _, c := range controllers {
+		c.get = func(key string) (string, error) {
+			atomic.AddInt64(&loads, 1)
+			if key == "missing" {
+				return "", errors.New("not in db")
+			}
+			return "v-" + key, nil
+		}
+	}
+	keys := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	progressed := 0
+	report := controllers[0].Prewarm(context.Background(), append(keys, "missing"), PrewarmConfig{Concurrency: 4},
+		func(PrewarmReport) { progressed++ })
+	if report.Total != 201 || report.Loaded != 200 || report.Failed != 1 || len(report.Failures) != 1 ||
+		report.Failures[0].Key != "missing" || progressed != 2 {
+		t.Fatal("check report", report, progressed)
+	}
+	for _, key := range keys {
+		owner := byUrl(controllers, controllers[0].nodePool.PickNodes(key, 1)[0])
+		if e, ok := owner.GetLocal(key); !ok || e.Value != "v-"+key {
+			t.Fatal("key should be loaded on its owner", key)
+		}
+	}
+
+	report = controllers[1].Prewarm(context.Background(), keys[:10], PrewarmConfig{}, nil)
+	if report.Cached != 10 || atomic.LoadInt64(&loads) != 201 {
+		t.Fatal("cached keys should not be loaded again", report, loads)
+	}
+}
+
+func TestPrewarmRateAndCancel(t *testing.T) {
+	c := NewController("prewarm-rate", 0, func(key string) (string, error) { return key, nil }, nil)
+	keys := []string{"a", "b", "c", "d", "e"}
+	start := time.Now()
+	report := c.Prewarm(context.Background(), keys, PrewarmConfig{Rate: 50}, nil)
+	if report.Loaded != 5 || time.Since(start) < 80*time.Millisecond {
+		t.Fatal("rate should be limited", report, time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report = c.Prewarm(ctx, []string{"x", "y"}, PrewarmConfig{Rate: 1}, nil)
+	if report.Skipped != 2 || report.Loaded != 0 {
+		t.Fatal("cancelled prewarm should skip keys", report)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	controllers, _ := newCluster(t, "seed", 3, 2)
+	for _, c := range controllers {
+		c.get = func(key string) (string, error) {
+			t.Fatal("seed should not call the loader")
+			return "", nil
+		}
+	}
+	entries := map[string]string{"a": "1", "b": "2", "c": "3"}
+	report := controllers[0].Seed(context.Background(), entries, time.Minute, PrewarmConfig{}, nil)
+	if report.Seeded != 3 || report.Failed != 0 {
+		t.Fatal("check report", report)
+	}
+	for key, value := range entries {
+		for _, node := range controllers[0].nodePool.PickNodes(key, 2) {
+			c := byUrl(controllers, node)
+			waitFor(t, func() bool {
+				e, ok := c.GetLocal(key)
+				return ok && e.Value == value && e.Expire > 0
+			})
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 订阅者及每个回调地址的缓冲区大小, 缓冲区满时丢弃消息(至多一次投递)
+const subscriberBuffer = 64
+
+// 允许的回调地址host, 见 SetWebhookHosts
+var webhookHosts atomic.Value
+
+// 设置允许的回调地址host(可带端口, 如 hooks.example.com 或 10.0.0.5:8080), 非空时只允许这些host;
+// 为空时允许任意公网地址, 拒绝回环、内网和链路本地地址(注册和连接时都会检查)
+func SetWebhookHosts(hosts []string) {
+	webhookHosts.Store(append([]string(nil), hosts...))
+}
+
+func allowedHosts() []string {
+	hosts, _ := webhookHosts.Load().([]string)
+	return hosts
+}
+
+// 系统主题, 发布缓存失效等事件
+const SystemTopic = "__zkcache__"
+
+type Message struct {
+	Topic string `json:"topic"`
+	// 本节点上该主题的消息序号, 从1开始递增
+	Seq  uint64 `json:"seq"`
+	Data string `json:"data"`
+	Time int64  `json:"time"`
+}
+
+type Broker struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+	// 每个主题保留用于重放的最近消息数, 0表示不保留
+	replay int
+	nextID uint64
+}
+
+type topic struct {
+	seq     uint64
+	subs    map[uint64]*Subscriber
+	hooks   map[string]*webhook
+	history []Message
+}
+
+// 回调地址, 由单独的goroutine按顺序投递
+type webhook struct {
+	url string
+	ch  chan Message
+	// 因缓冲区满被丢弃的消息数, 需持有broker的锁
+	dropped int
+}
+
+type Subscriber struct {
+	id     uint64
+	topic  string
+	broker *Broker
+	C      chan Message
+	// 因缓冲区满被丢弃的消息数
+	dropped int
+	closed  bool
+}
+
+var hookClient = &http.Client{
+	Timeout: 3 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 3 * time.Second, Control: checkDial}).DialContext,
+	},
+	// 不跟随重定向, 避免绕过地址检查
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func New(replay int) *Broker {
+	return &Broker{
+		topics: make(map[string]*topic),
+		replay: replay,
+	}
+}
+
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{
+			subs:  make(map[uint64]*Subscriber),
+			hooks: make(map[string]*webhook),
+		}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// 已存在的主题
+func (b *Broker) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := make([]string, 0, len(b.topics))
+	for name := range b.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 向本节点的订阅者投递消息, 不保证送达
+func (b *Broker) Publish(name string, data string) Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(name)
+	t.seq++
+	msg := Message{Topic: name, Seq: t.seq, Data: data, Time: time.Now().UnixNano()}
+	if b.replay > 0 {
+		t.history = append(t.history, msg)
+		if len(t.history) > b.replay {
+			t.history = t.history[len(t.history)-b.replay:]
+		}
+	}
+	for _, sub := range t.subs {
+		sub.send(msg)
+	}
+	for _, hook := range t.hooks {
+		select {
+		case hook.ch <- msg:
+		default:
+			hook.dropped++
+		}
+	}
+	return msg
+}
+
+// 订阅主题, since>0 时先重放本节点保留的序号大于since的消息
+func (b *Broker) Subscribe(name string, since uint64) *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(name)
+	b.nextID++
+	sub := &Subscriber{
+		id:     b.nextID,
+		topic:  name,
+		broker: b,
+		C:      make(chan Message, subscriberBuffer),
+	}
+	if since > 0 {
+		for _, msg := range t.history {
+			if msg.Seq > since {
+				sub.send(msg)
+			}
+		}
+	}
+	t.subs[sub.id] = sub
+	return sub
+}
+
+// 注册回调地址, 每条消息POST一次; 地址不合法或不被允许时返回错误, 见 SetWebhookHosts
+func (b *Broker) AddWebhook(name string, rawURL string) error {
+	if err := CheckWebhook(rawURL); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(name)
+	if _, ok := t.hooks[rawURL]; ok {
+		return nil
+	}
+	hook := &webhook{url: rawURL, ch: make(chan Message, subscriberBuffer)}
+	t.hooks[rawURL] = hook
+	go hook.run()
+	return nil
+}
+
+func (b *Broker) RemoveWebhook(name string, rawURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		if hook, ok := t.hooks[rawURL]; ok {
+			delete(t.hooks, rawURL)
+			close(hook.ch)
+		}
+	}
+}
+
+// 回调地址因缓冲区满丢弃的消息数, 地址未注册时返回0
+func (b *Broker) WebhookDropped(name string, rawURL string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		if hook, ok := t.hooks[rawURL]; ok {
+			return hook.dropped
+		}
+	}
+	return 0
+}
+
+// 需持有broker的锁
+func (s *Subscriber) send(msg Message) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.C <- msg:
+	default:
+		s.dropped++
+	}
+}
+
+// 取消订阅并关闭通道
+func (s *Subscriber) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if t, ok := s.broker.topics[s.topic]; ok {
+		delete(t.subs, s.id)
+	}
+	close(s.C)
+}
+
+func (s *Subscriber) Dropped() int {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// 按顺序投递, 直到回调地址被移除
+func (h *webhook) run() {
+	for msg := range h.ch {
+		callHook(h.url, msg)
+	}
+}
+
+func callHook(url string, msg Message) {
+	buf := new(bytes.Buffer)
+	json.NewEncoder(buf).Encode(msg)
+	res, err := hookClient.Post(url, "application/json", buf)
+	if err != nil {
+		zklog.Logger.WithFields(logrus.Fields{
+			"url": url,
+			"err": err.Error(),
+		}).Warn("webhook failed")
+		return
+	}
+	res.Body.Close()
+}
+
+// 检查回调地址: 只允许http(s), 设置了允许的host时需在其中, 否则不能解析到回环、内网或链路本地地址
+func CheckWebhook(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("pubsub: invalid webhook url %q", rawURL)
+	}
+	if hosts := allowedHosts(); len(hosts) > 0 {
+		for _, host := range hosts {
+			if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("pubsub: webhook host %s is not allowed", u.Host)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("pubsub: resolve webhook host %s: %v", u.Hostname(), err)
+	}
+	for _, ip := range ips {
+		if internalIP(ip.IP) {
+			return fmt.Errorf("pubsub: webhook host %s resolves to internal address %s", u.Hostname(), ip.IP)
+		}
+	}
+	return nil
+}
+
+// 连接时再次检查, 防止注册后域名解析到内网地址
+func checkDial(network string, address string, _ syscall.RawConn) error {
+	if len(allowedHosts()) > 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+		return errors.New("pubsub: webhook to internal address " + host + " is not allowed")
+	}
+	return nil
+}
+
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
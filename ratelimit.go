@@ -0,0 +1,48 @@
+package zkcache
+
+import (
+	"fmt"
+	"time"
+	"zkCache/pkg/response"
+	"zkCache/ratelimit"
+)
+
+type RateLimitReq struct {
+	Key       string              `json:"key"`
+	Algorithm ratelimit.Algorithm `json:"algorithm"`
+	Limit     int64               `json:"limit"`
+	// 毫秒
+	Window int64 `json:"window"`
+	// 本次申请的额度, 0视为1
+	N int64 `json:"n"`
+}
+
+// 在key的归属节点上申请额度, 每次调用至多一次节点间请求
+// 限流状态只保存在归属节点上, 归属节点下线或hash环变化后该key的限流重新开始计数
+func (c *Controller) RateLimit(req RateLimitReq) (ratelimit.Result, error) {
+	if req.Key == "" {
+		return ratelimit.Result{}, fmt.Errorf("key not exist")
+	}
+	var res ratelimit.Result
+	err := c.onOwner(req.Key, func() (err error) {
+		res, err = c.RateLimitLocal(req)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "ratelimit", c.name, req, &res)
+	})
+	return res, err
+}
+
+func (c *Controller) RateLimitLocal(req RateLimitReq) (ratelimit.Result, error) {
+	if req.Algorithm == "" {
+		req.Algorithm = ratelimit.TokenBucket
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	window := time.Duration(req.Window) * time.Millisecond
+	if err := ratelimit.Validate(req.Algorithm, req.Limit, window); err != nil {
+		return ratelimit.Result{}, response.NewErrWithMsg(response.PARAMETER_ERROR, err.Error())
+	}
+	return c.limiter.Allow(req.Key, req.Algorithm, req.Limit, window, req.N, time.Now()), nil
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	// 令牌桶: 容量为limit, 每个window匀速补充limit个令牌, 允许突发
+	TokenBucket Algorithm = "token_bucket"
+	// 滑动窗口计数: 按上一个窗口的计数加权估算最近window内的请求数
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// 每处理该数量的请求清理一次长时间未访问的状态
+const sweepInterval = 1024
+
+type Result struct {
+	Allowed bool `json:"allowed"`
+	// 剩余可用次数
+	Remaining int64 `json:"remaining"`
+	// 额度完全恢复的时间 UnixMilli
+	Reset int64 `json:"reset"`
+	// 被拒绝时建议的重试间隔 毫秒
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+type state struct {
+	// 令牌桶: 剩余令牌; 滑动窗口: 当前窗口计数
+	tokens float64
+	// 滑动窗口: 上一个窗口计数
+	prev float64
+	// 令牌桶: 上次补充时间; 滑动窗口: 当前窗口开始时间
+	last   time.Time
+	window time.Duration
+}
+
+// 保存在key的归属节点上的限流状态, 不复制到其他节点
+type Limiter struct {
+	mu     sync.Mutex
+	states map[string]*state
+	calls  int
+}
+
+func New() *Limiter {
+	return &Limiter{states: make(map[string]*state)}
+}
+
+func Validate(alg Algorithm, limit int64, window time.Duration) error {
+	if alg != TokenBucket && alg != SlidingWindow {
+		return fmt.Errorf("unknown algorithm: %s", alg)
+	}
+	if limit <= 0 || window <= 0 {
+		return fmt.Errorf("limit and window must be positive")
+	}
+	return nil
+}
+
+// 为key申请n个额度, 不足时不扣减
+func (l *Limiter) Allow(key string, alg Algorithm, limit int64, window time.Duration, n int64, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls%sweepInterval == 0 {
+		l.sweep(now)
+	}
+	id := string(alg) + ":" + key
+	s, ok := l.states[id]
+	if !ok {
+		s = &state{last: now, window: window}
+		if alg == TokenBucket {
+			s.tokens = float64(limit)
+		}
+		l.states[id] = s
+	}
+	s.window = window
+	if alg == TokenBucket {
+		return s.tokenBucket(float64(limit), window, float64(n), now)
+	}
+	return s.slidingWindow(float64(limit), window, float64(n), now)
+}
+
+func (s *state) tokenBucket(limit float64, window time.Duration, n float64, now time.Time) Result {
+	rate := limit / float64(window)
+	s.tokens += float64(now.Sub(s.last)) * rate
+	if s.tokens > limit {
+		s.tokens = limit
+	}
+	s.last = now
+	res := Result{}
+	if s.tokens >= n {
+		s.tokens -= n
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((n - s.tokens) / rate).Milliseconds()
+	}
+	res.Remaining = int64(s.tokens)
+	res.Reset = now.Add(time.Duration((limit - s.tokens) / rate)).UnixMilli()
+	return res
+}
+
+func (s *state) slidingWindow(limit float64, window time.Duration, n float64, now time.Time) Result {
+	if elapsed := now.Sub(s.last); elapsed >= 2*window {
+		s.prev, s.tokens, s.last = 0, 0, now
+	} else if elapsed >= window {
+		s.prev, s.tokens, s.last = s.tokens, 0, s.last.Add(window)
+	}
+	weight := 1 - float64(now.Sub(s.last))/float64(window)
+	count := s.prev*weight + s.tokens
+	res := Result{Reset: s.last.Add(window).UnixMilli()}
+	if count+n <= limit {
+		s.tokens += n
+		count += n
+		res.Allowed = true
+	} else {
+		res.RetryAfter = s.last.Add(window).Sub(now).Milliseconds()
+	}
+	if remaining := limit - count; remaining > 0 {
+		res.Remaining = int64(remaining)
+	}
+	return res
+}
+
+// 需持有锁; 两个窗口内未访问的状态已恢复到初始值, 可以删除
+func (l *Limiter) sweep(now time.Time) {
+	for id, s := range l.states {
+		if now.Sub(s.last) >= 2*s.window {
+			delete(l.states, id)
+		}
+	}
+}
+
+// 当前保存的状态个数
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.states)
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	l := New()
+	now := time.Unix(1000, 0)
+	for i := 0; i < 3; i++ {
+		if res := l.Allow("k", TokenBucket, 3, time.Second, 1, now); !res.Allowed || res.Remaining != int64(2-i) {
+			t.Fatal("check allow", i, res)
+		}
+	}
+	res := l.Allow("k", TokenBucket, 3, time.Second, 1, now)
+	if res.Allowed || res.RetryAfter != 333 || res.Reset != now.Add(time.Second).UnixMilli() {
+		t.Fatal("should be denied", res)
+	}
+	// 补充令牌
+	if res := l.Allow("k", TokenBucket, 3, time.Second, 1, now.Add(400*time.Millisecond)); !res.Allowed || res.Remaining != 0 {
+		t.Fatal("check refill", res)
+	}
+	if res := l.Allow("k", TokenBucket, 3, time.Second, 1, now.Add(time.Hour)); !res.Allowed || res.Remaining != 2 {
+		t.Fatal("bucket should be full", res)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l := New()
+	now := time.Unix(1000, 0)
+	for i := 0; i < 4; i++ {
+		l.Allow("k", SlidingWindow, 4, time.Second, 1, now)
+	}
+	if res := l.Allow("k", SlidingWindow, 4, time.Second, 1, now.Add(500*time.Millisecond)); res.Allowed || res.RetryAfter != 500 {
+		t.Fatal("should be denied", res)
+	}
+	// 下一个窗口过去一半, 上一个窗口的计数按一半计算
+	res := l.Allow("k", SlidingWindow, 4, time.Second, 1, now.Add(1500*time.Millisecond))
+	if !res.Allowed || res.Remaining != 1 || res.Reset != now.Add(2*time.Second).UnixMilli() {
+		t.Fatal("check sliding", res)
+	}
+	if res := l.Allow("k", SlidingWindow, 4, time.Second, 2, now.Add(1500*time.Millisecond)); res.Allowed {
+		t.Fatal("should be denied", res)
+	}
+	if res := l.Allow("k", SlidingWindow, 4, time.Second, 4, now.Add(time.Hour)); !res.Allowed {
+		t.Fatal("window should be reset", res)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New()
+	now := time.Unix(1000, 0)
+	l.Allow("idle", TokenBucket, 1, time.Second, 1, now)
+	for i := 0; i < sweepInterval; i++ {
+		l.Allow("busy", SlidingWindow, 1<<20, time.Second, 1, now.Add(time.Minute))
+	}
+	if l.Len() != 1 {
+		t.Fatal("idle state should be swept", l.Len())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if Validate(TokenBucket, 1, time.Second) != nil || Validate("x", 1, time.Second) == nil ||
+		Validate(SlidingWindow, 0, time.Second) == nil || Validate(SlidingWindow, 1, 0) == nil {
+		t.Fatal("check validate")
+	}
+}
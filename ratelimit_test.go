@@ -0,0 +1,38 @@
+package zkcache
+
+import (
+	"testing"
+	"zkCache/pkg/response"
+	"zkCache/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	controllers, _ := newCluster(t, "ratelimit", 2, 1)
+	req := RateLimitReq{Key: "user:1", Limit: 3, Window: 60000}
+	// 不同节点上的请求共享归属节点上的状态
+	for i := 0; i < 3; i++ {
+		res, err := controllers[i%2].RateLimit(req)
+		if err != nil || !res.Allowed || res.Remaining != int64(2-i) {
+			t.Fatal("check allow", i, res, err)
+		}
+	}
+	res, err := controllers[1].RateLimit(req)
+	if err != nil || res.Allowed || res.RetryAfter <= 0 {
+		t.Fatal("should be denied", res, err)
+	}
+	owner := byUrl(controllers, controllers[0].nodePool.PickNodes("user:1", 1)[0])
+	if owner.limiter.Len() != 1 || outsider(controllers, "user:1").limiter.Len() != 0 {
+		t.Fatal("state should live on owner")
+	}
+
+	req.Algorithm = ratelimit.SlidingWindow
+	if res, err := controllers[0].RateLimit(req); err != nil || !res.Allowed {
+		t.Fatal("algorithms should not share state", res, err)
+	}
+	req.Limit = 0
+	if _, err := controllers[1].RateLimit(req); err == nil {
+		t.Fatal("invalid limit should fail")
+	} else if code, ok := response.ErrCode(err); !ok || code != response.PARAMETER_ERROR {
+		t.Fatal("check error code", err)
+	}
+}
@@ -66,3 +66,30 @@ func ShutdownService(serviceName ServiceName, url string) error {
 
 	return nil
 }
+
+// 通知注册中心节点进入下线迁移, 之后新的key不再路由到该节点
+func DrainService(serviceName ServiceName, url string) error {
+	r := RegistrationVO{
+		ServiceName: serviceName,
+		ServiceURL:  url,
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	err := enc.Encode(r)
+	if err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		return err
+	}
+	res, err := http.Post(
+		ServiceURL+"/drain",
+		"application/json",
+		buf)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to drain service. "+
+			"Register service response with code %v", res.StatusCode)
+	}
+	return nil
+}
@@ -14,6 +14,14 @@ type GetServiceVO struct {
 	Key         string      `form:"key" json:"key" validate:"required"`
 }
 
+type GetNodesVO struct {
+	ServiceName ServiceName `form:"serviceName" json:"serviceName" validate:"required"`
+}
+
+type GetNodesDTO struct {
+	Urls []string `json:"urls"`
+}
+
 // type Registration struct {
 // 	ServiceName ServiceName
 // 	ServiceURL  string
@@ -20,19 +20,24 @@ import (
 const (
 	ServiceHost = "localhost"
 	ServicePort = "9999"
-	ServiceURL  = "http://" + ServiceHost + ":" + ServicePort + "/services"
 )
 
+// 注册中心地址, 节点启动前可修改
+var ServiceURL = "http://" + ServiceHost + ":" + ServicePort + "/services"
+
 type registry struct {
 	registration map[ServiceName][]string // sericeName:[]string || 服务名:URLS
 	mutex        *sync.RWMutex
 	virtualNode  map[ServiceName]*consistenthash.Map
+	// 正在下线迁移的节点, 不再参与hash环
+	draining map[ServiceName]map[string]struct{}
 }
 
 var selfReg = registry{
 	registration: make(map[ServiceName][]string, 0),
 	mutex:        new(sync.RWMutex),
 	virtualNode:  make(map[ServiceName]*consistenthash.Map),
+	draining:     make(map[ServiceName]map[string]struct{}),
 }
 
 func RegisterHandlers(router *gin.Engine) {
@@ -40,10 +45,14 @@ func RegisterHandlers(router *gin.Engine) {
 	// 获取服务
 	router.GET("/services", getService)
 	router.POST("/services/get", getService)
+	// 获取服务的全部节点, 供客户端自行路由
+	router.GET("/services/nodes", getNodes)
 	// 注册服务
 	router.POST("/services", addService)
 	// 注销服务
 	router.DELETE("/services", removeService)
+	// 节点下线迁移
+	router.POST("/services/drain", drainService)
 }
 
 // 服务注册
@@ -91,6 +100,29 @@ func removeService(ctx *gin.Context) {
 	response.ResponseMsg.SuccessResponse(ctx, nil)
 }
 
+// 节点下线迁移: 从hash环中摘除, 但保留注册直到节点注销
+func drainService(ctx *gin.Context) {
+	var r RegistrationVO
+	ctx.ShouldBind(&r)
+	err := valid.Verification.Verify(r)
+	if err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		response.ResponseMsg.FailResponse(ctx, err, nil)
+		return
+	}
+	zklog.Logger.WithFields(logrus.Fields{
+		"ServiceName": r.ServiceName,
+		"ServiceURL":  r.ServiceURL,
+	}).Info("Draining service:")
+	err = selfReg.drain(r)
+	if err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		response.ResponseMsg.FailResponse(ctx, err, nil)
+		return
+	}
+	response.ResponseMsg.SuccessResponse(ctx, nil)
+}
+
 func urlsExistUrl(urls []string, serviceUrl string) bool {
 	urlMap := make(map[string]struct{}, 0)
 	for i := 0; i < len(urls); i++ {
@@ -112,6 +144,7 @@ func (r *registry) add(reg RegistrationVO) error {
 		r.registration[serviceName] = append(r.registration[serviceName], serviceUrl)
 	}
 
+	delete(r.draining[serviceName], serviceUrl)
 	// 注册虚拟节点
 	if _, ok := r.virtualNode[serviceName]; !ok {
 		r.virtualNode[serviceName] = consistenthash.New(5, nil)
@@ -130,6 +163,7 @@ func (r *registry) remove(reg RegistrationVO) error {
 			if r.registration[serviceName][i] == serviceUrl {
 				r.registration[serviceName] = append(r.registration[serviceName][:i], r.registration[serviceName][i+1:]...)
 				selfReg.virtualNode[serviceName].RemoveNodeByUrl(serviceUrl)
+				delete(r.draining[serviceName], serviceUrl)
 				go updateNodesMsg(serviceName)
 				return nil
 			}
@@ -141,6 +175,24 @@ func (r *registry) remove(reg RegistrationVO) error {
 		fmt.Sprintf("Not found serviceName: %s ,not found URL: %s", serviceName, serviceUrl))
 }
 
+func (r *registry) drain(reg RegistrationVO) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	serviceName := reg.ServiceName
+	serviceUrl := reg.ServiceURL
+	if !urlsExistUrl(r.registration[serviceName], serviceUrl) {
+		return response.NewErrWithMsg(response.PARAMETER_ERROR,
+			fmt.Sprintf("Not found serviceName: %s ,not found URL: %s", serviceName, serviceUrl))
+	}
+	if _, ok := r.draining[serviceName]; !ok {
+		r.draining[serviceName] = make(map[string]struct{})
+	}
+	r.draining[serviceName][serviceUrl] = struct{}{}
+	r.virtualNode[serviceName].RemoveNodeByUrl(serviceUrl)
+	go updateNodesMsg(serviceName)
+	return nil
+}
+
 // 心跳检测
 func Heartbeat(interval time.Duration) {
 	for {
@@ -278,3 +330,24 @@ func getService(ctx *gin.Context) {
 		Url: url,
 	})
 }
+
+// 按hash环顺序返回参与路由的节点, 不包含正在下线迁移的节点
+func getNodes(ctx *gin.Context) {
+	var r GetNodesVO
+	ctx.ShouldBind(&r)
+	err := valid.Verification.Verify(r)
+	if err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		response.ResponseMsg.FailResponse(ctx, err, nil)
+		return
+	}
+	selfReg.mutex.RLock()
+	defer selfReg.mutex.RUnlock()
+	urls := make([]string, 0)
+	if m, ok := selfReg.virtualNode[r.ServiceName]; ok {
+		urls = m.GetUrlsSortByKey()
+	}
+	response.ResponseMsg.SuccessResponse(ctx, GetNodesDTO{
+		Urls: urls,
+	})
+}
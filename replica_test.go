@@ -0,0 +1,133 @@
+package zkcache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/rpc"
+
+	"google.golang.org/grpc"
+)
+
+// 模拟service包中的节点间内部接口, 同时提供gRPC服务
+func newPeerServer(c *Controller) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		data, err := c.ServePeer(strings.TrimPrefix(r.URL.Path, "/"+defaultBaseUrl), body)
+		if err != nil {
+			code, _ := response.ErrCode(err)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": err.Error(), "data": data})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "msg": "success", "data": data})
+	})
+	// 同一进程中各节点的Controller名称不同, 忽略请求中的group
+	s := grpc.NewServer()
+	rpc.RegisterCacheServer(s, &grpcServer{controller: c, group: func(string, *Controller) (*Controller, error) { return c, nil }})
+	return httptest.NewServer(GRPCHandler(s, handler))
+}
+
+// 创建count个互为副本的节点
+func newCluster(t *testing.T, name string, count int, replicas int) ([]*Controller, []*httptest.Server) {
+	controllers := make([]*Controller, count)
+	servers := make([]*httptest.Server, count)
+	urls := make([]string, count)
+	for i := 0; i < count; i++ {
+		controllers[i] = NewController(name+string(rune('0'+i)), 0, nil, nil)
+		controllers[i].SetReplicas(replicas)
+		servers[i] = newPeerServer(controllers[i])
+		urls[i] = servers[i].URL
+		controllers[i].SetSelfUrl(urls[i])
+	}
+	for _, c := range controllers {
+		c.nodePool.Set(urls...)
+	}
+	t.Cleanup(func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	})
+	return controllers, servers
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not satisfied")
+}
+
+// 按节点url找到对应的Controller
+func byUrl(controllers []*Controller, url string) *Controller {
+	for _, c := range controllers {
+		if c.nodePool.self() == url {
+			return c
+		}
+	}
+	return nil
+}
+
+// key的副本节点之外的Controller
+func outsider(controllers []*Controller, key string) *Controller {
+	nodes := controllers[0].nodePool.PickNodes(key, controllers[0].Replicas())
+	for _, c := range controllers {
+		if !containsNode(nodes, c.nodePool.self()) {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSetReplicates(t *testing.T) {
+	controllers, _ := newCluster(t, "replica-set", 3, 2)
+	if err := controllers[0].Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	nodes := controllers[0].nodePool.PickNodes("k", 2)
+	for _, node := range nodes {
+		c := byUrl(controllers, node)
+		waitFor(t, func() bool {
+			v, ok := c.cache.get("k")
+			return ok && v == "v"
+		})
+	}
+	if _, ok := outsider(controllers, "k").cache.get("k"); ok {
+		t.Fatal("value should only live on replicas")
+	}
+}
+
+func TestReadRepairAndFailover(t *testing.T) {
+	controllers, servers := newCluster(t, "replica-read", 3, 2)
+	key := "k"
+	nodes := controllers[0].nodePool.PickNodes(key, 2)
+	owner, replica := byUrl(controllers, nodes[0]), byUrl(controllers, nodes[1])
+	owner.cache.merge(lru.Entry{Key: key, Value: "new", Version: 10})
+	replica.cache.merge(lru.Entry{Key: key, Value: "old", Version: 5})
+
+	reader := outsider(controllers, key)
+	if view, err := reader.Get(key, 0); err != nil || string(view) != "new" {
+		t.Fatal("should read the latest version", string(view), err)
+	}
+	waitFor(t, func() bool {
+		e, ok := replica.GetLocal(key)
+		return ok && e.Value == "new" && e.Version == 10
+	})
+
+	for i, srv := range servers {
+		if controllers[i] == owner {
+			srv.Close()
+		}
+	}
+	if view, err := reader.Get(key, 0); err != nil || string(view) != "new" {
+		t.Fatal("should fail over to replica", string(view), err)
+	}
+}
@@ -0,0 +1,139 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 单个请求参数的最大长度
+	maxBulkLen = 64 << 20
+	// 单行(inline命令或协议头)的最大长度
+	maxLineLen = 64 << 10
+	// 单个命令的最大参数个数
+	maxArgs = 1024 * 1024
+	// 单个命令所有参数的最大总长度
+	maxCommandLen = 128 << 20
+)
+
+var errProtocol = errors.New("Protocol error")
+
+// 读取客户端命令: RESP数组或以空格分隔的inline命令
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+func (r *Reader) ReadCommand() ([]string, error) {
+	var line string
+	// 跳过空行
+	for len(line) == 0 {
+		var err error
+		if line, err = r.readLine(); err != nil {
+			return nil, err
+		}
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, errProtocol
+	}
+	// 参数个数由客户端声明, 不按声明的大小预先分配
+	capacity := n
+	if capacity > 16 {
+		capacity = 16
+	}
+	args := make([]string, 0, capacity)
+	total := 0
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen || total+size > maxCommandLen {
+			return nil, errProtocol
+		}
+		total += size
+		// 按实际收到的数据增长, 避免声明很大的长度占用内存
+		buf := bytes.Buffer{}
+		if _, err := io.CopyN(&buf, r.r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		args = append(args, string(buf.Bytes()[:size]))
+	}
+	return args, nil
+}
+
+// 读取一行, 超过maxLineLen时返回协议错误
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		part, err := r.r.ReadSlice('\n')
+		if len(line)+len(part) > maxLineLen {
+			return "", errProtocol
+		}
+		line = append(line, part...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// 按RESP2格式写入响应, 调用Flush后发出
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) WriteSimple(s string) {
+	fmt.Fprintf(w.w, "+%s\r\n", s)
+}
+
+func (w *Writer) WriteError(msg string) {
+	fmt.Fprintf(w.w, "-%s\r\n", msg)
+}
+
+func (w *Writer) WriteInt(n int64) {
+	fmt.Fprintf(w.w, ":%d\r\n", n)
+}
+
+func (w *Writer) WriteBulk(s string) {
+	fmt.Fprintf(w.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (w *Writer) WriteNull() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// 写入数组头, 之后需要写入n个元素
+func (w *Writer) WriteArray(n int) {
+	fmt.Fprintf(w.w, "*%d\r\n", n)
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
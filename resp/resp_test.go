@@ -0,0 +1,176 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	zkcache "zkCache"
+)
+
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, name string) *client {
+	c := zkcache.NewController(name, 0, func(key string) (string, error) {
+		if key == "db" {
+			return "db-value", nil
+		}
+		return "", fmt.Errorf("%s not exist", key)
+	}, nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(c)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// 发送命令并读取一个完整的响应, 数组按行拼接
+func (c *client) do(t *testing.T, args ...string) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		t.Fatal(err)
+	}
+	return c.read(t)
+}
+
+func (c *client) read(t *testing.T) string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '$':
+		var n int
+		fmt.Sscanf(line, "$%d", &n)
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.read(t)
+		}
+		return strings.Join(items, ",")
+	}
+	return line
+}
+
+func TestCommands(t *testing.T) {
+	c := dial(t, "resp-commands")
+	cases := [][]string{
+		{"PING", "+PONG"},
+		{"PING hello", "hello"},
+		{"SET k v", "+OK"},
+		{"GET k", "v"},
+		{"GET missing", "(nil)"},
+		{"GET db", "db-value"},
+		{"MGET k missing db", "v,(nil),db-value"},
+		{"EXISTS k missing db", ":2"},
+		{"TTL k", ":-1"},
+		{"SET k v2 EX 100", "+OK"},
+		{"TTL k", ":100"},
+		{"SET k v3 PX 2600", "+OK"},
+		{"TTL k", ":3"},
+		{"SET k v4", "+OK"},
+		{"TTL k", ":-1"},
+		{"TTL missing", ":-2"},
+		{"INCR n", ":1"},
+		{"INCR n", ":2"},
+		{"INCR k", "-ERR value is not an integer or out of range"},
+		{"DEL k n missing", ":2"},
+		{"EXISTS k", ":0"},
+		{"SET k", "-ERR wrong number of arguments for 'set' command"},
+		{"SET k v EX", "-ERR syntax error"},
+		{"SET k v EX 0", "-ERR invalid expire time in 'set' command"},
+		{"FLUSHALL", "-ERR unknown command 'FLUSHALL'"},
+	}
+	for _, tc := range cases {
+		if got := c.do(t, strings.Fields(tc[0])...); got != tc[1] {
+			t.Fatalf("%s: want %q, got %q", tc[0], tc[1], got)
+		}
+	}
+	if info := c.do(t, "INFO"); !strings.Contains(info, "controller:resp-commands") || !strings.Contains(info, "keyspace_hits:") {
+		t.Fatal("check info", info)
+	}
+}
+
+func TestInline(t *testing.T) {
+	c := dial(t, "resp-inline")
+	c.conn.Write([]byte("SET k v\r\nGET k\r\nQUIT\r\n"))
+	if got := c.read(t) + " " + c.read(t) + " " + c.read(t); got != "+OK v +OK" {
+		t.Fatal("check inline", got)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	c := dial(t, "resp-protocol")
+	c.conn.Write([]byte("*1\r\n+GET\r\n"))
+	if got := c.read(t); got != "-ERR Protocol error" {
+		t.Fatal("check protocol error", got)
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	// 大量空行不应递归
+	r := NewReader(strings.NewReader(strings.Repeat("\r\n", 1<<20) + "PING\r\n"))
+	if args, err := r.ReadCommand(); err != nil || len(args) != 1 || args[0] != "PING" {
+		t.Fatal("blank lines should be skipped", args, err)
+	}
+	r = NewReader(strings.NewReader(strings.Repeat("a", maxLineLen+1) + "\r\n"))
+	if _, err := r.ReadCommand(); err != errProtocol {
+		t.Fatal("long line should be rejected", err)
+	}
+	r = NewReader(strings.NewReader("*1\r\n$" + strconv.Itoa(maxBulkLen+1) + "\r\n"))
+	if _, err := r.ReadCommand(); err != errProtocol {
+		t.Fatal("large bulk should be rejected", err)
+	}
+	// 多个参数的总长度超过上限
+	parts := []io.Reader{strings.NewReader("*3\r\n")}
+	for i := 0; i < 3; i++ {
+		parts = append(parts, strings.NewReader("$"+strconv.Itoa(maxBulkLen)+"\r\n"),
+			io.LimitReader(zeros{}, maxBulkLen), strings.NewReader("\r\n"))
+	}
+	r = NewReader(io.MultiReader(parts...))
+	if _, err := r.ReadCommand(); err != errProtocol {
+		t.Fatal("large command should be rejected", err)
+	}
+	// 声明的长度大于实际数据
+	r = NewReader(strings.NewReader("*1\r\n$1000000\r\nabc"))
+	if _, err := r.ReadCommand(); err != io.ErrUnexpectedEOF {
+		t.Fatal("truncated bulk should fail", err)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
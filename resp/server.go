@@ -0,0 +1,290 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	zkcache "zkCache"
+	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RESP2协议的TCP服务, 命令映射到Controller上, 与HTTP接口使用相同的节点路由
+type Server struct {
+	controller *zkcache.Controller
+	mu         sync.Mutex
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+}
+
+type command struct {
+	// 参数个数(包含命令名), 负数表示至少-arity个
+	arity int
+	fn    func(s *Server, args []string, w *Writer)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":    {2, (*Server).get},
+		"set":    {-3, (*Server).set},
+		"del":    {-2, (*Server).del},
+		"exists": {-2, (*Server).exists},
+		"mget":   {-2, (*Server).mget},
+		"incr":   {2, (*Server).incr},
+		"ttl":    {2, (*Server).ttl},
+		"ping":   {-1, (*Server).ping},
+		"info":   {-1, (*Server).info},
+		// redis-cli启动时会发送COMMAND DOCS
+		"command": {-1, func(s *Server, args []string, w *Writer) { w.WriteArray(0) }},
+	}
+}
+
+func NewServer(controller *zkcache.Controller) *Server {
+	return &Server{controller: controller, conns: make(map[net.Conn]struct{})}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// 处理连接直到Close, Close之后返回nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// 关闭监听和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r, w := NewReader(conn), NewWriter(conn)
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.WriteError("ERR " + err.Error())
+				w.Flush()
+			} else if err != io.EOF {
+				zklog.Logger.WithFields(logrus.Fields{
+					"remote": conn.RemoteAddr().String(),
+					"err":    err.Error(),
+				}).Debug("resp connection closed")
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToLower(args[0])
+		if name == "quit" {
+			w.WriteSimple("OK")
+			w.Flush()
+			return
+		}
+		s.exec(name, args, w)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) exec(name string, args []string, w *Writer) {
+	cmd, ok := commands[name]
+	if !ok {
+		w.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	cmd.fn(s, args, w)
+}
+
+// 加载失败视为key不存在
+func (s *Server) get(args []string, w *Writer) {
+	if v, err := s.controller.Get(args[1], 0); err == nil {
+		w.WriteBulk(string(v))
+	} else {
+		w.WriteNull()
+	}
+}
+
+// SET key value [EX seconds|PX milliseconds]
+// 与redis一致, 不带过期时间时取消key原有的过期时间
+func (s *Server) set(args []string, w *Writer) {
+	ttl := zkcache.NoExpire
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		if (opt != "ex" && opt != "px") || i+1 >= len(args) {
+			w.WriteError("ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+		if opt == "ex" {
+			ttl = time.Duration(n) * time.Second
+		} else {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+		i++
+	}
+	if err := s.controller.SetWithTTL(args[1], args[2], ttl); err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.WriteSimple("OK")
+}
+
+func (s *Server) del(args []string, w *Writer) {
+	n := int64(0)
+	for _, key := range args[1:] {
+		exist, err := s.controller.Delete(key)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		if exist {
+			n++
+		}
+	}
+	w.WriteInt(n)
+}
+
+// 只检查缓存, 不会触发加载
+func (s *Server) exists(args []string, w *Writer) {
+	n := int64(0)
+	for _, key := range args[1:] {
+		_, found, err := s.controller.Peek(key)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		if found {
+			n++
+		}
+	}
+	w.WriteInt(n)
+}
+
+func (s *Server) mget(args []string, w *Writer) {
+	w.WriteArray(len(args) - 1)
+	for _, key := range args[1:] {
+		if v, err := s.controller.Get(key, 0); err == nil {
+			w.WriteBulk(string(v))
+		} else {
+			w.WriteNull()
+		}
+	}
+}
+
+func (s *Server) incr(args []string, w *Writer) {
+	n, err := s.controller.Incr(args[1], 1, 0)
+	if err != nil {
+		if code, ok := response.ErrCode(err); ok && code == response.PARAMETER_ERROR {
+			w.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		writeErr(w, err)
+		return
+	}
+	w.WriteInt(n)
+}
+
+// 不存在返回-2, 没有过期时间返回-1, 否则返回剩余秒数
+func (s *Server) ttl(args []string, w *Writer) {
+	e, found, err := s.controller.Peek(args[1])
+	switch {
+	case err != nil:
+		writeErr(w, err)
+	case !found:
+		w.WriteInt(-2)
+	case e.Expire == 0:
+		w.WriteInt(-1)
+	default:
+		left := time.Until(time.Unix(0, e.Expire))
+		w.WriteInt(int64((left + 500*time.Millisecond) / time.Second))
+	}
+}
+
+func (s *Server) ping(args []string, w *Writer) {
+	if len(args) > 1 {
+		w.WriteBulk(args[1])
+		return
+	}
+	w.WriteSimple("PONG")
+}
+
+func (s *Server) info(args []string, w *Writer) {
+	stats := s.controller.Stats()
+	used, limit := zkcache.MemoryUsage()
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "# Server\r\ncontroller:%s\r\n", stats.Name)
+	fmt.Fprintf(&b, "# Memory\r\nused_memory:%d\r\nmemory_budget:%d\r\n", used, limit)
+	fmt.Fprintf(&b, "# Stats\r\nkeys:%d\r\nbytes:%d\r\nkeyspace_hits:%d\r\nhot_hits:%d\r\nkeyspace_misses:%d\r\nevicted_keys:%d\r\n",
+		stats.Entries, stats.Bytes, stats.Hits, stats.HotHits, stats.Misses, stats.Evictions)
+	fmt.Fprintf(&b, "rejected_too_large:%d\r\nrejected_admission:%d\r\n",
+		stats.Rejections[lru.ReasonTooLarge], stats.Rejections[lru.ReasonRejected])
+	w.WriteBulk(b.String())
+}
+
+func writeErr(w *Writer, err error) {
+	w.WriteError("ERR " + strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
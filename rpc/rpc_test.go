@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"zkCache/pkg/response"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestError(t *testing.T) {
+	err := Error(context.Background(), response.NewErr(response.VERSION_MISMATCH))
+	if status.Code(err) != codes.Aborted {
+		t.Fatal("check status code", err)
+	}
+	back := FromError(err, metadata.Pairs(codeTrailer, "2001"))
+	if code, ok := response.ErrCode(back); !ok || code != response.VERSION_MISMATCH || back.Error() != "数据版本不一致" {
+		t.Fatal("check business error", back)
+	}
+
+	// 没有trailer的视为传输错误
+	transport := status.Error(codes.Unavailable, "connection refused")
+	if _, ok := response.ErrCode(FromError(transport, nil)); ok {
+		t.Fatal("transport error should not be business error")
+	}
+	if status.Code(Error(context.Background(), errors.New("boom"))) != codes.Internal {
+		t.Fatal("unknown error should be Internal")
+	}
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"zkCache/pkg/response"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 业务错误码通过trailer传递, 客户端据此还原 response 包中的错误;
+// 不带该trailer的错误(如连接失败, 超时)视为传输错误
+const codeTrailer = "zkcache-code"
+
+// 业务错误附带的JSON数据(Peer方法), 二进制trailer
+const dataTrailer = "zkcache-data-bin"
+
+// 业务错误码对应的gRPC状态码
+func grpcCode(code int) codes.Code {
+	switch code {
+	case response.PARAMETER_ERROR, response.ENTRY_TOO_LARGE:
+		return codes.InvalidArgument
+	case response.VERSION_MISMATCH:
+		return codes.Aborted
+	case response.LOCK_HELD, response.LOCK_NOT_HELD:
+		return codes.FailedPrecondition
+	case response.NOT_FOUND:
+		return codes.NotFound
+	}
+	return codes.Internal
+}
+
+// 服务端将错误转换为gRPC状态, 并在trailer中带上业务错误码
+func Error(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	code, _ := response.ErrCode(err)
+	grpc.SetTrailer(ctx, metadata.Pairs(codeTrailer, strconv.Itoa(code)))
+	return status.Error(grpcCode(code), err.Error())
+}
+
+// 服务端在返回业务错误前设置错误附带的数据
+func SetErrorData(ctx context.Context, data []byte) {
+	grpc.SetTrailer(ctx, metadata.Pairs(dataTrailer, string(data)))
+}
+
+// 客户端读取业务错误附带的数据, 没有时返回nil
+func ErrorData(trailer metadata.MD) []byte {
+	if values := trailer.Get(dataTrailer); len(values) > 0 {
+		return []byte(values[0])
+	}
+	return nil
+}
+
+// 客户端还原业务错误, 传输错误原样返回
+func FromError(err error, trailer metadata.MD) error {
+	if err == nil {
+		return nil
+	}
+	values := trailer.Get(codeTrailer)
+	if len(values) == 0 {
+		return err
+	}
+	code, convErr := strconv.Atoi(values[0])
+	if convErr != nil {
+		return err
+	}
+	return response.NewErrWithMsg(code, status.Convert(err).Message())
+}
+
+// 客户端连接选项, 调用返回的业务错误可用 response.ErrCode 判断
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(streamClientInterceptor),
+	}
+}
+
+func unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var trailer metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+	return FromError(err, trailer)
+}
+
+func streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &clientStream{stream}, nil
+}
+
+// 流结束时从trailer还原业务错误
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return FromError(err, s.Trailer())
+}
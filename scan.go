@@ -0,0 +1,88 @@
+package zkcache
+
+import (
+	"sort"
+	"sync"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 单次扫描返回的最大条数
+const maxScanLimit = 1000
+
+type ScanReq struct {
+	Prefix string `json:"prefix"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type ScanResp struct {
+	Keys []string `json:"keys"`
+	// 下一页的cursor, 为空表示扫描结束
+	Cursor string `json:"cursor"`
+}
+
+func scanLimit(limit int) int {
+	if limit <= 0 || limit > maxScanLimit {
+		return maxScanLimit
+	}
+	return limit
+}
+
+// 扫描所有节点上以prefix开头的key, 结果按字典序排列并去重(副本)
+// 各节点使用同一个cursor, 合并后取前limit个, 最后一个key即为整个集群的下一页cursor
+func (c *Controller) Scan(prefix string, cursor string, limit int) (ScanResp, error) {
+	limit = scanLimit(limit)
+	req := ScanReq{Prefix: prefix, Cursor: cursor, Limit: limit}
+	peers := c.nodePool.peers()
+	pages := make([]ScanResp, len(peers)+1)
+	errs := make([]error, len(peers))
+	pages[len(peers)] = c.ScanLocal(req)
+	var wg sync.WaitGroup
+	for i, node := range peers {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			errs[i] = c.nodePool.post(node, "scan", c.name, req, &pages[i])
+		}(i, node)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"node": peers[i],
+				"err":  err.Error(),
+			}).Warn("scan failed")
+			return ScanResp{}, err
+		}
+	}
+
+	more := false
+	set := make(map[string]struct{})
+	keys := make([]string, 0)
+	for _, page := range pages {
+		more = more || page.Cursor != ""
+		for _, key := range page.Keys {
+			if _, ok := set[key]; !ok {
+				set[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+		more = true
+	}
+	resp := ScanResp{Keys: keys}
+	if more && len(keys) > 0 {
+		resp.Cursor = keys[len(keys)-1]
+	}
+	return resp, nil
+}
+
+func (c *Controller) ScanLocal(req ScanReq) ScanResp {
+	keys, next := c.cache.scan(req.Prefix, req.Cursor, scanLimit(req.Limit))
+	return ScanResp{Keys: keys, Cursor: next}
+}
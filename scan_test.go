@@ -0,0 +1,39 @@
+package zkcache
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	controllers, _ := newCluster(t, "scan", 3, 2)
+	want := make([]string, 0)
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("user:%02d", i)
+		want = append(want, key)
+		controllers[i%3].Set(key, "v")
+		controllers[i%3].Set(fmt.Sprintf("order:%02d", i), "v")
+	}
+	sort.Strings(want)
+
+	got := make([]string, 0)
+	cursor := ""
+	for {
+		page, err := controllers[0].Scan("user:", cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Keys) > 10 {
+			t.Fatal("page too large", len(page.Keys))
+		}
+		got = append(got, page.Keys...)
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatal("check scan result", got)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	zkcache "zkCache"
+	"zkCache/loader"
+	"zkCache/pkg/response"
+	"zkCache/ratelimit"
+	"zkCache/zklog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unknwon/com"
+)
+
+// 对外开放的缓存操作接口
+func apiService(router *gin.Engine, controller *zkcache.Controller) {
+	// /api?key=&code=&group=  读取key, 未命中时由归属节点加载; 节点间的HTTP传输也使用该接口
+	// 使用者已注册/api时保留使用者的接口
+	if !hasRoute(router, http.MethodGet, "/api") {
+		router.GET("/api", func(ctx *gin.Context) {
+			c, ok := peerController(ctx, controller)
+			if !ok {
+				return
+			}
+			view, err := c.Get(ctx.Query("key"), com.StrTo(ctx.Query("code")).MustInt64())
+			if err != nil {
+				response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.NOT_FOUND, err.Error()), nil)
+				return
+			}
+			response.ResponseMsg.SuccessResponse(ctx, string(view))
+		})
+	}
+	// /incr?key=&delta=&ttl=  delta默认为1, ttl单位秒, 仅在key不存在时生效
+	router.GET("/incr", func(ctx *gin.Context) {
+		counter(ctx, controller, 1)
+	})
+	router.GET("/decr", func(ctx *gin.Context) {
+		counter(ctx, controller, -1)
+	})
+	// /invalidateTag?tag=  删除所有节点上带有该标签的缓存
+	router.GET("/invalidateTag", func(ctx *gin.Context) {
+		tag := ctx.Query("tag")
+		if tag == "" {
+			response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+			return
+		}
+		n, err := controller.InvalidateTag(tag)
+		if err != nil {
+			zklog.Logger.WithField("err", err).Warn()
+		}
+		response.ResponseMsg.SuccessResponse(ctx, n)
+	})
+	// /stats  本节点的运行统计
+	router.GET("/stats", func(ctx *gin.Context) {
+		response.ResponseMsg.SuccessResponse(ctx, controller.Stats())
+	})
+	// /loaders  本节点各分组数据源的加载统计
+	router.GET("/loaders", func(ctx *gin.Context) {
+		response.ResponseMsg.SuccessResponse(ctx, loader.AllStats())
+	})
+	// /ratelimit?key=&limit=&window=&algorithm=&n=  在key的归属节点上申请额度
+	// window为时长(如 1s、1m)或秒数, algorithm为 token_bucket(默认) 或 sliding_window
+	router.GET("/ratelimit", func(ctx *gin.Context) {
+		window := duration(ctx.Query("window"))
+		res, err := controller.RateLimit(zkcache.RateLimitReq{
+			Key:       ctx.Query("key"),
+			Algorithm: ratelimit.Algorithm(ctx.Query("algorithm")),
+			Limit:     com.StrTo(ctx.Query("limit")).MustInt64(),
+			Window:    window.Milliseconds(),
+			N:         com.StrTo(ctx.Query("n")).MustInt64(),
+		})
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, res)
+	})
+	// /lock?key=&ttl=  在key的归属节点上加锁, 返回fencing token; ttl格式同window
+	router.POST("/lock", func(ctx *gin.Context) {
+		l, err := controller.Lock(ctx.Query("key"), duration(ctx.Query("ttl")))
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, l)
+	})
+	// /unlock?key=&token=
+	router.POST("/unlock", func(ctx *gin.Context) {
+		err := controller.Unlock(ctx.Query("key"), uint64(com.StrTo(ctx.Query("token")).MustInt64()))
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, nil)
+	})
+	// /refresh?key=&token=&ttl=  续期为从现在开始的ttl
+	router.POST("/refresh", func(ctx *gin.Context) {
+		l, err := controller.Refresh(ctx.Query("key"), uint64(com.StrTo(ctx.Query("token")).MustInt64()),
+			duration(ctx.Query("ttl")))
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, l)
+	})
+	// /hotkeys  本节点统计到的热点key
+	router.GET("/hotkeys", func(ctx *gin.Context) {
+		response.ResponseMsg.SuccessResponse(ctx, controller.HotKeys())
+	})
+	// /scan?prefix=&cursor=&limit=  按前缀分页扫描所有节点上的key
+	router.GET("/scan", func(ctx *gin.Context) {
+		resp, err := controller.Scan(ctx.Query("prefix"), ctx.Query("cursor"),
+			com.StrTo(ctx.Query("limit")).MustInt())
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, resp)
+	})
+}
+
+func hasRoute(router *gin.Engine, method string, path string) bool {
+	for _, r := range router.Routes() {
+		if r.Method == method && r.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// 时长(如 1s、1m)或秒数
+func duration(s string) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	return time.Duration(com.StrTo(s).MustInt64()) * time.Second
+}
+
+func counter(ctx *gin.Context, controller *zkcache.Controller, sign int64) {
+	key := ctx.Query("key")
+	if key == "" {
+		response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+		return
+	}
+	delta := int64(1)
+	if d, ok := ctx.GetQuery("delta"); ok {
+		var err error
+		if delta, err = strconv.ParseInt(d, 10, 64); err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.PARAMETER_ERROR, "delta is not an integer or out of range"), nil)
+			return
+		}
+	}
+	var ttl time.Duration
+	if t := ctx.Query("ttl"); t != "" {
+		seconds, err := strconv.ParseInt(t, 10, 64)
+		if err != nil || seconds < 0 {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.PARAMETER_ERROR, "ttl is not a non-negative integer"), nil)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	var n int64
+	var err error
+	if sign < 0 {
+		n, err = controller.Decr(key, delta, ttl)
+	} else {
+		n, err = controller.Incr(key, delta, ttl)
+	}
+	if err != nil {
+		response.ResponseMsg.FailResponse(ctx, err, nil)
+		return
+	}
+	response.ResponseMsg.SuccessResponse(ctx, n)
+}
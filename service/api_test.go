@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	zkcache "zkCache"
+	"zkCache/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 归属节点上不存在的key, 非归属节点不应再访问DB
+func TestAPIMissFromOwner(t *testing.T) {
+	var calls [2]int64
+	source := func(i int) zkcache.Get {
+		return func(key string) (string, error) {
+			atomic.AddInt64(&calls[i], 1)
+			return "", errors.New("not found")
+		}
+	}
+	owner := zkcache.NewController("apiMissOwner", 0, source(0), nil)
+	other := zkcache.NewController("apiMissOther", 0, source(1), nil)
+
+	router := gin.New()
+	// 同一进程中两个节点的分组名称不同, 转发到归属节点的Controller
+	router.Use(func(ctx *gin.Context) {
+		q := ctx.Request.URL.Query()
+		q.Set("group", owner.Name())
+		ctx.Request.URL.RawQuery = q.Encode()
+	})
+	peerService(router, owner)
+	apiService(router, owner)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	owner.SetSelfUrl(srv.URL)
+	owner.UpdateNodePool([]string{srv.URL})
+	other.SetSelfUrl("http://127.0.0.1:1")
+	other.UpdateNodePool([]string{srv.URL})
+
+	_, err := other.Get("missing", 0)
+	if code, ok := response.ErrCode(err); !ok || code != response.NOT_FOUND {
+		t.Fatal("missing key should be NOT_FOUND", err)
+	}
+	if calls != [2]int64{1, 0} {
+		t.Fatal("only the owner should query the data source", calls)
+	}
+}
+
+// 未注册的group返回PARAMETER_ERROR, 不使用默认的分组
+func TestAPIUnknownGroup(t *testing.T) {
+	c := zkcache.NewController("apiGroup", 0, nil, nil)
+	c.Set("key", "value")
+	router := gin.New()
+	apiService(router, c)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api?group=apiGroupTypo&key=key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Code int `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != response.PARAMETER_ERROR {
+		t.Fatal("unknown group should be PARAMETER_ERROR", body, err)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	zkcache "zkCache"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/unknwon/com"
+)
+
+// 每次从变更流读取的事件数
+const changeBatch = 100
+
+// 变更流: /events?epoch=&since=  按序号推送本节点的set/delete/expire/evict事件(SSE)
+// epoch和since为上次收到的最后一个事件的纪元和序号, 用于断点续传
+// 中间事件已被覆盖或节点重启后纪元改变时, 先推送一个lost事件; expire事件在读写到已过期的key时才产生
+func changeService(router *gin.Engine, controller *zkcache.Controller) {
+	router.GET("/events", func(ctx *gin.Context) {
+		c, ok := peerController(ctx, controller)
+		if !ok {
+			return
+		}
+		epoch := uint64(com.StrTo(ctx.Query("epoch")).MustInt64())
+		since := uint64(com.StrTo(ctx.Query("since")).MustInt64())
+		ctx.Stream(func(w io.Writer) bool {
+			events, lost, wait := c.Changes(epoch, since, changeBatch)
+			if lost {
+				if epoch != c.ChangeEpoch() {
+					since = 0
+				}
+				ctx.Render(-1, sse.Event{
+					Event: "lost",
+					Data:  gin.H{"epoch": c.ChangeEpoch(), "since": since},
+				})
+			}
+			epoch = c.ChangeEpoch()
+			for _, e := range events {
+				ctx.Render(-1, sse.Event{
+					Id:    strconv.FormatUint(e.Seq, 10),
+					Event: string(e.Op),
+					Data:  e,
+				})
+				since = e.Seq
+			}
+			if len(events) > 0 {
+				return true
+			}
+			select {
+			case <-wait:
+				return true
+			case <-ctx.Request.Context().Done():
+				return false
+			}
+		})
+	})
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"io/ioutil"
+	zkcache "zkCache"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/gin-gonic/gin"
+)
+
+const peerPrefix = "/_zkCache/"
+
+// 节点间内部接口, 具体处理见 zkcache.Controller.ServePeer
+func peerService(router *gin.Engine, controller *zkcache.Controller) {
+	router.POST(peerPrefix+":path", func(ctx *gin.Context) {
+		c, ok := peerController(ctx, controller)
+		if !ok {
+			return
+		}
+		body, err := ioutil.ReadAll(ctx.Request.Body)
+		if err != nil {
+			zklog.Logger.WithField("err", err).Error()
+			response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+			return
+		}
+		data, err := c.ServePeer(ctx.Param("path"), body)
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, data)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, data)
+	})
+}
+
+// 按请求中的group选择Controller, 未指定时使用本节点默认的Controller
+// group未注册时返回PARAMETER_ERROR, 此时调用方直接返回
+func peerController(ctx *gin.Context, controller *zkcache.Controller) (*zkcache.Controller, bool) {
+	c, err := zkcache.SelectController(ctx.Query("group"), controller)
+	if err != nil {
+		response.ResponseMsg.FailResponse(ctx, err, nil)
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bufio"
+	"strings"
+	zkcache "zkCache"
+	"zkCache/pkg/response"
+	"zkCache/zklog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/unknwon/com"
+)
+
+type prewarmVO struct {
+	Keys []string `json:"keys"`
+}
+
+type seedVO struct {
+	Entries map[string]string `json:"entries" binding:"required"`
+}
+
+// 集群预热接口, 请求断开时停止并返回当前进度
+func prewarmService(router *gin.Engine, controller *zkcache.Controller) {
+	// /prewarm?group=&concurrency=&rate=  请求体为 {"keys":[...]} 或每行一个key
+	// 每个key交给归属节点, 不在缓存中时通过数据源加载
+	router.POST("/prewarm", func(ctx *gin.Context) {
+		keys, err := prewarmKeys(ctx)
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.PARAMETER_ERROR, err.Error()), nil)
+			return
+		}
+		c, ok := peerController(ctx, controller)
+		if !ok {
+			return
+		}
+		report := c.Prewarm(ctx.Request.Context(), keys, prewarmConfig(ctx), logProgress("prewarm"))
+		response.ResponseMsg.SuccessResponse(ctx, report)
+	})
+	// /seed?group=&concurrency=&rate=&ttl=  请求体为 {"entries":{"key":"value"}}, 直接写入不访问数据源
+	// ttl格式同 /ratelimit 的window, 为空时使用默认过期时间
+	router.POST("/seed", func(ctx *gin.Context) {
+		vo := seedVO{}
+		if err := ctx.ShouldBindJSON(&vo); err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.PARAMETER_ERROR, err.Error()), nil)
+			return
+		}
+		c, ok := peerController(ctx, controller)
+		if !ok {
+			return
+		}
+		report := c.Seed(ctx.Request.Context(), vo.Entries, duration(ctx.Query("ttl")), prewarmConfig(ctx), logProgress("seed"))
+		response.ResponseMsg.SuccessResponse(ctx, report)
+	})
+}
+
+func prewarmConfig(ctx *gin.Context) zkcache.PrewarmConfig {
+	return zkcache.PrewarmConfig{
+		Concurrency: com.StrTo(ctx.Query("concurrency")).MustInt(),
+		Rate:        com.StrTo(ctx.Query("rate")).MustInt(),
+	}
+}
+
+// JSON请求体或每行一个key, 忽略空行
+func prewarmKeys(ctx *gin.Context) ([]string, error) {
+	if strings.HasPrefix(ctx.ContentType(), "application/json") {
+		vo := prewarmVO{}
+		if err := ctx.ShouldBindJSON(&vo); err != nil {
+			return nil, err
+		}
+		return vo.Keys, nil
+	}
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(ctx.Request.Body)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func logProgress(op string) func(zkcache.PrewarmReport) {
+	return func(r zkcache.PrewarmReport) {
+		zklog.Logger.WithFields(logrus.Fields{
+			"msg":    op + " ...",
+			"total":  r.Total,
+			"loaded": r.Loaded,
+			"cached": r.Cached,
+			"seeded": r.Seeded,
+			"failed": r.Failed,
+		}).Info()
+	}
+}
@@ -11,16 +11,40 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 	zkcache "zkCache"
+	"zkCache/memcache"
 	"zkCache/pkg/response"
 	"zkCache/registry"
+	"zkCache/resp"
 	"zkCache/zklog"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	// 下线迁移超时时间
+	DrainTimeout = 10 * time.Second
+	// 下线时迁移的热点数据条数, 0表示全部
+	DrainHotKeys = 1000
+	// RESP2协议(redis客户端)的监听地址, 如 ":6379"; 为空表示不开启
+	RespAddr = ""
+	// memcached文本协议的监听地址, 如 ":11211"; 为空表示不开启
+	MemcacheAddr = ""
+	// 节点间通信方式; gRPC服务与HTTP共用端口, 始终开启
+	PeerTransport = zkcache.TransportHTTP
+)
+
+// 除HTTP外的协议监听
+type listener interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
 // 启动服务并注册
+// createGroup返回节点的默认分组, 进程中创建的其他分组同样加入集群, 下线时一起迁移和关闭
+// routerFunc先于内置接口注册, 已注册GET /api时不再注册内置的/api, 此时需兼容节点间读取(key、code、group参数)
 func Start(ctx context.Context, host string, port int,
 	reg registry.RegistrationVO,
 	routerFunc func(router *gin.Engine, controller *zkcache.Controller),
@@ -41,17 +65,43 @@ func startService(ctx context.Context, serviceName registry.ServiceName,
 	ctx, cancel := context.WithCancel(ctx)
 	router := gin.New()
 	controller := createGroup()
-	controller.SetSelfUrl(fmt.Sprintf("http://%s:%d", host, port))
-	baseService(router, controller)
+	for _, c := range zkcache.Controllers() {
+		c.SetSelfUrl(fmt.Sprintf("http://%s:%d", host, port))
+		c.SetPeerTransport(PeerTransport)
+	}
 	routerFunc(router, controller)
+	baseService(router, controller)
+	// /drain  手动下线迁移, 进程继续运行直到收到退出信号
+	router.POST("/drain", func(ctx *gin.Context) {
+		report, err := drain(serviceName, fmt.Sprintf("http://%s:%d", host, port))
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.ERROR, err.Error()), nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, report)
+	})
+	grpcServer := zkcache.NewGRPCServer(controller)
 	srv := &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", host, port),
-		Handler:        router,
+		Handler:        zkcache.GRPCHandler(grpcServer, router),
 		MaxHeaderBytes: 1 << 20,
 	}
+	listeners := make([]listener, 0)
+	if RespAddr != "" {
+		listeners = append(listeners, startListener(resp.NewServer(controller), RespAddr))
+	}
+	if MemcacheAddr != "" {
+		listeners = append(listeners, startListener(memcache.NewServer(controller), MemcacheAddr))
+	}
+	// 主动关闭时, 等持久化完成后再注销
+	closed := make(chan struct{})
 	go func() {
-		zklog.Logger.WithField("msg", srv.ListenAndServe()).Warn()
-		err := registry.ShutdownService(serviceName, fmt.Sprintf("http://%s:%d", host, port))
+		err := srv.ListenAndServe()
+		zklog.Logger.WithField("msg", err).Warn()
+		if err == http.ErrServerClosed {
+			<-closed
+		}
+		err = registry.ShutdownService(serviceName, fmt.Sprintf("http://%s:%d", host, port))
 		if err != nil {
 			zklog.Logger.WithField("err", err).Error()
 		}
@@ -60,14 +110,85 @@ func startService(ctx context.Context, serviceName registry.ServiceName,
 	go func() {
 		zklog.Logger.WithField("msg",
 			fmt.Sprintf("%v started. Press use 'Ctrl + c' to stop.", serviceName)).Info()
-		stop := make(chan os.Signal)
+		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
 		<-stop
+		drain(serviceName, fmt.Sprintf("http://%s:%d", host, port))
+		for _, l := range listeners {
+			l.Close()
+		}
 		srv.Shutdown(ctx)
+		grpcServer.Stop()
+		for _, c := range zkcache.Controllers() {
+			closeController(c)
+		}
+		close(closed)
 	}()
 	return ctx
 }
 
+// 未写入数据源的操作需要在关闭持久化之前保存
+func closeController(c *zkcache.Controller) {
+	if err := c.CloseWriteback(); err != nil {
+		zklog.Logger.WithFields(logrus.Fields{"controller": c.Name(), "err": err.Error()}).Error("close writeback failed")
+	}
+	if err := c.ClosePersistence(); err != nil {
+		zklog.Logger.WithFields(logrus.Fields{"controller": c.Name(), "err": err.Error()}).Error("close persistence failed")
+	}
+	if err := c.CloseSpill(); err != nil {
+		zklog.Logger.WithFields(logrus.Fields{"controller": c.Name(), "err": err.Error()}).Error("close spill failed")
+	}
+}
+
+func startListener(l listener, addr string) listener {
+	go func() {
+		if err := l.ListenAndServe(addr); err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"addr": addr,
+				"err":  err.Error(),
+			}).Error("listen failed")
+		}
+	}()
+	return l
+}
+
+// 下线迁移: 先从hash环中摘除本节点, 再把各分组的热点数据推送给新的归属节点; 返回各分组的合计
+func drain(serviceName registry.ServiceName, url string) (zkcache.DrainReport, error) {
+	if err := registry.DrainService(serviceName, url); err != nil {
+		zklog.Logger.WithField("err", err).Error()
+		return zkcache.DrainReport{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DrainTimeout)
+	defer cancel()
+	start := time.Now()
+	total := zkcache.DrainReport{}
+	for _, c := range zkcache.Controllers() {
+		name := c.Name()
+		report := c.Drain(ctx, DrainHotKeys, func(r zkcache.DrainReport) {
+			zklog.Logger.WithFields(logrus.Fields{
+				"controller": name,
+				"total":      r.Total,
+				"sent":       r.Sent,
+				"failed":     r.Failed,
+			}).Info("draining ...")
+		})
+		zklog.Logger.WithFields(logrus.Fields{
+			"controller": name,
+			"total":      report.Total,
+			"sent":       report.Sent,
+			"failed":     report.Failed,
+			"skipped":    report.Skipped,
+			"elapsed":    report.Elapsed.String(),
+		}).Info("drain finished")
+		total.Total += report.Total
+		total.Sent += report.Sent
+		total.Failed += report.Failed
+		total.Skipped += report.Skipped
+	}
+	total.Elapsed = time.Since(start)
+	return total, nil
+}
+
 func baseService(router *gin.Engine, controller *zkcache.Controller) {
 	router.GET("/healthy", func(ctx *gin.Context) {
 		response.ResponseMsg.SuccessResponse(ctx, nil)
@@ -80,9 +201,16 @@ func baseService(router *gin.Engine, controller *zkcache.Controller) {
 		zklog.Logger.WithFields(logrus.Fields{
 			"urls": strings.Join(urls.Urls, ","),
 		}).Debug()
-		controller.UpdateNodePool(urls.Urls)
+		for _, c := range zkcache.Controllers() {
+			c.UpdateNodePool(urls.Urls)
+		}
 		response.ResponseMsg.SuccessResponse(ctx, nil)
 	})
+	peerService(router, controller)
+	apiService(router, controller)
+	topicService(router, controller)
+	changeService(router, controller)
+	prewarmService(router, controller)
 }
 
 type NodePoolMsg struct {
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"io"
+	zkcache "zkCache"
+	"zkCache/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unknwon/com"
+)
+
+type webhookVO struct {
+	Url string `json:"url" binding:"required"`
+}
+
+// 发布订阅接口
+func topicService(router *gin.Engine, controller *zkcache.Controller) {
+	router.GET("/topics", func(ctx *gin.Context) {
+		response.ResponseMsg.SuccessResponse(ctx, controller.Topics().Topics())
+	})
+	// 发布消息, 请求体即消息内容
+	router.POST("/topics/:topic", func(ctx *gin.Context) {
+		data, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+			return
+		}
+		msg, err := controller.Publish(ctx.Param("topic"), string(data))
+		if err != nil {
+			response.ResponseMsg.FailResponse(ctx, err, msg)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, msg)
+	})
+	// SSE订阅, since>0 时先重放本节点保留的序号大于since的消息
+	router.GET("/topics/:topic/subscribe", func(ctx *gin.Context) {
+		sub := controller.Topics().Subscribe(ctx.Param("topic"), uint64(com.StrTo(ctx.Query("since")).MustInt64()))
+		defer sub.Close()
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case msg, ok := <-sub.C:
+				if !ok {
+					return false
+				}
+				ctx.SSEvent(msg.Topic, msg)
+				return true
+			case <-ctx.Request.Context().Done():
+				return false
+			}
+		})
+	})
+	// 回调订阅: 之后发布到该主题的消息会POST到url; 允许的地址见 pubsub.SetWebhookHosts
+	router.POST("/topics/:topic/webhooks", func(ctx *gin.Context) {
+		hook := webhookVO{}
+		if err := ctx.ShouldBindJSON(&hook); err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+			return
+		}
+		if err := controller.Topics().AddWebhook(ctx.Param("topic"), hook.Url); err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErrWithMsg(response.PARAMETER_ERROR, err.Error()), nil)
+			return
+		}
+		response.ResponseMsg.SuccessResponse(ctx, nil)
+	})
+	router.DELETE("/topics/:topic/webhooks", func(ctx *gin.Context) {
+		hook := webhookVO{}
+		if err := ctx.ShouldBindJSON(&hook); err != nil {
+			response.ResponseMsg.FailResponse(ctx, response.NewErr(response.PARAMETER_ERROR), nil)
+			return
+		}
+		controller.Topics().RemoveWebhook(ctx.Param("topic"), hook.Url)
+		response.ResponseMsg.SuccessResponse(ctx, nil)
+	})
+}
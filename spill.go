@@ -0,0 +1,82 @@
+package zkcache
+
+import (
+	"fmt"
+	"path/filepath"
+	"zkCache/lru"
+	"zkCache/spill"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SpillConfig struct {
+	// 磁盘层文件所在目录
+	Dir string
+	// 磁盘层允许的最大空间, 0表示不限制  单位字节
+	MaxSize int64
+}
+
+// 开启磁盘层: 内存淘汰的数据写入磁盘, 内存未命中时先读磁盘再访问其他节点或DB
+// 应在EnablePersistence之前调用, 使恢复过程中淘汰的数据也能写入磁盘
+func (c *Controller) EnableSpill(cfg SpillConfig) error {
+	path := filepath.Join(cfg.Dir, c.name+".spill")
+	s, err := spill.Open(path, cfg.MaxSize)
+	if err != nil {
+		return err
+	}
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	if c.cache.disk != nil {
+		s.Close()
+		return fmt.Errorf("controller %s spill already enabled", c.name)
+	}
+	c.cache.disk = s
+	zklog.Logger.WithFields(logrus.Fields{
+		"controller": c.name,
+		"path":       path,
+		"entries":    s.Stats().Entries,
+	}).Info("spill enabled")
+	return nil
+}
+
+// 磁盘层统计, 未开启时返回false
+func (c *Controller) SpillStats() (spill.Stats, bool) {
+	c.cache.mu.Lock()
+	s := c.cache.disk
+	c.cache.mu.Unlock()
+	if s == nil {
+		return spill.Stats{}, false
+	}
+	return s.Stats(), true
+}
+
+// 关闭磁盘层, 文件保留, 下次开启时重建索引
+func (c *Controller) CloseSpill() error {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	if c.cache.disk == nil {
+		return nil
+	}
+	err := c.cache.disk.Close()
+	c.cache.disk = nil
+	return err
+}
+
+// 淘汰的数据写入磁盘, 其他变更使磁盘中的旧数据失效; 在持有缓存锁的情况下调用
+func (c *Controller) spillChange(op lru.Op, e lru.Entry) {
+	s := c.cache.disk
+	if s == nil {
+		return
+	}
+	if op != lru.OpEvict {
+		s.Remove(e.Key)
+		return
+	}
+	if err := s.Put(e); err != nil {
+		zklog.Logger.WithFields(logrus.Fields{
+			"key": e.Key,
+			"err": err.Error(),
+		}).Error("spill failed")
+	}
+}
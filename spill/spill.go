@@ -0,0 +1,474 @@
+package spill
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"zkCache/lru"
+)
+
+// 文件中无效记录超过有效记录且超过该大小时触发压缩
+const minCompactSize = 1 << 20
+
+// 磁盘层: 追加写的日志文件 + 内存索引
+// 超过maxSize时按写入顺序淘汰最早的数据
+// 写入和删除只修改内存索引, 记录由后台写入文件, 调用方不会因为磁盘IO阻塞
+type Store struct {
+	mu   sync.Mutex
+	path string
+	// 替换文件(压缩)时加写锁, 读文件时加读锁; 需在mu之后获取
+	fileMu sync.RWMutex
+	f      *os.File
+	// 允许的有效数据大小, 0表示不限制  单位字节
+	maxSize int64
+	// 有效记录大小
+	live int64
+	// 已写入文件的大小
+	total int64
+	index map[string]*list.Element
+	// 按写入顺序排列, 用于淘汰
+	order *list.List
+	// 等待写入文件的记录, 按顺序写入
+	queue []pending
+	// 每次修改索引加1, 用于判断读文件期间是否有变化
+	gen         uint64
+	compactions int
+	// 保证同一时间只有一个写文件或压缩的操作
+	writeMu sync.Mutex
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// 索引项, 值保存在文件中
+type location struct {
+	key     string
+	offset  int64
+	length  int64
+	version uint64
+	expire  int64
+	tags    []string
+	// 尚未写入文件的记录, 写入后为nil
+	buf []byte
+}
+
+type pending struct {
+	buf []byte
+	// 删除标记为nil
+	loc *location
+}
+
+type record struct {
+	Deleted bool      `json:"deleted,omitempty"`
+	Entry   lru.Entry `json:"entry"`
+}
+
+type Stats struct {
+	Entries     int   `json:"entries"`
+	LiveBytes   int64 `json:"liveBytes"`
+	FileBytes   int64 `json:"fileBytes"`
+	Compactions int   `json:"compactions"`
+}
+
+// 打开磁盘层文件, 扫描已有记录重建索引
+func Open(path string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		path:    path,
+		f:       f,
+		maxSize: maxSize,
+		index:   make(map[string]*list.Element),
+		order:   list.New(),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// maxSize可能比上次打开时小
+	s.evict()
+	go s.loop()
+	return s, nil
+}
+
+func (s *Store) load() error {
+	r := bufio.NewReader(io.NewSectionReader(s.f, 0, 1<<62))
+	offset := int64(0)
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// 末尾不完整的记录直接截断
+			s.total = offset
+			return s.f.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Deleted {
+			s.drop(rec.Entry.Key)
+		} else {
+			s.track(rec.Entry, &location{offset: offset, length: n})
+		}
+		offset += n
+	}
+}
+
+func readRecord(r io.Reader) (record, int64, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return record{}, 0, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return record{}, 0, err
+	}
+	rec := record{}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return record{}, 0, err
+	}
+	return rec, int64(4 + size), nil
+}
+
+func encodeRecord(rec record) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	return buf, nil
+}
+
+// 需持有锁
+func (s *Store) track(e lru.Entry, loc *location) {
+	s.drop(e.Key)
+	loc.key, loc.version, loc.expire, loc.tags = e.Key, e.Version, e.Expire, e.Tags
+	s.index[e.Key] = s.order.PushBack(loc)
+	s.live += loc.length
+	s.gen++
+}
+
+// 需持有锁
+func (s *Store) drop(key string) bool {
+	ele, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	s.live -= ele.Value.(*location).length
+	s.order.Remove(ele)
+	delete(s.index, key)
+	s.gen++
+	return true
+}
+
+// 超过maxSize时按写入顺序删除, 写入删除标记; 需持有锁
+func (s *Store) evict() {
+	for s.maxSize > 0 && s.live > s.maxSize && s.order.Len() > 0 {
+		s.remove(s.order.Front().Value.(*location).key)
+	}
+}
+
+// 记录加入写入队列, 由后台写入文件; 需持有锁
+func (s *Store) enqueue(p pending) {
+	s.queue = append(s.queue, p)
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// 写入磁盘层
+func (s *Store) Put(e lru.Entry) error {
+	buf, err := encodeRecord(record{Entry: e})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc := &location{length: int64(len(buf)), buf: buf}
+	s.track(e, loc)
+	s.enqueue(pending{buf: buf, loc: loc})
+	s.evict()
+	return nil
+}
+
+// 读取磁盘层, 已过期的数据视为不存在
+func (s *Store) Get(key string) (lru.Entry, bool) {
+	s.mu.Lock()
+	ele, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return lru.Entry{}, false
+	}
+	loc := ele.Value.(*location)
+	if loc.expire != 0 && loc.expire <= time.Now().UnixNano() {
+		s.remove(key)
+		s.mu.Unlock()
+		return lru.Entry{}, false
+	}
+	if loc.buf != nil {
+		buf := loc.buf
+		s.mu.Unlock()
+		rec, _, err := readRecord(bytes.NewReader(buf))
+		return rec.Entry, err == nil
+	}
+	// 持有读锁期间文件不会被替换, offset有效
+	offset, length := loc.offset, loc.length
+	s.fileMu.RLock()
+	s.mu.Unlock()
+	rec, _, err := readRecord(io.NewSectionReader(s.f, offset, length))
+	s.fileMu.RUnlock()
+	if err != nil {
+		return lru.Entry{}, false
+	}
+	return rec.Entry, true
+}
+
+// 是否存在, 不读取文件
+func (s *Store) Contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.index[key]
+	return ok
+}
+
+// 字典序大于cursor且以prefix开头的未过期的key, 无序
+func (s *Store) Keys(prefix string, cursor string) []string {
+	now := time.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0)
+	for key, ele := range s.index {
+		loc := ele.Value.(*location)
+		if key > cursor && strings.HasPrefix(key, prefix) && (loc.expire == 0 || loc.expire > now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 索引的版本, 每次写入或删除都会变化
+func (s *Store) Gen() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+func (s *Store) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// 需持有锁; 写入删除标记, 保证重新打开时不会恢复
+func (s *Store) remove(key string) {
+	if !s.drop(key) {
+		return
+	}
+	buf, err := encodeRecord(record{Deleted: true, Entry: lru.Entry{Key: key}})
+	if err == nil {
+		s.enqueue(pending{buf: buf})
+	}
+}
+
+// 删除带有标签tag的数据, 返回删除的个数
+func (s *Store) RemoveTag(tag string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0)
+	for key, ele := range s.index {
+		for _, t := range ele.Value.(*location).tags {
+			if t == tag {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	for _, key := range keys {
+		s.remove(key)
+	}
+	return len(keys)
+}
+
+func (s *Store) loop() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.kick:
+		case <-s.stop:
+			return
+		}
+		s.writeMu.Lock()
+		s.flush()
+		s.maybeCompact()
+		s.writeMu.Unlock()
+	}
+}
+
+// 将队列中的记录追加到文件, 不持有mu; 需持有writeMu
+func (s *Store) flush() error {
+	s.mu.Lock()
+	queue := s.queue
+	s.queue = nil
+	offset := s.total
+	s.mu.Unlock()
+	if len(queue) == 0 {
+		return nil
+	}
+	size := 0
+	for _, p := range queue {
+		size += len(p.buf)
+	}
+	data := make([]byte, 0, size)
+	for _, p := range queue {
+		data = append(data, p.buf...)
+	}
+	// 只有持有writeMu时才会写文件或替换s.f
+	if _, err := s.f.WriteAt(data, offset); err != nil {
+		// 放回队首等待下次写入, 期间仍从内存读取
+		s.mu.Lock()
+		s.queue = append(queue, s.queue...)
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Lock()
+	for _, p := range queue {
+		// 期间被覆盖或删除的记录同样需要更新, 它们可能仍被并发的读取引用
+		if p.loc != nil && p.loc.buf != nil {
+			p.loc.offset, p.loc.buf = offset, nil
+		}
+		offset += int64(len(p.buf))
+	}
+	s.total = offset
+	s.mu.Unlock()
+	return nil
+}
+
+// 需持有writeMu
+func (s *Store) maybeCompact() error {
+	s.mu.Lock()
+	need := s.total >= minCompactSize && s.total >= 2*s.live
+	s.mu.Unlock()
+	if !need {
+		return nil
+	}
+	return s.compact()
+}
+
+// 写入队列中的记录
+func (s *Store) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.flush()
+}
+
+// 将有效记录重写到新文件并替换
+func (s *Store) Compact() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.compact()
+}
+
+// 读写文件时不持有mu, 期间的写入和删除在队列中, 替换后追加到新文件; 需持有writeMu
+func (s *Store) compact() error {
+	s.mu.Lock()
+	locs := make([]*location, 0, s.order.Len())
+	for ele := s.order.Front(); ele != nil; ele = ele.Next() {
+		if loc := ele.Value.(*location); loc.buf == nil {
+			locs = append(locs, loc)
+		}
+	}
+	olds := make([]int64, len(locs))
+	for i, loc := range locs {
+		olds[i] = loc.offset
+	}
+	s.mu.Unlock()
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	offset := int64(0)
+	offsets := make([]int64, len(locs))
+	for i, loc := range locs {
+		buf := make([]byte, loc.length)
+		if _, err := s.f.ReadAt(buf, olds[i]); err != nil {
+			return fail(err)
+		}
+		w.Write(buf)
+		offsets[i] = offset
+		offset += loc.length
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	// 重命名后旧文件仍可通过已打开的s.f读取
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fail(err)
+	}
+	s.mu.Lock()
+	s.fileMu.Lock()
+	old := s.f
+	s.f = tmp
+	for i, loc := range locs {
+		loc.offset = offsets[i]
+	}
+	s.total = offset
+	s.compactions++
+	s.fileMu.Unlock()
+	s.mu.Unlock()
+	return old.Close()
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Entries:     len(s.index),
+		LiveBytes:   s.live,
+		FileBytes:   s.total,
+		Compactions: s.compactions,
+	}
+}
+
+// 写入队列中剩余的记录后关闭文件
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	err := s.flush()
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package spill
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+	"zkCache/lru"
+)
+
+func TestPutGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.spill")
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(lru.Entry{Key: "k1", Value: "v1", Version: 1, Tags: []string{"t"}})
+	s.Put(lru.Entry{Key: "k2", Value: "v2", Version: 2})
+	s.Put(lru.Entry{Key: "k1", Value: "v1-new", Version: 3, Tags: []string{"t"}})
+	s.Put(lru.Entry{Key: "expired", Value: "v", Expire: time.Now().Add(-time.Second).UnixNano()})
+	if e, ok := s.Get("k1"); !ok || e.Value != "v1-new" || e.Version != 3 {
+		t.Fatal("check k1", e)
+	}
+	if _, ok := s.Get("expired"); ok {
+		t.Fatal("expired key should not be returned")
+	}
+	s.Remove("k2")
+	s.Close()
+
+	// 重新打开后由日志重建索引, 删除标记生效
+	s, _ = Open(path, 0)
+	defer s.Close()
+	if e, ok := s.Get("k1"); !ok || e.Value != "v1-new" {
+		t.Fatal("check k1 after reopen", e)
+	}
+	if _, ok := s.Get("k2"); ok {
+		t.Fatal("k2 should be removed")
+	}
+	if n := s.RemoveTag("t"); n != 1 || s.Contains("k1") {
+		t.Fatal("check RemoveTag", n)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	s, _ := Open(filepath.Join(t.TempDir(), "cache.spill"), 300)
+	defer s.Close()
+	for i := 0; i < 10; i++ {
+		s.Put(lru.Entry{Key: fmt.Sprintf("k%d", i), Value: "value"})
+	}
+	stats := s.Stats()
+	if stats.LiveBytes > 300 || stats.Entries == 10 {
+		t.Fatal("check size limit", stats)
+	}
+	// 按写入顺序淘汰最早的数据
+	if s.Contains("k0") || !s.Contains("k9") {
+		t.Fatal("oldest should be dropped first")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.spill")
+	s, _ := Open(path, 0)
+	for i := 0; i < 100; i++ {
+		s.Put(lru.Entry{Key: fmt.Sprintf("k%d", i%10), Value: fmt.Sprintf("v%d", i)})
+	}
+	s.Flush()
+	before := s.Stats()
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after := s.Stats()
+	if after.FileBytes != after.LiveBytes || after.FileBytes >= before.FileBytes || after.Compactions != 1 {
+		t.Fatal("check compact", before, after)
+	}
+	for i := 0; i < 10; i++ {
+		if e, ok := s.Get(fmt.Sprintf("k%d", i)); !ok || e.Value != fmt.Sprintf("v%d", 90+i) {
+			t.Fatal("check value after compact", e)
+		}
+	}
+	s.Close()
+
+	s, _ = Open(path, 0)
+	defer s.Close()
+	if stats := s.Stats(); stats.Entries != 10 {
+		t.Fatal("check reopen after compact", stats)
+	}
+}
+
+func TestMaxSizeReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.spill")
+	s, _ := Open(path, 300)
+	s.Put(lru.Entry{Key: "old", Value: "value"})
+	for i := 0; i < 10; i++ {
+		s.Put(lru.Entry{Key: fmt.Sprintf("k%d", i), Value: "value"})
+	}
+	if s.Contains("old") {
+		t.Fatal("old should be dropped for size")
+	}
+	s.Remove("old")
+	s.Close()
+
+	// 因大小限制删除的数据重新打开后不会恢复
+	s, _ = Open(path, 300)
+	if s.Contains("old") || s.Stats().LiveBytes > 300 {
+		t.Fatal("dropped key should stay dropped", s.Stats())
+	}
+	s.Close()
+
+	// 重新打开时maxSize变小
+	s, _ = Open(path, 100)
+	defer s.Close()
+	if stats := s.Stats(); stats.LiveBytes > 100 || !s.Contains("k9") {
+		t.Fatal("load should enforce maxSize", stats)
+	}
+}
@@ -0,0 +1,57 @@
+package zkcache
+
+import (
+	"fmt"
+	"testing"
+	"zkCache/lru"
+)
+
+func TestSpill(t *testing.T) {
+	loads := 0
+	get := func(key string) (string, error) {
+		loads++
+		return "db-" + key, nil
+	}
+	// 内存只能容纳少量数据
+	c := NewController("spill", 4*(lru.EntryOverhead+12), get, nil)
+	if err := c.EnableSpill(SpillConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseSpill()
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	if stats, ok := c.SpillStats(); !ok || stats.Entries == 0 {
+		t.Fatal("evicted entries should be spilled", stats)
+	}
+	// 只在磁盘中的key也能扫描到
+	if resp := c.ScanLocal(ScanReq{Prefix: "key", Limit: 3}); len(resp.Keys) != 3 || resp.Keys[0] != "key0" || resp.Cursor != "key2" {
+		t.Fatal("scan should include spilled keys", resp)
+	}
+	// 从磁盘读回, 不访问DB, 也不产生变更事件
+	before, _, _ := c.Changes(0, 0, 0)
+	last := before[len(before)-1]
+	if v, err := c.Get("key0", 0); err != nil || string(v) != "value0" || loads != 0 {
+		t.Fatal("check spilled key", string(v), err, loads)
+	}
+	if _, ok := c.GetLocal("key0"); !ok {
+		t.Fatal("key0 should be promoted to memory")
+	}
+	if c.cache.disk.Contains("key0") {
+		t.Fatal("promoted key should be removed from disk")
+	}
+	// 只有读回时挤出的数据产生evict事件
+	events, _, _ := c.Changes(last.Epoch, last.Seq, 0)
+	for _, e := range events {
+		if e.Op != lru.OpEvict {
+			t.Fatal("promotion should not emit a set event", e)
+		}
+	}
+
+	// 删除后磁盘中的数据也失效
+	c.Get("key1", 0)
+	c.cache.remove("key1")
+	if v, _ := c.Get("key1", 0); string(v) != "db-key1" || loads != 1 {
+		t.Fatal("deleted key should be loaded from db", string(v), loads)
+	}
+}
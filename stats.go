@@ -0,0 +1,112 @@
+package zkcache
+
+import (
+	"sync/atomic"
+	"zkCache/lru"
+	"zkCache/spill"
+	"zkCache/writeback"
+)
+
+// Controller的运行统计
+type Stats struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	// 内存占用 单位字节
+	Bytes int64 `json:"bytes"`
+	Hits  int64 `json:"hits"`
+	// 命中热点副本的次数
+	HotHits   int64 `json:"hotHits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	// 按原因统计的拒绝写入次数
+	Rejections map[lru.EvictReason]int64 `json:"rejections"`
+	// 未开启磁盘层时为nil
+	Spill *spill.Stats `json:"spill,omitempty"`
+	// 未开启写入同步时为nil
+	Writeback *writeback.Stats `json:"writeback,omitempty"`
+}
+
+type counters struct {
+	hits      int64
+	hotHits   int64
+	misses    int64
+	evictions int64
+	tooLarge  int64
+	rejected  int64
+}
+
+func (c *Controller) Stats() Stats {
+	c.cache.mu.Lock()
+	entries := c.cache.lru.Len()
+	c.cache.mu.Unlock()
+	s := Stats{
+		Name:      c.name,
+		Entries:   entries,
+		Bytes:     c.MemoryUsage(),
+		Hits:      atomic.LoadInt64(&c.stats.hits),
+		HotHits:   atomic.LoadInt64(&c.stats.hotHits),
+		Misses:    atomic.LoadInt64(&c.stats.misses),
+		Evictions: atomic.LoadInt64(&c.stats.evictions),
+		Rejections: map[lru.EvictReason]int64{
+			lru.ReasonTooLarge: atomic.LoadInt64(&c.stats.tooLarge),
+			lru.ReasonRejected: atomic.LoadInt64(&c.stats.rejected),
+		},
+	}
+	if spillStats, ok := c.SpillStats(); ok {
+		s.Spill = &spillStats
+	}
+	if writeStats, ok := c.WritebackStats(); ok {
+		s.Writeback = &writeStats
+	}
+	return s
+}
+
+// 修改缓存容量, 缩小时立即淘汰; 0表示不限制  单位字节
+func (c *Controller) SetMaxSize(n int) {
+	c.cache.mu.Lock()
+	defer c.cache.unlock()
+	c.cache.lru.SetMaxSize(n)
+}
+
+// 设置单条缓存项允许的最大空间, 0表示只受maxSize限制  单位字节
+func (c *Controller) SetMaxEntrySize(n int) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.lru.MaxEntrySize = n
+}
+
+// 设置准入策略, 只作用于从DB新加载的数据; nil表示全部接受
+// 例如 lru.NewTinyLFU(预计的缓存条数)
+func (c *Controller) SetAdmission(a lru.Admission) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.lru.Admission = a
+}
+
+// 统计淘汰, 再调用使用者设置的回调; 在持有缓存锁的情况下调用
+func (c *Controller) evicted(key string, value string) {
+	atomic.AddInt64(&c.stats.evictions, 1)
+	if c.onEvicted != nil {
+		c.onEvicted(key, value)
+	}
+}
+
+// 统计拒绝写入, 再调用SetOnRejected设置的回调; 在持有缓存锁的情况下调用
+func (c *Controller) rejected(key string, value string, reason lru.EvictReason) {
+	switch reason {
+	case lru.ReasonTooLarge:
+		atomic.AddInt64(&c.stats.tooLarge, 1)
+	case lru.ReasonRejected:
+		atomic.AddInt64(&c.stats.rejected, 1)
+	}
+	if c.onRejected != nil {
+		c.onRejected(key, value, reason)
+	}
+}
+
+// 设置拒绝写入(超过单条大小上限或被准入策略拒绝)时的回调
+func (c *Controller) SetOnRejected(f lru.OnRejectedFunc) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.onRejected = f
+}
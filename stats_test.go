@@ -0,0 +1,70 @@
+package zkcache
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"zkCache/lru"
+	"zkCache/pkg/response"
+)
+
+func TestStats(t *testing.T) {
+	rejected := make([]lru.EvictReason, 0)
+	c := NewController("stats", 2*(len("key0"+"value")+lru.EntryOverhead), func(key string) (string, error) {
+		return "value", nil
+	}, func(key string, value string) {
+		t.Fatal("nothing should be evicted", key)
+	})
+	c.SetOnRejected(func(key string, value string, reason lru.EvictReason) {
+		rejected = append(rejected, reason)
+	})
+	c.SetMaxEntrySize(len("key0"+"value") + lru.EntryOverhead)
+	c.SetAdmission(lru.NewTinyLFU(10))
+
+	err := c.Set("key0", strings.Repeat("v", 100))
+	if code, ok := response.ErrCode(err); !ok || code != response.ENTRY_TOO_LARGE {
+		t.Fatal("check too large", err)
+	}
+	c.Set("key1", "value")
+	c.Set("key2", "value")
+	for i := 0; i < 3; i++ {
+		c.Get("key1", 0)
+		c.Get("key2", 0)
+	}
+	// 新加载的数据访问次数少, 仍然返回但不缓存
+	if v, err := c.Get("key3", 0); err != nil || string(v) != "value" {
+		t.Fatal("check load", string(v), err)
+	}
+	if _, ok := c.GetLocal("key3"); ok {
+		t.Fatal("key3 should be rejected by admission")
+	}
+
+	s := c.Stats()
+	if s.Entries != 2 || s.Hits != 6 || s.Misses != 1 || s.Evictions != 0 ||
+		s.Rejections[lru.ReasonTooLarge] != 1 || s.Rejections[lru.ReasonRejected] != 1 {
+		t.Fatal("check stats", s)
+	}
+	if len(rejected) != 2 || rejected[0] != lru.ReasonTooLarge || rejected[1] != lru.ReasonRejected {
+		t.Fatal("check OnRejected", rejected)
+	}
+}
+
+func TestDefaultTTLAndMaxSize(t *testing.T) {
+	c := NewController("defaultTTL", 0, func(key string) (string, error) {
+		return "value", nil
+	}, nil)
+	c.SetDefaultTTL(time.Minute)
+	c.Get("loaded", 0)
+	if e, ok := c.GetLocal("loaded"); !ok || e.Expire == 0 {
+		t.Fatal("loaded value should use default ttl", e)
+	}
+	c.Set("set", "value")
+	if e, ok := c.GetLocal("set"); !ok || e.Expire == 0 {
+		t.Fatal("set without ttl should use default ttl", e)
+	}
+
+	c.SetMaxSize(len("set"+"value") + lru.EntryOverhead)
+	if s := c.Stats(); s.Entries != 1 || s.Evictions != 1 {
+		t.Fatal("shrink should evict", s)
+	}
+}
@@ -0,0 +1,56 @@
+package zkcache
+
+import (
+	"zkCache/writeback"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 根据加载到的数据生成标签, 例如 product:1:price => product:1
+type TagFunc func(key string, value string) []string
+
+type InvalidateTagReq struct {
+	Tag string `json:"tag"`
+}
+
+// 设置从DB加载数据时使用的标签生成函数
+func (c *Controller) SetTagFunc(f TagFunc) {
+	c.tagFunc = f
+}
+
+// 在所有节点上删除带有标签tag的缓存项, 返回删除的总数
+// 不可达的节点会被跳过, 返回遇到的最后一个错误
+func (c *Controller) InvalidateTag(tag string) (int, error) {
+	total := c.InvalidateTagLocal(tag)
+	var lastErr error
+	for _, node := range c.nodePool.peers() {
+		n := 0
+		if err := c.nodePool.post(node, "invalidateTag", c.name, InvalidateTagReq{Tag: tag}, &n); err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"node": node,
+				"tag":  tag,
+				"err":  err.Error(),
+			}).Warn("invalidate tag failed")
+			lastErr = err
+			continue
+		}
+		total += n
+	}
+	return total, lastErr
+}
+
+// 只删除缓存, 不删除数据源中的数据; write-behind时先写入队列中的操作, 避免之后从数据源加载到旧值
+func (c *Controller) InvalidateTagLocal(tag string) int {
+	if w := c.getWriter(); w != nil && w.Mode() == writeback.Behind {
+		if remain := w.Flush(); remain > 0 {
+			zklog.Logger.WithFields(logrus.Fields{
+				"tag":    tag,
+				"remain": remain,
+			}).Warn("invalidate tag with unflushed writes")
+		}
+	}
+	n := c.cache.removeTag(tag)
+	c.publishSystemEvent(SystemEvent{Event: "invalidateTag", Tag: tag, Count: n})
+	return n
+}
@@ -0,0 +1,54 @@
+package zkcache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	controllers, _ := newCluster(t, "tag", 3, 2)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("product:1:field%d", i)
+		if err := controllers[i%3].Set(key, "v", "product:1"); err != nil {
+			t.Fatal(err)
+		}
+		controllers[i%3].Set(fmt.Sprintf("product:2:field%d", i), "v", "product:2")
+	}
+	// 等待副本同步完成
+	waitFor(t, func() bool {
+		n := 0
+		for _, c := range controllers {
+			c.cache.mu.Lock()
+			n += len(c.cache.lru.KeysByTag("product:1"))
+			c.cache.mu.Unlock()
+		}
+		return n == 20
+	})
+
+	n, err := controllers[0].InvalidateTag("product:1")
+	if err != nil || n != 20 {
+		t.Fatal("check InvalidateTag", n, err)
+	}
+	for _, c := range controllers {
+		for _, key := range c.cache.keys() {
+			if strings.HasPrefix(key, "product:1:") {
+				t.Fatal("key should be invalidated", key)
+			}
+		}
+	}
+}
+
+func TestLoaderTags(t *testing.T) {
+	c := NewController("tag-loader", 0, func(key string) (string, error) {
+		return "value", nil
+	}, nil)
+	c.SetTagFunc(func(key string, value string) []string {
+		return []string{strings.Join(strings.Split(key, ":")[:2], ":")}
+	})
+	c.Get("product:3:price", 0)
+	c.Get("product:3:detail", 0)
+	if n, _ := c.InvalidateTag("product:3"); n != 2 {
+		t.Fatal("loaded keys should carry tags", n)
+	}
+}
@@ -0,0 +1,57 @@
+package zkcache
+
+import (
+	"encoding/json"
+	"zkCache/pubsub"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 每个主题默认保留用于重放的消息数
+var TopicReplay = 100
+
+type PublishReq struct {
+	Topic string `json:"topic"`
+	Data  string `json:"data"`
+}
+
+// 发布到系统主题的事件
+type SystemEvent struct {
+	Event string `json:"event"`
+	Tag   string `json:"tag,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// 本节点的主题, 用于订阅
+func (c *Controller) Topics() *pubsub.Broker {
+	return c.topics
+}
+
+// 发布消息: 投递给本节点的订阅者并转发给其他所有节点, 至多一次投递
+func (c *Controller) Publish(topic string, data string) (pubsub.Message, error) {
+	msg := c.PublishLocal(topic, data)
+	var lastErr error
+	for _, node := range c.nodePool.peers() {
+		if err := c.nodePool.post(node, "publish", c.name, PublishReq{Topic: topic, Data: data}, nil); err != nil {
+			zklog.Logger.WithFields(logrus.Fields{
+				"node":  node,
+				"topic": topic,
+				"err":   err.Error(),
+			}).Warn("publish failed")
+			lastErr = err
+		}
+	}
+	return msg, lastErr
+}
+
+func (c *Controller) PublishLocal(topic string, data string) pubsub.Message {
+	return c.topics.Publish(topic, data)
+}
+
+// 在本节点的系统主题上发布事件
+func (c *Controller) publishSystemEvent(e SystemEvent) {
+	data, _ := json.Marshal(e)
+	c.topics.Publish(pubsub.SystemTopic, string(data))
+}
@@ -0,0 +1,44 @@
+package zkcache
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"zkCache/pubsub"
+)
+
+func TestPublishToCluster(t *testing.T) {
+	controllers, _ := newCluster(t, "topic", 3, 1)
+	subs := make([]*pubsub.Subscriber, len(controllers))
+	for i, c := range controllers {
+		subs[i] = c.Topics().Subscribe("orders", 0)
+		defer subs[i].Close()
+	}
+	if _, err := controllers[0].Publish("orders", "created"); err != nil {
+		t.Fatal(err)
+	}
+	for i, sub := range subs {
+		select {
+		case msg := <-sub.C:
+			if msg.Data != "created" {
+				t.Fatal("check message", i, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received by node", i)
+		}
+	}
+}
+
+func TestInvalidateEvent(t *testing.T) {
+	c := NewController("topic-system", 0, nil, nil)
+	sub := c.Topics().Subscribe(pubsub.SystemTopic, 0)
+	defer sub.Close()
+	c.Set("product:1:price", "10", "product:1")
+	c.InvalidateTag("product:1")
+	msg := <-sub.C
+	e := SystemEvent{}
+	json.Unmarshal([]byte(msg.Data), &e)
+	if e.Event != "invalidateTag" || e.Tag != "product:1" || e.Count != 1 {
+		t.Fatal("check system event", msg.Data)
+	}
+}
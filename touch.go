@@ -0,0 +1,40 @@
+package zkcache
+
+import (
+	"fmt"
+	"time"
+)
+
+type TouchReq struct {
+	Key string `json:"key"`
+	// 毫秒, 小于等于0表示取消过期时间
+	TTL int64 `json:"ttl"`
+}
+
+// 在归属节点上修改key的过期时间并同步给副本, 返回key是否存在
+func (c *Controller) Touch(key string, ttl time.Duration) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("key not exist")
+	}
+	req := TouchReq{Key: key, TTL: ttl.Milliseconds()}
+	var exist bool
+	err := c.onOwner(key, func() error {
+		exist = c.TouchLocal(req)
+		return nil
+	}, func(node string) error {
+		return c.nodePool.post(node, "touch", c.name, req, &exist)
+	})
+	return exist, err
+}
+
+func (c *Controller) TouchLocal(req TouchReq) bool {
+	var expire int64
+	if req.TTL > 0 {
+		expire = time.Now().Add(time.Duration(req.TTL) * time.Millisecond).UnixNano()
+	}
+	e, ok := c.cache.setExpire(req.Key, expire)
+	if ok {
+		c.replicate(e)
+	}
+	return ok
+}
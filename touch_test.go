@@ -0,0 +1,26 @@
+package zkcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTouch(t *testing.T) {
+	controllers, _ := newCluster(t, "touch", 3, 2)
+	other := outsider(controllers, "k")
+	other.Set("k", "v")
+	if exist, err := other.Touch("k", time.Minute); err != nil || !exist {
+		t.Fatal("check touch", exist, err)
+	}
+	// 新的过期时间同步给副本
+	for _, node := range controllers[0].nodePool.PickNodes("k", 2) {
+		c := byUrl(controllers, node)
+		waitFor(t, func() bool {
+			e, ok := c.GetLocal("k")
+			return ok && e.Expire != 0
+		})
+	}
+	if exist, _ := other.Touch("missing", time.Minute); exist {
+		t.Fatal("missing key should not be touched")
+	}
+}
@@ -0,0 +1,108 @@
+package zkcache
+
+import (
+	"fmt"
+	"time"
+	"zkCache/lru"
+	"zkCache/pkg/response"
+	"zkCache/writeback"
+)
+
+type CompareAndSetReq struct {
+	Key      string `json:"key"`
+	Expected uint64 `json:"expected"`
+	Value    string `json:"value"`
+	// 毫秒, 含义同SetWithTTL, 0表示保留原有的过期时间
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// 读取key及其在归属节点上的版本号, 用于之后的CompareAndSet
+func (c *Controller) GetWithVersion(key string) ([]byte, uint64, error) {
+	if key == "" {
+		return nil, 0, fmt.Errorf("key not exist")
+	}
+	var e lru.Entry
+	err := c.onOwner(key, func() (err error) {
+		e, err = c.GetWithVersionLocal(key)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "version", c.name, PeekReq{Key: key}, &e)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return []byte(e.Value), e.Version, nil
+}
+
+// 在本节点读取key及其版本号, 不存在时先加载
+func (c *Controller) GetWithVersionLocal(key string) (lru.Entry, error) {
+	if e, ok := c.cache.getWithVersion(key); ok {
+		return e, nil
+	}
+	if _, err := c.Get(key, 0); err != nil {
+		return lru.Entry{}, err
+	}
+	if e, ok := c.cache.getWithVersion(key); ok {
+		return e, nil
+	}
+	return lru.Entry{}, fmt.Errorf("can not find the value by key: %s", key)
+}
+
+// 仅当key在归属节点上的版本等于expectedVersion时写入, 返回新的版本号
+// expectedVersion为0表示key不存在时才写入; 版本不一致时返回 response.VERSION_MISMATCH
+func (c *Controller) CompareAndSet(key string, expectedVersion uint64, value string) (uint64, error) {
+	return c.CompareAndSetWithTTL(key, expectedVersion, value, 0)
+}
+
+// 同CompareAndSet, 写入的同时设置过期时间: ttl>0 时设置, 小于0(NoExpire)时取消, 为0时保留原有的过期时间
+func (c *Controller) CompareAndSetWithTTL(key string, expectedVersion uint64, value string, ttl time.Duration) (uint64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key not exist")
+	}
+	var version uint64
+	err := c.onOwner(key, func() (err error) {
+		version, err = c.CompareAndSetLocalWithTTL(key, expectedVersion, value, ttl)
+		return err
+	}, func(node string) error {
+		return c.nodePool.post(node, "cas", c.name, CompareAndSetReq{
+			Key:      key,
+			Expected: expectedVersion,
+			Value:    value,
+			TTL:      ttl.Milliseconds(),
+		}, &version)
+	})
+	return version, err
+}
+
+func (c *Controller) CompareAndSetLocal(key string, expectedVersion uint64, value string) (uint64, error) {
+	return c.CompareAndSetLocalWithTTL(key, expectedVersion, value, 0)
+}
+
+// 开启写入同步时同Set写入数据源; write-through时先检查版本, 一致才写入数据源
+func (c *Controller) CompareAndSetLocalWithTTL(key string, expectedVersion uint64, value string, ttl time.Duration) (uint64, error) {
+	defer c.lockWrite(key)()
+	if w := c.getWriter(); w != nil && w.Mode() == writeback.Through {
+		// 持有key的写锁, 检查之后版本不会被其他写入改变
+		if cur, _ := c.cache.getWithVersion(key); cur.Version != expectedVersion {
+			return cur.Version, versionMismatch(key, expectedVersion, cur.Version)
+		}
+		if err := c.writeThrough(key, value, false); err != nil {
+			return 0, err
+		}
+	}
+	e, ok, err := c.cache.compareAndSet(key, expectedVersion, value, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return e.Version, versionMismatch(key, expectedVersion, e.Version)
+	}
+	c.writeBehind(key, e.Value, false)
+	c.replicate(e)
+	return e.Version, nil
+}
+
+func versionMismatch(key string, expected uint64, current uint64) error {
+	return response.NewErrWithMsg(response.VERSION_MISMATCH,
+		fmt.Sprintf("key: %s, expected version: %d, current version: %d", key, expected, current))
+}
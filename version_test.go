@@ -0,0 +1,38 @@
+package zkcache
+
+import (
+	"testing"
+	"zkCache/pkg/response"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	controllers, _ := newCluster(t, "cas", 3, 1)
+	key := "session"
+	owner := byUrl(controllers, controllers[0].nodePool.PickNodes(key, 1)[0])
+	client := outsider(controllers, key)
+
+	version, err := client.CompareAndSet(key, 0, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := owner.GetLocal(key); !ok || e.Value != "1" || e.Version != version {
+		t.Fatal("value should be written on owner", e)
+	}
+
+	view, current, err := client.GetWithVersion(key)
+	if err != nil || string(view) != "1" || current != version {
+		t.Fatal("check GetWithVersion", string(view), current, err)
+	}
+	latest, err := client.CompareAndSet(key, current, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 远程节点版本不一致时返回其当前版本号
+	mismatch, err := client.CompareAndSet(key, current, "3")
+	if code, _ := response.ErrCode(err); code != response.VERSION_MISMATCH || mismatch != latest {
+		t.Fatal("stale version should be rejected", mismatch, latest, err)
+	}
+	if e, _ := owner.GetLocal(key); e.Value != "2" {
+		t.Fatal("check value", e.Value)
+	}
+}
@@ -0,0 +1,131 @@
+package zkcache
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"zkCache/consistenthash"
+	"zkCache/lru"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 新节点加入时每批从旧归属节点拉取的条数
+var WarmUpBatchSize = 100
+
+// 迁移的key快照在最后一次拉取之后保留的时间
+const transferSessionTTL = time.Minute
+
+// 一次迁移中归属于新节点的key, 按字典序排列
+type transferSession struct {
+	keys []string
+	at   time.Time
+}
+
+type TransferReq struct {
+	// 接收数据的新节点
+	Target string `json:"target"`
+	// 新节点加入后的全部节点
+	Nodes  []string `json:"nodes"`
+	Cursor string   `json:"cursor"`
+	Limit  int      `json:"limit"`
+}
+
+type TransferResp struct {
+	Entries []lru.Entry `json:"entries"`
+	// 为空表示已经没有更多数据
+	Cursor string `json:"cursor"`
+}
+
+// 节点加入hash环后, 从之前的归属节点拉取现在属于本节点的数据
+// 在后台分批执行, 不影响正常请求
+func (c *Controller) warmUp(self string, nodes []string) {
+	start := time.Now()
+	total := 0
+	for _, peer := range nodes {
+		if peer == self {
+			continue
+		}
+		cursor := ""
+		for {
+			resp := TransferResp{}
+			err := c.nodePool.post(peer, "transfer", c.name, TransferReq{
+				Target: self,
+				Nodes:  nodes,
+				Cursor: cursor,
+				Limit:  WarmUpBatchSize,
+			}, &resp)
+			if err != nil {
+				zklog.Logger.WithFields(logrus.Fields{
+					"peer": peer,
+					"err":  err,
+				}).Warn("warm up from peer failed")
+				break
+			}
+			total += c.Handoff(resp.Entries)
+			if resp.Cursor == "" {
+				break
+			}
+			cursor = resp.Cursor
+		}
+	}
+	zklog.Logger.WithFields(logrus.Fields{
+		"controller": c.name,
+		"accepted":   total,
+		"elapsed":    time.Since(start).String(),
+	}).Info("warm up finished")
+}
+
+// 返回本地缓存中在新节点列表下归属于target的数据
+// 第一批(cursor为空)时记录归属于target的key快照, 之后的批次从快照中按cursor读取; 快照之后写入的数据不会迁移
+func (c *Controller) Transfer(req TransferReq) TransferResp {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = WarmUpBatchSize
+	}
+	id := req.Target + "|" + strings.Join(req.Nodes, ",")
+	keys := c.transferKeys(id, req)
+	start := sort.Search(len(keys), func(i int) bool { return keys[i] > req.Cursor })
+	end, next := start+limit, ""
+	if end < len(keys) {
+		next = keys[end-1]
+	} else {
+		end = len(keys)
+		c.transferMu.Lock()
+		delete(c.transfers, id)
+		c.transferMu.Unlock()
+	}
+	return TransferResp{Entries: c.cache.entries(keys[start:end]), Cursor: next}
+}
+
+// 读取迁移的key快照, 没有时新建; 计算归属时不持有缓存锁
+func (c *Controller) transferKeys(id string, req TransferReq) []string {
+	now := time.Now()
+	c.transferMu.Lock()
+	for k, s := range c.transfers {
+		if now.Sub(s.at) > transferSessionTTL {
+			delete(c.transfers, k)
+		}
+	}
+	if s, ok := c.transfers[id]; ok && req.Cursor != "" {
+		s.at = now
+		c.transferMu.Unlock()
+		return s.keys
+	}
+	c.transferMu.Unlock()
+
+	ring := consistenthash.New(defaultVirtualNodeCount, nil)
+	ring.Set(req.Nodes...)
+	keys := make([]string, 0)
+	for _, key := range c.cache.keys() {
+		if key > req.Cursor && ring.Get(key) == req.Target {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	c.transferMu.Lock()
+	c.transfers[id] = &transferSession{keys: keys, at: now}
+	c.transferMu.Unlock()
+	return keys
+}
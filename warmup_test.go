@@ -0,0 +1,36 @@
+package zkcache
+
+import (
+	"testing"
+	"zkCache/consistenthash"
+)
+
+func TestWarmUp(t *testing.T) {
+	old := NewController("warmup-old", 0, nil, nil)
+	for i := 0; i < 50; i++ {
+		key := string(rune('a'+i%26)) + string(rune('A'+i/26))
+		old.cache.set(key, key)
+	}
+	peer := newPeerServer(old)
+	defer peer.Close()
+
+	self := "http://localhost:1"
+	nodes := []string{self, peer.URL}
+	defer func(size int) { WarmUpBatchSize = size }(WarmUpBatchSize)
+	WarmUpBatchSize = 3
+	joined := NewController("warmup-new", 0, nil, nil)
+	joined.SetSelfUrl(self)
+	joined.warmUp(self, nodes)
+	if len(old.transfers) != 0 {
+		t.Fatal("finished transfer should be released", len(old.transfers))
+	}
+
+	ring := consistenthash.New(defaultVirtualNodeCount, nil)
+	ring.Set(nodes...)
+	for _, key := range old.cache.keys() {
+		_, ok := joined.cache.get(key)
+		if owned := ring.Get(key) == self; owned != ok {
+			t.Fatalf("key: %s, owned: %v, warmed: %v", key, owned, ok)
+		}
+	}
+}
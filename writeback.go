@@ -0,0 +1,123 @@
+package zkcache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"zkCache/pkg/response"
+	"zkCache/writeback"
+	"zkCache/zklog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 开启写入同步: Set/Delete 在归属节点上执行时同时写入数据源
+// write-behind模式下, 已开启持久化时未写入数据源的操作保存在持久化目录中, 应在EnablePersistence之后调用
+func (c *Controller) EnableWriteback(cfg writeback.Config) error {
+	c.cache.mu.Lock()
+	if cfg.Path == "" && c.persist != nil {
+		cfg.Path = filepath.Join(c.persist.cfg.Dir, c.name+".writes")
+	}
+	exist := c.writer != nil
+	c.cache.mu.Unlock()
+	if exist {
+		return fmt.Errorf("controller %s writeback already enabled", c.name)
+	}
+	w, err := writeback.Open(cfg)
+	if err != nil {
+		return err
+	}
+	c.cache.mu.Lock()
+	c.writer = w
+	c.cache.mu.Unlock()
+	zklog.Logger.WithFields(logrus.Fields{
+		"controller": c.name,
+		"mode":       cfg.Mode,
+		"queued":     w.Stats().Queued,
+	}).Info("writeback enabled")
+	return nil
+}
+
+// 写入统计, 未开启时返回false
+func (c *Controller) WritebackStats() (writeback.Stats, bool) {
+	w := c.getWriter()
+	if w == nil {
+		return writeback.Stats{}, false
+	}
+	return w.Stats(), true
+}
+
+// 关闭写入同步, 尝试写入队列中剩余的操作, 仍未写入的保存到磁盘
+func (c *Controller) CloseWriteback() error {
+	c.cache.mu.Lock()
+	w := c.writer
+	c.writer = nil
+	c.cache.mu.Unlock()
+	if w == nil {
+		return nil
+	}
+	err := w.Close()
+	if s := w.Stats(); s.Queued > 0 {
+		zklog.Logger.WithFields(logrus.Fields{
+			"controller": c.name,
+			"queued":     s.Queued,
+		}).Warn("writeback closed with unflushed writes")
+	}
+	return err
+}
+
+func (c *Controller) getWriter() *writeback.Writer {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	return c.writer
+}
+
+// 开启写入同步时锁住key所在的分段, 保证同一key在缓存和数据源中的写入顺序一致; 返回解锁函数
+func (c *Controller) lockWrite(key string) func() {
+	if c.getWriter() == nil {
+		return func() {}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	m := &c.writeMu[h.Sum32()%uint32(len(c.writeMu))]
+	m.Lock()
+	return m.Unlock
+}
+
+// 写缓存之前调用: write-through时同步写入数据源, 失败时不写缓存
+func (c *Controller) writeThrough(key string, value string, del bool) error {
+	w := c.getWriter()
+	if w == nil || w.Mode() != writeback.Through {
+		return nil
+	}
+	if del {
+		return w.Delete(key)
+	}
+	return w.Set(key, value)
+}
+
+// 写缓存之后调用: write-behind时加入写入队列
+func (c *Controller) writeBehind(key string, value string, del bool) {
+	w := c.getWriter()
+	if w == nil || w.Mode() != writeback.Behind {
+		return
+	}
+	if del {
+		w.Delete(key)
+	} else {
+		w.Set(key, value)
+	}
+}
+
+// 从数据源加载: write-behind队列中有尚未写入的操作时以队列为准, 删除视为不存在
+func (c *Controller) loadSource(key string) (string, error) {
+	if w := c.getWriter(); w != nil {
+		if op, ok := w.Pending(key); ok {
+			if op.Delete {
+				return "", response.NewErrWithMsg(response.NOT_FOUND, fmt.Sprintf("key: %s is pending delete", key))
+			}
+			return op.Value, nil
+		}
+	}
+	return c.get(key)
+}
@@ -0,0 +1,502 @@
+// 缓存写入同步到数据源: 同步写(write-through) 或 异步批量写(write-behind)
+package writeback
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Mode string
+
+const (
+	// 先写数据源, 成功后再写缓存
+	Through Mode = "write-through"
+	// 先写缓存, 再由后台批量写入数据源
+	Behind Mode = "write-behind"
+)
+
+type Setter func(key string, value string) error
+type Deleter func(key string) error
+
+// 一条待写入数据源的操作
+type Op struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+	// 首次入队时间 单位纳秒, 合并后保持不变
+	Time int64 `json:"time"`
+	// 已失败次数
+	Attempts int `json:"attempts,omitempty"`
+}
+
+type Config struct {
+	Mode Mode
+	Set  Setter
+	// nil表示删除不同步到数据源
+	Delete Deleter
+
+	// 以下只用于write-behind
+	// 批量写入, 非nil时代替逐条调用Set/Delete; 返回错误时整批重试
+	Batch func(ops []Op) error
+	// 每批最多的操作数, 默认100; 队列达到该长度时立即写入
+	BatchSize int
+	// 定期写入的间隔, 默认1s
+	FlushInterval time.Duration
+	// 写入失败后重试间隔从FlushInterval开始倍增, 最大为MaxBackoff, 默认1分钟
+	MaxBackoff time.Duration
+	// 单条操作最多重试次数, 超过后丢弃并计入失败; 0表示一直重试不丢弃
+	MaxRetries int
+	// 未写入数据源的操作在入队时追加到该文件, 每次写入数据源后重写为剩余的操作, 打开时恢复; 为空表示不保存
+	// 追加时不调用fsync, 进程崩溃不丢失, 机器掉电可能丢失最近的操作
+	Path string
+}
+
+type Stats struct {
+	Mode Mode `json:"mode"`
+	// 待写入的key数
+	Queued int `json:"queued"`
+	// 最早一条待写入操作已等待的时间
+	Lag time.Duration `json:"lag"`
+	// 成功写入数据源的操作数
+	Written int64 `json:"written"`
+	// 写入前被同一key的新操作覆盖的次数
+	Coalesced int64 `json:"coalesced"`
+	Retries   int64 `json:"retries"`
+	// 写入失败后距下次重试的时间
+	RetryIn time.Duration `json:"retryIn,omitempty"`
+	// write-through为写入失败次数, write-behind为重试耗尽后丢弃的操作数
+	Failures  int64  `json:"failures"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+type Writer struct {
+	cfg Config
+
+	// 保证同一时间只有一次写入, 同一key的操作按顺序到达数据源
+	flushMu sync.Mutex
+	mu      sync.Mutex
+	// 按首次入队顺序排列的key, 与pending一一对应
+	queue   []string
+	pending map[string]*Op
+	// 已取出正在写入数据源的操作
+	inflight map[string]Op
+	// 上次保存后队列是否有变化
+	dirty bool
+	stats Stats
+	// 连续失败的写入次数及下次重试的时间
+	failures int
+	retryAt  time.Time
+
+	// 保护log, 在持有mu时获取以保证追加顺序与入队顺序一致
+	logMu sync.Mutex
+	// 以追加方式打开的cfg.Path
+	log *os.File
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// 创建Writer, write-behind模式下恢复cfg.Path中保存的操作并启动后台写入
+func Open(cfg Config) (*Writer, error) {
+	if cfg.Mode != Through && cfg.Mode != Behind {
+		return nil, errors.New("writeback: unknown mode " + string(cfg.Mode))
+	}
+	if cfg.Set == nil && (cfg.Mode == Through || cfg.Batch == nil) {
+		return nil, errors.New("writeback: Set is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	w := &Writer{
+		cfg:      cfg,
+		pending:  make(map[string]*Op),
+		inflight: make(map[string]Op),
+		stats:    Stats{Mode: cfg.Mode},
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if cfg.Mode == Through {
+		close(w.done)
+		return w, nil
+	}
+	if cfg.Path != "" {
+		ops, err := readOps(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range ops {
+			w.add(op)
+		}
+		// 重写为合并后的操作并打开追加
+		if err := w.save(); err != nil {
+			return nil, err
+		}
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *Writer) Mode() Mode {
+	return w.cfg.Mode
+}
+
+// 写入key: write-through时同步写入数据源并返回其错误, write-behind时加入队列
+func (w *Writer) Set(key string, value string) error {
+	return w.write(Op{Key: key, Value: value})
+}
+
+// 删除key, 未设置Deleter时不写入数据源; write-behind时仍会入队, 以覆盖同一key尚未写入的操作
+func (w *Writer) Delete(key string) error {
+	if w.cfg.Mode == Through && w.cfg.Delete == nil {
+		return nil
+	}
+	return w.write(Op{Key: key, Delete: true})
+}
+
+func (w *Writer) write(op Op) error {
+	if w.cfg.Mode == Through {
+		err := w.apply(op)
+		w.mu.Lock()
+		if err != nil {
+			w.stats.Failures++
+			w.stats.LastError = err.Error()
+		} else {
+			w.stats.Written++
+		}
+		w.mu.Unlock()
+		return err
+	}
+	op.Time = time.Now().UnixNano()
+	w.mu.Lock()
+	w.add(op)
+	full := len(w.queue) >= w.cfg.BatchSize
+	w.logMu.Lock()
+	w.mu.Unlock()
+	err := w.append(op)
+	w.logMu.Unlock()
+	if err != nil {
+		w.mu.Lock()
+		w.stats.LastError = err.Error()
+		w.mu.Unlock()
+	}
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// 加入队列, 同一key只保留最新的操作; 在持有锁的情况下调用
+func (w *Writer) add(op Op) {
+	w.dirty = true
+	if old, ok := w.pending[op.Key]; ok {
+		op.Time = old.Time
+		*old = op
+		w.stats.Coalesced++
+		return
+	}
+	w.pending[op.Key] = &op
+	w.queue = append(w.queue, op.Key)
+}
+
+// key尚未写入数据源的最新操作, 包括正在写入的; 读数据源之前用于避免读到旧值
+func (w *Writer) Pending(key string) (Op, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if op, ok := w.pending[key]; ok {
+		return *op, true
+	}
+	op, ok := w.inflight[key]
+	return op, ok
+}
+
+func (w *Writer) apply(op Op) error {
+	if op.Delete {
+		if w.cfg.Delete == nil {
+			return nil
+		}
+		return w.cfg.Delete(op.Key)
+	}
+	return w.cfg.Set(op.Key, op.Value)
+}
+
+// 追加一条操作到cfg.Path, 需持有logMu
+func (w *Writer) append(op Op) error {
+	if w.log == nil {
+		return nil
+	}
+	buf, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = w.log.Write(append(buf, '\n'))
+	return err
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.kick:
+		case <-w.stop:
+			return
+		}
+		w.mu.Lock()
+		wait := time.Now().Before(w.retryAt)
+		w.mu.Unlock()
+		if !wait {
+			w.Flush()
+		}
+		w.save()
+	}
+}
+
+// 记录一次写入结果, 失败时重试间隔倍增; 需持有锁
+func (w *Writer) backoff(failed bool) {
+	if !failed {
+		w.failures = 0
+		w.retryAt = time.Time{}
+		return
+	}
+	w.failures++
+	d := w.cfg.FlushInterval
+	for i := 1; i < w.failures && d < w.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.cfg.MaxBackoff {
+		d = w.cfg.MaxBackoff
+	}
+	w.retryAt = time.Now().Add(d)
+}
+
+// 写入队列中的全部操作, 某一批有失败时停止, 失败的操作等待下次重试; 返回剩余的操作数
+func (w *Writer) Flush() int {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	for {
+		batch := w.take()
+		if len(batch) == 0 {
+			return 0
+		}
+		failed, err := w.flushBatch(batch)
+		w.mu.Lock()
+		for _, op := range batch {
+			delete(w.inflight, op.Key)
+		}
+		w.stats.Written += int64(len(batch) - len(failed))
+		if err != nil {
+			w.stats.LastError = err.Error()
+		}
+		w.requeue(failed)
+		w.backoff(len(failed) > 0)
+		remain := len(w.queue)
+		w.mu.Unlock()
+		if len(failed) > 0 {
+			return remain
+		}
+	}
+}
+
+// 从队首取出一批
+func (w *Writer) take() []Op {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(w.queue)
+	if n > w.cfg.BatchSize {
+		n = w.cfg.BatchSize
+	}
+	batch := make([]Op, n)
+	for i, key := range w.queue[:n] {
+		batch[i] = *w.pending[key]
+		w.inflight[key] = batch[i]
+		delete(w.pending, key)
+	}
+	w.queue = w.queue[n:]
+	if n > 0 {
+		w.dirty = true
+	}
+	return batch
+}
+
+// 返回失败的操作及最后一个错误
+func (w *Writer) flushBatch(batch []Op) ([]Op, error) {
+	if w.cfg.Batch != nil {
+		if err := w.cfg.Batch(batch); err != nil {
+			return batch, err
+		}
+		return nil, nil
+	}
+	var failed []Op
+	var last error
+	for _, op := range batch {
+		if err := w.apply(op); err != nil {
+			failed = append(failed, op)
+			last = err
+		}
+	}
+	return failed, last
+}
+
+// 失败的操作放回队首; 期间同一key有新操作时以新操作为准, 设置了MaxRetries时超过重试次数丢弃; 在持有锁的情况下调用
+func (w *Writer) requeue(failed []Op) {
+	keys := make([]string, 0, len(failed))
+	for _, op := range failed {
+		if _, ok := w.pending[op.Key]; ok {
+			continue
+		}
+		op.Attempts++
+		if w.cfg.MaxRetries > 0 && op.Attempts > w.cfg.MaxRetries {
+			w.stats.Failures++
+			continue
+		}
+		w.stats.Retries++
+		op := op
+		w.pending[op.Key] = &op
+		keys = append(keys, op.Key)
+	}
+	w.queue = append(keys, w.queue...)
+}
+
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.stats
+	s.Queued = len(w.queue)
+	if len(w.queue) > 0 {
+		s.Lag = time.Since(time.Unix(0, w.pending[w.queue[0]].Time))
+	}
+	if d := time.Until(w.retryAt); d > 0 {
+		s.RetryIn = d
+	}
+	return s
+}
+
+// 将文件重写为未写入的操作并重新打开追加; 之后入队的操作追加到新文件
+func (w *Writer) save() error {
+	if w.cfg.Path == "" {
+		return nil
+	}
+	w.mu.Lock()
+	if !w.dirty && w.log != nil {
+		w.mu.Unlock()
+		return nil
+	}
+	ops := make([]Op, len(w.queue))
+	for i, key := range w.queue {
+		ops[i] = *w.pending[key]
+	}
+	w.dirty = false
+	w.logMu.Lock()
+	w.mu.Unlock()
+	defer w.logMu.Unlock()
+	if err := writeOps(w.cfg.Path, ops); err != nil {
+		w.mu.Lock()
+		w.dirty = true
+		w.mu.Unlock()
+		return err
+	}
+	f, err := os.OpenFile(w.cfg.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if w.log != nil {
+		w.log.Close()
+	}
+	w.log = f
+	return nil
+}
+
+// 停止后台写入, 尝试写入剩余的操作, 仍未写入的保存到cfg.Path, 全部写入时删除文件
+func (w *Writer) Close() error {
+	if w.cfg.Mode == Through {
+		return nil
+	}
+	close(w.stop)
+	<-w.done
+	remain := w.Flush()
+	err := w.save()
+	w.logMu.Lock()
+	defer w.logMu.Unlock()
+	if w.log != nil {
+		w.log.Close()
+		w.log = nil
+	}
+	if err == nil && remain == 0 && w.cfg.Path != "" {
+		if err := os.Remove(w.cfg.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// 每行一条操作(JSON), 先写临时文件再重命名
+func writeOps(path string, ops []Op) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	bw := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(bw)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// 文件不存在时返回空
+func readOps(path string) ([]Op, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ops := make([]Op, 0)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		op := Op{}
+		if err := dec.Decode(&op); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
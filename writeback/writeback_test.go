@@ -0,0 +1,272 @@
+package writeback
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 内存中的数据源, fail非空时写入失败
+type store struct {
+	mu      sync.Mutex
+	data    map[string]string
+	batches [][]Op
+	fail    error
+}
+
+func newStore() *store {
+	return &store{data: make(map[string]string)}
+}
+
+func (s *store) set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *store) delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	delete(s.data, key)
+	return nil
+}
+
+func (s *store) batch(ops []Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.batches = append(s.batches, ops)
+	for _, op := range ops {
+		if op.Delete {
+			delete(s.data, op.Key)
+		} else {
+			s.data[op.Key] = op.Value
+		}
+	}
+	return nil
+}
+
+func (s *store) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *store) setFail(err error) {
+	s.mu.Lock()
+	s.fail = err
+	s.mu.Unlock()
+}
+
+func TestThrough(t *testing.T) {
+	s := newStore()
+	w, err := Open(Config{Mode: Through, Set: s.set, Delete: s.delete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.get("k"); v != "v" {
+		t.Fatal("value should be written synchronously", v)
+	}
+	s.setFail(errors.New("store down"))
+	if err := w.Set("k", "v2"); err == nil {
+		t.Fatal("store error should be returned")
+	}
+	s.setFail(nil)
+	if err := w.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.get("k"); ok {
+		t.Fatal("value should be deleted")
+	}
+	if st := w.Stats(); st.Written != 2 || st.Failures != 1 || st.LastError != "store down" {
+		t.Fatal("check stats", st)
+	}
+
+	if _, err := Open(Config{Mode: Through, Batch: s.batch}); err == nil {
+		t.Fatal("write-through requires Set")
+	}
+	if _, err := Open(Config{Mode: "later", Set: s.set}); err == nil {
+		t.Fatal("unknown mode should be rejected")
+	}
+}
+
+func TestBehindBatchAndCoalesce(t *testing.T) {
+	s := newStore()
+	w, err := Open(Config{Mode: Behind, Batch: s.batch, BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Set("a", "1")
+	w.Set("a", "2")
+	w.Set("a", "3")
+	if _, ok := s.get("a"); ok {
+		t.Fatal("write-behind should not write synchronously")
+	}
+	if st := w.Stats(); st.Queued != 1 || st.Coalesced != 2 || st.Lag <= 0 {
+		t.Fatal("check coalesce", st)
+	}
+	w.Set("b", "1")
+	w.Delete("a")
+	w.Set("c", "1")
+	if remain := w.Flush(); remain != 0 {
+		t.Fatal("all ops should be written", remain)
+	}
+	if len(s.batches) != 2 || len(s.batches[0]) != 2 || !s.batches[0][0].Delete {
+		t.Fatal("check batches", s.batches)
+	}
+	if _, ok := s.get("a"); ok {
+		t.Fatal("a should be deleted")
+	}
+	if st := w.Stats(); st.Queued != 0 || st.Written != 3 || st.Lag != 0 {
+		t.Fatal("check stats", st)
+	}
+}
+
+func TestBehindKick(t *testing.T) {
+	s := newStore()
+	w, _ := Open(Config{Mode: Behind, Set: s.set, BatchSize: 2, FlushInterval: time.Hour})
+	defer w.Close()
+	w.Set("a", "1")
+	w.Set("b", "1")
+	for i := 0; i < 100; i++ {
+		if _, ok := s.get("b"); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("a full batch should be written immediately")
+}
+
+func TestBehindRetry(t *testing.T) {
+	s := newStore()
+	s.setFail(errors.New("store down"))
+	w, _ := Open(Config{Mode: Behind, Set: s.set, MaxRetries: 2, FlushInterval: time.Hour})
+	defer w.Close()
+	w.Set("a", "1")
+	w.Flush()
+	// 失败期间的新值覆盖旧值
+	w.Set("a", "2")
+	w.Flush()
+	if st := w.Stats(); st.Queued != 1 || st.Retries != 2 || st.LastError != "store down" {
+		t.Fatal("check retry", st)
+	}
+	s.setFail(nil)
+	w.Flush()
+	if v, _ := s.get("a"); v != "2" {
+		t.Fatal("latest value should be written", v)
+	}
+
+	s.setFail(errors.New("store down"))
+	w.Set("b", "1")
+	for i := 0; i < 3; i++ {
+		w.Flush()
+	}
+	if st := w.Stats(); st.Queued != 0 || st.Failures != 1 {
+		t.Fatal("op should be dropped after retries", st)
+	}
+}
+
+func TestBehindPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes")
+	s := newStore()
+	s.setFail(errors.New("store down"))
+	w, _ := Open(Config{Mode: Behind, Set: s.set, Delete: s.delete, FlushInterval: time.Hour, Path: path})
+	w.Set("a", "1")
+	w.Delete("b")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newStore()
+	s.data["b"] = "old"
+	w, err := Open(Config{Mode: Behind, Set: s.set, Delete: s.delete, FlushInterval: time.Hour, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := w.Stats(); st.Queued != 2 {
+		t.Fatal("unflushed ops should be restored", st)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.get("a"); v != "1" {
+		t.Fatal("restored op should be written", v)
+	}
+	if _, ok := s.get("b"); ok {
+		t.Fatal("restored delete should be applied")
+	}
+	if ops, _ := readOps(path); len(ops) != 0 {
+		t.Fatal("file should be removed after all ops are written", ops)
+	}
+}
+
+func TestBehindBackoff(t *testing.T) {
+	s := newStore()
+	s.setFail(errors.New("store down"))
+	w, _ := Open(Config{Mode: Behind, Set: s.set, FlushInterval: time.Second, MaxBackoff: 4 * time.Second})
+	defer w.Close()
+	w.Set("a", "1")
+	for i := 0; i < 10; i++ {
+		w.Flush()
+	}
+	// 默认不丢弃, 重试间隔倍增到上限
+	if st := w.Stats(); st.Queued != 1 || st.Failures != 0 || st.RetryIn <= 2*time.Second || st.RetryIn > 4*time.Second {
+		t.Fatal("check backoff", st)
+	}
+	s.setFail(nil)
+	w.Flush()
+	if st := w.Stats(); st.Queued != 0 || st.RetryIn != 0 {
+		t.Fatal("backoff should be reset after success", st)
+	}
+}
+
+func TestBehindPersistOnEnqueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes")
+	s := newStore()
+	s.setFail(errors.New("store down"))
+	w, _ := Open(Config{Mode: Behind, Set: s.set, FlushInterval: time.Hour, Path: path})
+	w.Set("a", "1")
+	w.Set("b", "1")
+	w.Set("a", "2")
+	// 未关闭(进程崩溃)时已入队的操作也在文件中
+	if ops, _ := readOps(path); len(ops) != 3 {
+		t.Fatal("ops should be appended on enqueue", ops)
+	}
+	w.Flush()
+	w.save()
+	w.Set("c", "1")
+	if ops, _ := readOps(path); len(ops) != 3 || ops[2].Key != "c" {
+		t.Fatal("file should be rewritten after flush", ops)
+	}
+
+	s = newStore()
+	w2, err := Open(Config{Mode: Behind, Set: s.set, FlushInterval: time.Hour, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := w2.Stats(); st.Queued != 3 {
+		t.Fatal("ops should be restored", st)
+	}
+	w2.Close()
+	if v, _ := s.get("a"); v != "2" {
+		t.Fatal("latest value should be restored", v)
+	}
+	w.Close()
+}
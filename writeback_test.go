@@ -0,0 +1,195 @@
+package zkcache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"zkCache/writeback"
+)
+
+func TestWriteThrough(t *testing.T) {
+	var mu sync.Mutex
+	store := map[string]string{"k": "old"}
+	var fail error
+	c := NewController("write-through", 0, nil, nil)
+	err := c.EnableWriteback(writeback.Config{
+		Mode: writeback.Through,
+		Set: func(key string, value string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail != nil {
+				return fail
+			}
+			store[key] = value
+			return nil
+		},
+		Delete: func(key string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(store, key)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseWriteback()
+	if err := c.Set("k", "v"); err != nil || store["k"] != "v" {
+		t.Fatal("value should be written to store", store, err)
+	}
+	fail = errors.New("store down")
+	if err := c.Set("k", "v2"); err == nil {
+		t.Fatal("store error should be returned")
+	}
+	if e, _ := c.GetLocal("k"); e.Value != "v" {
+		t.Fatal("cache should not change when store fails", e)
+	}
+	fail = nil
+	if exist, err := c.Delete("k"); err != nil || !exist {
+		t.Fatal(exist, err)
+	}
+	if _, ok := store["k"]; ok {
+		t.Fatal("value should be deleted from store")
+	}
+	if s := c.Stats().Writeback; s == nil || s.Written != 2 || s.Failures != 1 {
+		t.Fatal("check stats", s)
+	}
+	if err := c.EnableWriteback(writeback.Config{Mode: writeback.Behind}); err == nil {
+		t.Fatal("writeback should be enabled only once")
+	}
+}
+
+func TestWriteBehindPersist(t *testing.T) {
+	cfg := PersistConfig{Dir: t.TempDir()}
+	var mu sync.Mutex
+	store := map[string]string{}
+	var fail error
+	wcfg := writeback.Config{
+		Mode:          writeback.Behind,
+		FlushInterval: time.Hour,
+		Set: func(key string, value string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail != nil {
+				return fail
+			}
+			store[key] = value
+			return nil
+		},
+	}
+	c := NewController("write-behind", 0, nil, nil)
+	if err := c.EnablePersistence(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EnableWriteback(wcfg); err != nil {
+		t.Fatal(err)
+	}
+	fail = errors.New("store down")
+	c.Set("k", "v1")
+	c.Set("k", "v2")
+	if e, _ := c.GetLocal("k"); e.Value != "v2" {
+		t.Fatal("cache should be written first", e)
+	}
+	if s := c.Stats().Writeback; s == nil || s.Queued != 1 || s.Coalesced != 1 {
+		t.Fatal("check stats", s)
+	}
+	c.CloseWriteback()
+	c.ClosePersistence()
+
+	fail = nil
+	c = restart("write-behind")
+	if err := c.EnablePersistence(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer c.ClosePersistence()
+	if err := c.EnableWriteback(wcfg); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats().Writeback; s.Queued != 1 {
+		t.Fatal("unflushed writes should be restored", s)
+	}
+	c.CloseWriteback()
+	if store["k"] != "v2" {
+		t.Fatal("restored write should reach the store", store)
+	}
+}
+
+func TestWriteBehindLoad(t *testing.T) {
+	var mu sync.Mutex
+	store := map[string]string{"a": "old", "b": "old"}
+	get := func(key string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if v, ok := store[key]; ok {
+			return v, nil
+		}
+		return "", errors.New("not found")
+	}
+	set := func(key string, value string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		store[key] = value
+		return nil
+	}
+	c := NewController("write-behind-load", 0, get, nil)
+	if err := c.EnableWriteback(writeback.Config{Mode: writeback.Behind, Set: set, FlushInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseWriteback()
+	c.Set("a", "new")
+	c.Delete("a")
+	if v, err := c.Get("a", 0); err == nil {
+		t.Fatal("pending delete should not load the old value", string(v))
+	}
+	c.Set("b", "new")
+	// 模拟被淘汰, 未写入数据源前从队列中读取
+	c.cache.remove("b")
+	if v, err := c.Get("b", 0); err != nil || string(v) != "new" {
+		t.Fatal("pending set should be loaded", string(v), err)
+	}
+}
+
+func TestWritebackConditional(t *testing.T) {
+	var mu sync.Mutex
+	store := map[string]string{}
+	set := func(key string, value string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		store[key] = value
+		return nil
+	}
+	stored := func(key string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return store[key]
+	}
+
+	c := NewController("write-through-conditional", 0, nil, nil)
+	c.EnableWriteback(writeback.Config{Mode: writeback.Through, Set: set})
+	defer c.CloseWriteback()
+	version, err := c.CompareAndSet("k", 0, "v1")
+	if err != nil || stored("k") != "v1" {
+		t.Fatal("cas should be written to store", err, store)
+	}
+	if _, err := c.CompareAndSet("k", version+1, "v2"); err == nil || stored("k") != "v1" {
+		t.Fatal("mismatched cas should not reach store", err, store)
+	}
+	if n, err := c.Incr("n", 5, 0); err != nil || n != 5 || stored("n") != "5" {
+		t.Fatal("incr should be written to store", n, err, store)
+	}
+
+	c = NewController("write-behind-conditional", 0, nil, nil)
+	c.EnableWriteback(writeback.Config{Mode: writeback.Behind, Set: set, FlushInterval: time.Hour})
+	defer c.CloseWriteback()
+	c.CompareAndSet("a", 0, "v1")
+	c.Incr("b", 2, 0)
+	if s := c.Stats().Writeback; s.Queued != 2 {
+		t.Fatal("cas and incr should be queued", s)
+	}
+	c.SetLocal("c", "v1", "tag")
+	c.InvalidateTag("tag")
+	if s := c.Stats().Writeback; s.Queued != 0 || stored("a") != "v1" || stored("b") != "2" || stored("c") != "v1" {
+		t.Fatal("invalidate tag should flush queued writes", s, store)
+	}
+}